@@ -0,0 +1,212 @@
+// Package apikeys stores the keys integrations use instead of logging in
+// with a user's password, and checks the keys presented with requests.
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+	"tm/database"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Prefix starts every key, so keys are told apart from access tokens and
+// are easy to spot when leaked.
+const Prefix = "tmk_"
+
+// Scopes limit the route groups a key may be used on. The ":read" form of a
+// scope only allows GET requests.
+const (
+	ScopeDevices  = "devices"
+	ScopeDrivers  = "drivers"
+	ScopeVehicles = "vehicles"
+	ScopeAdmin    = "admin"
+
+	readOnly = ":read"
+)
+
+// Scopes lists every scope a key can be given.
+var Scopes = []string{
+	ScopeDevices, ScopeDevices + readOnly,
+	ScopeDrivers, ScopeDrivers + readOnly,
+	ScopeVehicles, ScopeVehicles + readOnly,
+	ScopeAdmin, ScopeAdmin + readOnly,
+}
+
+// touchInterval bounds how often the last use of a key is written, since it
+// is checked on every request.
+const touchInterval = time.Minute
+
+// ErrInvalid is returned for keys that are unknown, expired or revoked, or
+// whose user is disabled.
+var ErrInvalid = errors.New("invalid API key")
+
+// Key is an API key without its secret. A key has either a UserID and acts
+// as that user, or a Role and acts for its organization.
+type Key struct {
+	ID         int        `json:"id"`
+	OrgID      int        `json:"orgId"`
+	UserID     *int       `json:"userId"`
+	Role       *string    `json:"role"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  *int       `json:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	LastUsedIP string     `json:"lastUsedIp"`
+}
+
+// Identity is who a request made with a key acts as.
+type Identity struct {
+	Key
+	// Username is empty for organization keys.
+	Username string
+	// EffectiveRole is the current role of the user, or the role of an
+	// organization key.
+	EffectiveRole string
+}
+
+// IsKey reports whether a bearer token is an API key.
+func IsKey(token string) bool {
+	return strings.HasPrefix(token, Prefix)
+}
+
+// ValidScope reports whether a key can be given a scope.
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the key may make a request with a method to a
+// route group of a scope.
+func (k Key) Allows(scope, method string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || (s == scope+readOnly && (method == "GET" || method == "HEAD")) {
+			return true
+		}
+	}
+	return false
+}
+
+func hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func random(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	return b, err
+}
+
+const keyColumns = `k.id, k.org_id, k.user_id, k.role, k.name, k.prefix, k.scopes, k.created_by,
+	k.created_at, k.expires_at, k.last_used_at, k.last_used_ip`
+
+func scanKey(row pgx.Row, extra ...interface{}) (Key, error) {
+	var k Key
+	dest := append([]interface{}{&k.ID, &k.OrgID, &k.UserID, &k.Role, &k.Name, &k.Prefix, &k.Scopes, &k.CreatedBy,
+		&k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt, &k.LastUsedIP}, extra...)
+	err := row.Scan(dest...)
+	return k, err
+}
+
+// Create stores a key with the owner, name, scopes and expiry of k in tx and
+// returns it with the key itself, which is not stored and cannot be shown
+// again.
+func Create(ctx context.Context, tx pgx.Tx, k Key) (Key, string, error) {
+	id, err := random(4)
+	if err != nil {
+		return Key{}, "", err
+	}
+	secret, err := random(32)
+	if err != nil {
+		return Key{}, "", err
+	}
+	prefix := Prefix + hex.EncodeToString(id)
+	key := prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	created, err := scanKey(tx.QueryRow(ctx,
+		`INSERT INTO api_keys AS k (org_id, user_id, role, name, prefix, key_hash, scopes, created_by, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 RETURNING `+keyColumns,
+		k.OrgID, k.UserID, k.Role, k.Name, prefix, hash(key), k.Scopes, k.CreatedBy, k.ExpiresAt))
+	if err != nil {
+		return Key{}, "", err
+	}
+	return created, key, nil
+}
+
+// Authenticate returns who a key acts as and notes that it was used from an
+// address.
+func Authenticate(ctx context.Context, key, ip string) (Identity, error) {
+	var id Identity
+	var err error
+	id.Key, err = scanKey(database.DBpool.QueryRow(ctx,
+		`SELECT `+keyColumns+`, COALESCE(u.username, ''), COALESCE(u.role, k.role)
+		 FROM api_keys k LEFT JOIN users u ON u.id = k.user_id
+		 WHERE k.key_hash = $1 AND k.revoked_at IS NULL
+		   AND (k.expires_at IS NULL OR k.expires_at > now())
+		   AND (k.user_id IS NULL OR u.active)`, hash(key)),
+		&id.Username, &id.EffectiveRole)
+	if err == pgx.ErrNoRows {
+		return Identity{}, ErrInvalid
+	}
+	if err != nil {
+		return Identity{}, err
+	}
+
+	_, err = database.DBpool.Exec(ctx,
+		`UPDATE api_keys SET last_used_at = now(), last_used_ip = $2
+		 WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $3 OR last_used_ip <> $2)`,
+		id.ID, ip, time.Now().Add(-touchInterval))
+	return id, err
+}
+
+// List returns the keys of an organization that are not revoked, newest
+// first. A userID other than 0 only returns the keys of that user.
+func List(ctx context.Context, orgID, userID int) ([]Key, error) {
+	rows, err := database.DBpool.Query(ctx,
+		`SELECT `+keyColumns+` FROM api_keys k
+		 WHERE k.org_id = $1 AND ($2 = 0 OR k.user_id = $2) AND k.revoked_at IS NULL
+		 ORDER BY k.id DESC`, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []Key{}
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// Revoke disables a key of an organization in tx, or with a userID other
+// than 0 only a key of that user, and returns it. It returns ErrInvalid if there is
+// no such key that is not already revoked.
+func Revoke(ctx context.Context, tx pgx.Tx, id, orgID, userID int) (Key, error) {
+	k, err := scanKey(tx.QueryRow(ctx,
+		`UPDATE api_keys k SET revoked_at = now()
+		 WHERE k.id = $1 AND k.org_id = $2 AND ($3 = 0 OR k.user_id = $3) AND k.revoked_at IS NULL
+		 RETURNING `+keyColumns, id, orgID, userID))
+	if err == pgx.ErrNoRows {
+		return Key{}, ErrInvalid
+	}
+	return k, err
+}
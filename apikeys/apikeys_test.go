@@ -0,0 +1,53 @@
+package apikeys
+
+import "testing"
+
+func TestAllows(t *testing.T) {
+	k := Key{Scopes: []string{ScopeDevices, ScopeDrivers + readOnly}}
+	tests := []struct {
+		scope, method string
+		want          bool
+	}{
+		{ScopeDevices, "GET", true},
+		{ScopeDevices, "POST", true},
+		{ScopeDrivers, "GET", true},
+		{ScopeDrivers, "HEAD", true},
+		{ScopeDrivers, "PUT", false},
+		{ScopeDrivers, "DELETE", false},
+		{ScopeVehicles, "GET", false},
+		{ScopeAdmin, "GET", false},
+	}
+	for _, tt := range tests {
+		if got := k.Allows(tt.scope, tt.method); got != tt.want {
+			t.Errorf("Allows(%s, %s) = %v, want %v", tt.scope, tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestValidScope(t *testing.T) {
+	for _, s := range []string{"devices", "admin:read", "vehicles"} {
+		if !ValidScope(s) {
+			t.Errorf("ValidScope(%q) = false", s)
+		}
+	}
+	for _, s := range []string{"", "devices:write", "Devices", "*"} {
+		if ValidScope(s) {
+			t.Errorf("ValidScope(%q) = true", s)
+		}
+	}
+}
+
+func TestIsKey(t *testing.T) {
+	if !IsKey("tmk_0a1b2c3d_secret") {
+		t.Error("key not recognized")
+	}
+	if IsKey("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Error("access token taken for a key")
+	}
+}
+
+func TestHash(t *testing.T) {
+	if hash("tmk_a") == hash("tmk_b") || len(hash("tmk_a")) != 64 {
+		t.Error("keys must hash to distinct SHA-256 hex digests")
+	}
+}
@@ -0,0 +1,791 @@
+// Package archive copies closed partitions of device_locations into
+// gzip-compressed CSV files, one per device, before they are downsampled,
+// drops them from Postgres once they leave the hot window, and reads them
+// back when a history query reaches past it. Fixes that come in after a
+// partition was archived get their device's file written again. Archives are
+// recorded in location_partitions, and mirrored in a JSON manifest next to
+// the files.
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"tm/config"
+	"tm/database"
+	"tm/models"
+	"tm/partitions"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	manifestKey = "manifest.json"
+	csvHeader   = "device_id,timestamp,latitude,longitude,speed\n"
+	// lockKey is the advisory lock that keeps concurrent instances from
+	// archiving the same partition twice.
+	lockKey = 7202403301
+	// settleTime is how long after its month a partition is archived, for
+	// the fixes that devices buffered while offline to come in.
+	settleTime = 7 * 24 * time.Hour
+)
+
+// Entry describes one archived partition. Key is the prefix of its files,
+// or the single file of all devices of archives written before there was
+// one per device.
+type Entry struct {
+	Partition  string    `json:"partition"`
+	Key        string    `json:"key"`
+	RangeStart int64     `json:"rangeStart"`
+	RangeEnd   int64     `json:"rangeEnd"`
+	Rows       int64     `json:"rows"`
+	SHA256     string    `json:"sha256"`
+	ArchivedAt time.Time `json:"archivedAt"`
+}
+
+// DeviceFile is the archive file of one device in a partition.
+type DeviceFile struct {
+	DeviceId string `json:"deviceId"`
+	Key      string `json:"key"`
+	Rows     int64  `json:"rows"`
+	SHA256   string `json:"sha256"`
+}
+
+// Index lists the files of an archived partition. It is stored as
+// index.json under the partition's prefix; its SHA-256 sum is the one
+// recorded for the partition.
+type Index struct {
+	Devices []DeviceFile `json:"devices"`
+}
+
+// Manifest lists every archived partition.
+type Manifest struct {
+	Entries []Entry `json:"entries"`
+}
+
+var (
+	store Store
+	// HotWindow is how long location history stays in Postgres before its
+	// partition is dropped, leaving only the archive.
+	HotWindow     time.Duration
+	CheckInterval = time.Hour
+)
+
+// Enabled reports whether archiving has been configured.
+func Enabled() bool {
+	return store != nil
+}
+
+// Init configures archiving and loads the manifest. Archiving stays disabled
+// when no hot window is configured.
+func Init() {
+	cfg := config.C.Archive
+	if cfg.HotDays == 0 {
+		log.Println("Location archiving disabled: no hot window configured")
+		return
+	}
+	HotWindow = time.Duration(cfg.HotDays) * 24 * time.Hour
+	partitions.Current.ArchiveBeforeDrop = true
+
+	if cfg.S3.Endpoint != "" {
+		store = S3Store{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+		}
+	} else {
+		store = LocalStore{Dir: cfg.Dir}
+	}
+
+	if err := importManifest(context.Background()); err != nil {
+		log.Fatalf("Unable to load archive manifest: %v\n", err)
+	}
+}
+
+// importManifest fills in the details of archives made before they were
+// recorded in the database from the manifest in the store.
+func importManifest(ctx context.Context) error {
+	r, err := store.Get(ctx, manifestKey)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return err
+	}
+	for _, e := range m.Entries {
+		_, err := database.DBpool.Exec(ctx,
+			`UPDATE location_partitions SET archive_key=$2, archive_rows=$3, archive_sha256=$4, archived_at=$5
+			 WHERE name=$1 AND archive_sha256 = ''`,
+			e.Partition, e.Key, e.Rows, e.SHA256, e.ArchivedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryColumns are the columns of location_partitions scanned into an Entry.
+const entryColumns = `name, archive_key, range_start, range_end, archive_rows, archive_sha256,
+	COALESCE(archived_at, dropped_at, created_at)`
+
+func queryEntries(ctx context.Context, where string, args ...interface{}) ([]Entry, error) {
+	rows, err := database.DBpool.Query(ctx,
+		"SELECT "+entryColumns+" FROM location_partitions WHERE archive_key <> '' AND "+where+" ORDER BY range_start", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.Partition, &e.Key, &e.RangeStart, &e.RangeEnd, &e.Rows, &e.SHA256, &e.ArchivedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Entries returns every archived partition, oldest first.
+func Entries(ctx context.Context) ([]Entry, error) {
+	return queryEntries(ctx, "true")
+}
+
+// Run archives due partitions now and then every CheckInterval. It never
+// returns and does nothing when archiving is disabled.
+func Run() {
+	if !Enabled() {
+		return
+	}
+	ticker := time.NewTicker(CheckInterval)
+	defer ticker.Stop()
+	for {
+		if err := archiveDue(context.Background(), time.Now()); err != nil {
+			log.Println("Error archiving location partitions:", err)
+		}
+		<-ticker.C
+	}
+}
+
+func archiveDue(ctx context.Context, now time.Time) error {
+	conn, err := database.DBpool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", lockKey).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+	defer conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", lockKey)
+
+	parts, err := partitions.List(ctx)
+	if err != nil {
+		return err
+	}
+	settled := now.Add(-settleTime).Unix()
+	cutoff := now.Add(-HotWindow).Unix()
+	for _, p := range parts {
+		if p.State == "dropped" || p.State == "archived" {
+			continue
+		}
+		if p.ArchiveKey == "" && p.RangeEnd <= settled {
+			if p.ArchiveKey, err = archivePartition(ctx, p); err != nil {
+				return fmt.Errorf("archiving %s: %w", p.Name, err)
+			}
+		}
+		if p.ArchiveKey != "" {
+			if p.ArchiveKey, err = refreshPartition(ctx, p); err != nil {
+				return fmt.Errorf("archiving late fixes of %s: %w", p.Name, err)
+			}
+		}
+		if p.ArchiveKey != "" && p.RangeEnd <= cutoff {
+			if err := partitions.Drop(ctx, p.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// NoteLate records in tx, the transaction that inserts a fix of a device,
+// that the fix went into a partition that may already be archived, so that
+// the device's archive file is written again. Recent fixes are skipped
+// without a query.
+func NoteLate(ctx context.Context, tx pgx.Tx, deviceId string, timestamp int64) error {
+	settled := time.Now().Add(-settleTime).Unix()
+	if !Enabled() || timestamp >= settled {
+		return nil
+	}
+	_, err := tx.Exec(ctx,
+		`INSERT INTO location_archive_stale (partition, device_id)
+		 SELECT name, $1 FROM location_partitions
+		 WHERE range_start <= $2 AND range_end > $2 AND range_end <= $3 AND dropped_at IS NULL
+		 ON CONFLICT (partition, device_id) DO UPDATE SET version = nextval('location_archive_stale_version')`,
+		deviceId, timestamp, settled)
+	return err
+}
+
+func partitionPrefix(name string) string {
+	return "device_locations/" + name + "/"
+}
+
+func deviceKey(prefix, deviceId string) string {
+	return prefix + url.PathEscape(deviceId) + ".csv.gz"
+}
+
+// isLegacy reports whether an archive is a single file of all devices.
+func isLegacy(key string) bool {
+	return strings.HasSuffix(key, ".csv.gz")
+}
+
+// archivePartition writes a partition to the store and records it, returning
+// the prefix of its files.
+func archivePartition(ctx context.Context, p models.Partition) (string, error) {
+	rows, err := database.DBpool.Query(ctx, fmt.Sprintf(
+		"SELECT device_id, timestamp, latitude, longitude, speed FROM %s ORDER BY device_id, timestamp",
+		pgx.Identifier{p.Name}.Sanitize()))
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	prefix := partitionPrefix(p.Name)
+	files, err := writeDevices(ctx, prefix, rowSource{rows})
+	if err != nil {
+		return "", err
+	}
+	if err := saveIndex(ctx, p.Name, prefix, Index{Devices: files}); err != nil {
+		return "", err
+	}
+	log.Printf("Archived location partition %s to %s (%d devices)", p.Name, prefix, len(files))
+	return prefix, nil
+}
+
+// refreshPartition writes the files of the devices that got fixes after the
+// partition was archived again, from the archived fixes and those still in
+// the partition, and returns the prefix of its files. A single file archive
+// is split into one file per device first.
+func refreshPartition(ctx context.Context, p models.Partition) (string, error) {
+	rows, err := database.DBpool.Query(ctx,
+		"SELECT device_id, version FROM location_archive_stale WHERE partition = $1", p.Name)
+	if err != nil {
+		return "", err
+	}
+	stale := map[string]int64{}
+	for rows.Next() {
+		var deviceId string
+		var version int64
+		if err := rows.Scan(&deviceId, &version); err != nil {
+			rows.Close()
+			return "", err
+		}
+		stale[deviceId] = version
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(stale) == 0 {
+		return p.ArchiveKey, nil
+	}
+
+	prefix := partitionPrefix(p.Name)
+	var index Index
+	if isLegacy(p.ArchiveKey) {
+		index, err = splitLegacy(ctx, p.ArchiveKey, prefix)
+	} else {
+		index, err = loadIndex(ctx, prefix)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	for deviceId := range stale {
+		if index, err = refreshDevice(ctx, p.Name, prefix, index, deviceId); err != nil {
+			return "", err
+		}
+	}
+	if err := saveIndex(ctx, p.Name, prefix, index); err != nil {
+		return "", err
+	}
+
+	// Devices with fixes that came in meanwhile have a new version and stay
+	for deviceId, version := range stale {
+		_, err := database.DBpool.Exec(ctx,
+			"DELETE FROM location_archive_stale WHERE partition = $1 AND device_id = $2 AND version = $3",
+			p.Name, deviceId, version)
+		if err != nil {
+			return "", err
+		}
+	}
+	log.Printf("Archived late fixes of %d devices in location partition %s", len(stale), p.Name)
+	return prefix, nil
+}
+
+// refreshDevice merges the archived fixes of a device with those in the
+// partition into a new file, and returns the index with it.
+func refreshDevice(ctx context.Context, name, prefix string, index Index, deviceId string) (Index, error) {
+	var archived fixSource = emptySource{}
+	at := -1
+	for i, f := range index.Devices {
+		if f.DeviceId == deviceId {
+			at = i
+			r, err := openFile(ctx, f.Key)
+			if err != nil {
+				return index, err
+			}
+			defer r.Close()
+			if archived, err = newCSVSource(r); err != nil {
+				return index, err
+			}
+		}
+	}
+
+	rows, err := database.DBpool.Query(ctx, fmt.Sprintf(
+		"SELECT device_id, timestamp, latitude, longitude, speed FROM %s WHERE device_id = $1 ORDER BY timestamp",
+		pgx.Identifier{name}.Sanitize()), deviceId)
+	if err != nil {
+		return index, err
+	}
+	defer rows.Close()
+
+	files, err := writeDevices(ctx, prefix, &mergeSource{a: archived, b: rowSource{rows}})
+	if err != nil || len(files) == 0 {
+		return index, err
+	}
+	if at >= 0 {
+		index.Devices[at] = files[0]
+	} else {
+		index.Devices = append(index.Devices, files[0])
+	}
+	return index, nil
+}
+
+// splitLegacy writes a single file archive as one file per device.
+func splitLegacy(ctx context.Context, key, prefix string) (Index, error) {
+	r, err := openFile(ctx, key)
+	if err != nil {
+		return Index{}, err
+	}
+	defer r.Close()
+	src, err := newCSVSource(r)
+	if err != nil {
+		return Index{}, err
+	}
+	files, err := writeDevices(ctx, prefix, src)
+	return Index{Devices: files}, err
+}
+
+func loadIndex(ctx context.Context, prefix string) (Index, error) {
+	var index Index
+	r, err := store.Get(ctx, prefix+"index.json")
+	if err != nil {
+		return index, err
+	}
+	defer r.Close()
+	err = json.NewDecoder(r).Decode(&index)
+	return index, err
+}
+
+// saveIndex stores the index of a partition's files and records the
+// partition as archived under prefix.
+func saveIndex(ctx context.Context, name, prefix string, index Index) error {
+	sort.Slice(index.Devices, func(i, j int) bool { return index.Devices[i].DeviceId < index.Devices[j].DeviceId })
+	if index.Devices == nil {
+		index.Devices = []DeviceFile{}
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	sumHex := hex.EncodeToString(sum[:])
+	if err := store.Put(ctx, prefix+"index.json", bytes.NewReader(data), int64(len(data)), sumHex); err != nil {
+		return err
+	}
+
+	var rows int64
+	for _, f := range index.Devices {
+		rows += f.Rows
+	}
+	if err := partitions.Archived(ctx, name, prefix, rows, sumHex); err != nil {
+		return err
+	}
+	return writeManifest(ctx)
+}
+
+// writeDevices writes the fixes of src, grouped by device, to one file per
+// device under prefix.
+func writeDevices(ctx context.Context, prefix string, src fixSource) ([]DeviceFile, error) {
+	files := []DeviceFile{}
+	var w *deviceWriter
+	defer func() {
+		if w != nil {
+			w.close()
+		}
+	}()
+	for {
+		f, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if w != nil && w.file.DeviceId != f.deviceId {
+			file, err := w.finish(ctx)
+			w = nil
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+		if w == nil {
+			if w, err = newDeviceWriter(deviceKey(prefix, f.deviceId), f.deviceId); err != nil {
+				return nil, err
+			}
+		}
+		if err := w.write(f); err != nil {
+			return nil, err
+		}
+	}
+	if w != nil {
+		file, err := w.finish(ctx)
+		w = nil
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// deviceWriter writes the archive file of one device to a temporary file
+// and stores it when finished.
+type deviceWriter struct {
+	file DeviceFile
+	tmp  *os.File
+	hash hash.Hash
+	gz   *gzip.Writer
+	csv  *csv.Writer
+}
+
+func newDeviceWriter(key, deviceId string) (*deviceWriter, error) {
+	tmp, err := os.CreateTemp("", "archive-*.csv.gz")
+	if err != nil {
+		return nil, err
+	}
+	w := &deviceWriter{file: DeviceFile{DeviceId: deviceId, Key: key}, tmp: tmp, hash: sha256.New()}
+	w.gz = gzip.NewWriter(io.MultiWriter(tmp, w.hash))
+	w.csv = csv.NewWriter(w.gz)
+	if _, err := io.WriteString(w.gz, csvHeader); err != nil {
+		w.close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *deviceWriter) write(f archivedFix) error {
+	speed := ""
+	if f.Speed != nil {
+		speed = strconv.FormatFloat(*f.Speed, 'f', -1, 64)
+	}
+	w.file.Rows++
+	return w.csv.Write([]string{
+		f.deviceId,
+		strconv.FormatInt(f.Timestamp, 10),
+		strconv.FormatFloat(f.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(f.Longitude, 'f', -1, 64),
+		speed,
+	})
+}
+
+func (w *deviceWriter) finish(ctx context.Context) (DeviceFile, error) {
+	defer w.close()
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return w.file, err
+	}
+	if err := w.gz.Close(); err != nil {
+		return w.file, err
+	}
+	size, err := w.tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return w.file, err
+	}
+	if _, err := w.tmp.Seek(0, io.SeekStart); err != nil {
+		return w.file, err
+	}
+	w.file.SHA256 = hex.EncodeToString(w.hash.Sum(nil))
+	return w.file, store.Put(ctx, w.file.Key, w.tmp, size, w.file.SHA256)
+}
+
+// close removes the temporary file; it may be called more than once.
+func (w *deviceWriter) close() {
+	if w.tmp != nil {
+		w.tmp.Close()
+		os.Remove(w.tmp.Name())
+		w.tmp = nil
+	}
+}
+
+// writeManifest replaces the manifest in the store with the archives
+// recorded in the database.
+func writeManifest(ctx context.Context) error {
+	entries, err := Entries(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(Manifest{Entries: entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	return store.Put(ctx, manifestKey, bytes.NewReader(data), int64(len(data)), hex.EncodeToString(sum[:]))
+}
+
+// ReadDevice returns the locations of a device with timestamps in [from, to]
+// from the archives of partitions that were dropped, newest first. Only the
+// device's own file of each partition is read. Archived partitions still in
+// the database are left to the caller's query.
+func ReadDevice(ctx context.Context, deviceId string, from, to int64) ([]models.DeviceLocation, error) {
+	entries, err := queryEntries(ctx, "dropped_at IS NOT NULL AND range_start <= $1 AND range_end > $2", to, from)
+	if err != nil {
+		return nil, err
+	}
+	var locations []models.DeviceLocation
+	for _, e := range entries {
+		key := e.Key
+		if !isLegacy(key) {
+			key = deviceKey(key, deviceId)
+		}
+		found, err := readFile(ctx, key, deviceId, from, to)
+		if errors.Is(err, ErrNotFound) && key != e.Key {
+			// The device sent nothing that month
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", key, err)
+		}
+		locations = append(locations, found...)
+	}
+
+	sort.Slice(locations, func(i, j int) bool { return locations[i].Timestamp > locations[j].Timestamp })
+	return locations, nil
+}
+
+// readFile returns the fixes of a device in [from, to] from an archive file.
+func readFile(ctx context.Context, key, deviceId string, from, to int64) ([]models.DeviceLocation, error) {
+	r, err := openFile(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	src, err := newCSVSource(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var locations []models.DeviceLocation
+	seen := false
+	for {
+		f, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if f.deviceId != deviceId {
+			// Rows are grouped by device, so the block of this device is over.
+			if seen {
+				break
+			}
+			continue
+		}
+		seen = true
+		if f.Timestamp >= from && f.Timestamp <= to {
+			locations = append(locations, f.DeviceLocation)
+		}
+	}
+	return locations, nil
+}
+
+// gzipFile is an archive file being read.
+type gzipFile struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (f gzipFile) Close() error {
+	f.Reader.Close()
+	return f.body.Close()
+}
+
+// openFile opens an archive file and decompresses it.
+func openFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	return gzipFile{gz, body}, nil
+}
+
+// archivedFix is one row of an archive file.
+type archivedFix struct {
+	deviceId string
+	models.DeviceLocation
+}
+
+// fixSource yields fixes grouped by device and ordered by time within a
+// device. next returns io.EOF after the last one.
+type fixSource interface {
+	next() (archivedFix, error)
+}
+
+type emptySource struct{}
+
+func (emptySource) next() (archivedFix, error) {
+	return archivedFix{}, io.EOF
+}
+
+// rowSource reads fixes from a query of device_id, timestamp, latitude,
+// longitude and speed.
+type rowSource struct {
+	rows pgx.Rows
+}
+
+func (s rowSource) next() (archivedFix, error) {
+	var f archivedFix
+	if !s.rows.Next() {
+		if err := s.rows.Err(); err != nil {
+			return f, err
+		}
+		return f, io.EOF
+	}
+	err := s.rows.Scan(&f.deviceId, &f.Timestamp, &f.Latitude, &f.Longitude, &f.Speed)
+	return f, err
+}
+
+// csvSource reads fixes from an archive file.
+type csvSource struct {
+	reader *csv.Reader
+}
+
+func newCSVSource(r io.Reader) (*csvSource, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 5
+	reader.ReuseRecord = true
+	if _, err := reader.Read(); err != nil { // header
+		return nil, err
+	}
+	return &csvSource{reader}, nil
+}
+
+func (s *csvSource) next() (archivedFix, error) {
+	var f archivedFix
+	record, err := s.reader.Read()
+	if err != nil {
+		return f, err
+	}
+	f.deviceId = record[0]
+	if f.Timestamp, err = strconv.ParseInt(record[1], 10, 64); err != nil {
+		return f, err
+	}
+	if f.Latitude, err = strconv.ParseFloat(record[2], 64); err != nil {
+		return f, err
+	}
+	if f.Longitude, err = strconv.ParseFloat(record[3], 64); err != nil {
+		return f, err
+	}
+	if record[4] != "" {
+		speed, err := strconv.ParseFloat(record[4], 64)
+		if err != nil {
+			return f, err
+		}
+		f.Speed = &speed
+	}
+	return f, nil
+}
+
+// mergeSource merges the fixes of one device from two sources by time. Of
+// two fixes at the same time, the one of a is kept.
+type mergeSource struct {
+	a, b         fixSource
+	headA, headB *archivedFix
+	doneA, doneB bool
+}
+
+func fill(src fixSource, head **archivedFix, done *bool) error {
+	if *head != nil || *done {
+		return nil
+	}
+	f, err := src.next()
+	if err == io.EOF {
+		*done = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	*head = &f
+	return nil
+}
+
+func (m *mergeSource) next() (archivedFix, error) {
+	if err := fill(m.a, &m.headA, &m.doneA); err != nil {
+		return archivedFix{}, err
+	}
+	if err := fill(m.b, &m.headB, &m.doneB); err != nil {
+		return archivedFix{}, err
+	}
+	switch {
+	case m.headA == nil && m.headB == nil:
+		return archivedFix{}, io.EOF
+	case m.headB == nil || (m.headA != nil && m.headA.Timestamp <= m.headB.Timestamp):
+		f := *m.headA
+		m.headA = nil
+		if m.headB != nil && m.headB.Timestamp == f.Timestamp {
+			m.headB = nil
+		}
+		return f, nil
+	default:
+		f := *m.headB
+		m.headB = nil
+		return f, nil
+	}
+}
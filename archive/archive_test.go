@@ -0,0 +1,153 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"tm/models"
+)
+
+// sliceSource yields fixes from a slice.
+type sliceSource []archivedFix
+
+func (s *sliceSource) next() (archivedFix, error) {
+	if len(*s) == 0 {
+		return archivedFix{}, io.EOF
+	}
+	f := (*s)[0]
+	*s = (*s)[1:]
+	return f, nil
+}
+
+func fixAt(deviceId string, timestamp int64) archivedFix {
+	return archivedFix{deviceId, models.DeviceLocation{Timestamp: timestamp, Latitude: 50, Longitude: 8}}
+}
+
+func timestamps(locations []models.DeviceLocation) []int64 {
+	ts := []int64{}
+	for _, l := range locations {
+		ts = append(ts, l.Timestamp)
+	}
+	return ts
+}
+
+func TestReadLegacyFile(t *testing.T) {
+	store = LocalStore{Dir: t.TempDir()}
+	defer func() { store = nil }()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	io.WriteString(gz, csvHeader+
+		"a,100,50.1,8.1,12.5\n"+
+		"b,100,51.1,9.1,\n"+
+		"b,200,51.2,9.2,30\n"+
+		"b,300,51.3,9.3,0\n"+
+		"c,100,52.1,10.1,1\n")
+	gz.Close()
+	key := "device_locations/p.csv.gz"
+	if err := store.Put(context.Background(), key, &buf, int64(buf.Len()), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readFile(context.Background(), key, "b", 100, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Timestamp != 100 || got[1].Timestamp != 200 {
+		t.Fatalf("readFile = %+v, want the fixes of b at 100 and 200", got)
+	}
+	if got[0].Speed != nil || got[1].Speed == nil || *got[1].Speed != 30 {
+		t.Errorf("speeds of %+v, want none and 30", got)
+	}
+	if got[1].Latitude != 51.2 || got[1].Longitude != 9.2 {
+		t.Errorf("position of %+v", got[1])
+	}
+
+	if got, err := readFile(context.Background(), key, "z", 0, 1000); err != nil || len(got) != 0 {
+		t.Errorf("unknown device = %+v, %v", got, err)
+	}
+	if _, err := readFile(context.Background(), "missing", "b", 0, 1000); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing archive: %v, want ErrNotFound", err)
+	}
+}
+
+func TestWriteDevices(t *testing.T) {
+	store = LocalStore{Dir: t.TempDir()}
+	defer func() { store = nil }()
+	ctx := context.Background()
+
+	speed := 42.5
+	withSpeed := fixAt("a/1", 200)
+	withSpeed.Speed = &speed
+	src := sliceSource{fixAt("a/1", 100), withSpeed, fixAt("b", 100)}
+	files, err := writeDevices(ctx, "device_locations/p/", &src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].DeviceId != "a/1" || files[0].Rows != 2 || files[1].Rows != 1 {
+		t.Fatalf("files = %+v, want 2 fixes of a/1 and 1 of b", files)
+	}
+	if files[0].Key != "device_locations/p/a%2F1.csv.gz" || files[0].SHA256 == "" {
+		t.Errorf("file of a/1 = %+v", files[0])
+	}
+
+	got, err := readFile(ctx, deviceKey("device_locations/p/", "a/1"), "a/1", 0, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(timestamps(got), []int64{100, 200}) || got[0].Speed != nil || *got[1].Speed != speed {
+		t.Errorf("a/1 read back as %+v", got)
+	}
+}
+
+func TestMergeSource(t *testing.T) {
+	// The partition was downsampled after archiving and got a late fix at 250
+	archived := sliceSource{fixAt("a", 100), fixAt("a", 200), fixAt("a", 300)}
+	current := sliceSource{fixAt("a", 200), fixAt("a", 250)}
+	m := &mergeSource{a: &archived, b: &current}
+
+	var got []int64
+	for {
+		f, err := m.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, f.Timestamp)
+	}
+	if !reflect.DeepEqual(got, []int64{100, 200, 250, 300}) {
+		t.Errorf("merged = %v, want 100 200 250 300", got)
+	}
+}
+
+func TestSplitLegacy(t *testing.T) {
+	store = LocalStore{Dir: t.TempDir()}
+	defer func() { store = nil }()
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	io.WriteString(gz, csvHeader+"a,100,50.1,8.1,\nb,100,51.1,9.1,\nb,200,51.2,9.2,\n")
+	gz.Close()
+	if err := store.Put(ctx, "device_locations/p.csv.gz", &buf, int64(buf.Len()), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := splitLegacy(ctx, "device_locations/p.csv.gz", "device_locations/p/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Devices) != 2 || index.Devices[1].DeviceId != "b" || index.Devices[1].Rows != 2 {
+		t.Fatalf("index = %+v", index)
+	}
+	got, err := readFile(ctx, index.Devices[1].Key, "b", 0, 1000)
+	if err != nil || !reflect.DeepEqual(timestamps(got), []int64{100, 200}) {
+		t.Errorf("b read back as %+v, %v", got, err)
+	}
+}
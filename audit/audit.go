@@ -0,0 +1,270 @@
+// Package audit keeps an append-only log of changes made through the API:
+// who did what to which entity, with its state before and after. Entries are
+// hash-chained, so tampering with stored entries can be detected.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"time"
+	"tm/database"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// chainLock is the advisory lock that serializes appends, so every entry
+// links to the one written before it.
+const chainLock = 0x61756469 // "audi"
+
+// Entry is one recorded change.
+type Entry struct {
+	ID         int64           `json:"id"`
+	OrgID      int             `json:"orgId"`
+	ActorID    *int            `json:"actorId"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entityType"`
+	EntityID   string          `json:"entityId"`
+	Before     json.RawMessage `json:"before" swaggertype:"object"`
+	After      json.RawMessage `json:"after" swaggertype:"object"`
+	Changes    json.RawMessage `json:"changes" swaggertype:"object"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"userAgent"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	PrevHash   string          `json:"prevHash"`
+	Hash       string          `json:"hash"`
+}
+
+// Change is the old and new value of a field.
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// canonical returns JSON that is the same for equal values however they
+// were encoded, so stored entries hash as they did when written. Postgres
+// reorders and reformats jsonb; Go sorts map keys.
+func canonical(raw []byte) (json.RawMessage, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+func encode(v interface{}) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return canonical(raw)
+}
+
+// diff lists the top-level fields that differ between two JSON objects.
+func diff(before, after json.RawMessage) (json.RawMessage, error) {
+	var b, a map[string]interface{}
+	if json.Unmarshal(before, &b) != nil || json.Unmarshal(after, &a) != nil || b == nil || a == nil {
+		return nil, nil
+	}
+	changes := make(map[string]Change)
+	for k, v := range a {
+		if old, ok := b[k]; !ok || !reflect.DeepEqual(old, v) {
+			changes[k] = Change{From: b[k], To: v}
+		}
+	}
+	for k, v := range b {
+		if _, ok := a[k]; !ok {
+			changes[k] = Change{From: v}
+		}
+	}
+	return encode(changes)
+}
+
+// digest is the hash of an entry's content and the hash before it.
+func (e Entry) digest() string {
+	content, _ := json.Marshal([]interface{}{
+		e.PrevHash, e.OrgID, e.ActorID, e.Actor, e.Action, e.EntityType, e.EntityID,
+		e.Before, e.After, e.Changes, e.IP, e.UserAgent,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func nullable(raw json.RawMessage) *string {
+	if raw == nil {
+		return nil
+	}
+	s := string(raw)
+	return &s
+}
+
+// Record appends an entry for a change from before to after, either of which
+// is nil for creations and deletions. It runs in tx, the transaction that
+// makes the change, so the change and its entry are committed together or
+// not at all; other appends wait until tx ends. The fields ID, Before, After,
+// Changes, CreatedAt and the hashes of e are filled in.
+func Record(ctx context.Context, tx pgx.Tx, e Entry, before, after interface{}) error {
+	var err error
+	if e.Before, err = encode(before); err != nil {
+		return err
+	}
+	if e.After, err = encode(after); err != nil {
+		return err
+	}
+	if e.Changes, err = diff(e.Before, e.After); err != nil {
+		return err
+	}
+	// Postgres keeps microseconds
+	e.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", chainLock); err != nil {
+		return err
+	}
+	err = tx.QueryRow(ctx, "SELECT COALESCE((SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1), '')").Scan(&e.PrevHash)
+	if err != nil {
+		return err
+	}
+	e.Hash = e.digest()
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO audit_log (org_id, actor_id, actor, action, entity_type, entity_id,
+		                        before, after, changes, ip, user_agent, created_at, prev_hash, hash)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7::jsonb, $8::jsonb, $9::jsonb, $10, $11, $12, $13, $14)`,
+		e.OrgID, e.ActorID, e.Actor, e.Action, e.EntityType, e.EntityID,
+		nullable(e.Before), nullable(e.After), nullable(e.Changes), e.IP, e.UserAgent, e.CreatedAt, e.PrevHash, e.Hash)
+	return err
+}
+
+// Query selects entries. Zero fields do not filter; OrgID 0 means every
+// organization.
+type Query struct {
+	OrgID      int
+	ActorID    int
+	Action     string
+	EntityType string
+	EntityID   string
+	From, To   time.Time
+	// BeforeID pages back: only entries older than this one.
+	BeforeID int64
+	Limit    int
+}
+
+const entryColumns = `id, org_id, actor_id, actor, action, entity_type, entity_id,
+	before::text, after::text, changes::text, ip, user_agent, created_at, prev_hash, hash`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanEntry(row scanner) (Entry, error) {
+	var e Entry
+	var before, after, changes *string
+	err := row.Scan(&e.ID, &e.OrgID, &e.ActorID, &e.Actor, &e.Action, &e.EntityType, &e.EntityID,
+		&before, &after, &changes, &e.IP, &e.UserAgent, &e.CreatedAt, &e.PrevHash, &e.Hash)
+	if err != nil {
+		return e, err
+	}
+	for _, f := range []struct {
+		src *string
+		dst *json.RawMessage
+	}{{before, &e.Before}, {after, &e.After}, {changes, &e.Changes}} {
+		if f.src != nil {
+			if *f.dst, err = canonical([]byte(*f.src)); err != nil {
+				return e, err
+			}
+		}
+	}
+	return e, nil
+}
+
+// Entries returns the entries matching q, newest first.
+func Entries(ctx context.Context, q Query) ([]Entry, error) {
+	var from, to *time.Time
+	if !q.From.IsZero() {
+		from = &q.From
+	}
+	if !q.To.IsZero() {
+		to = &q.To
+	}
+	var limit *int
+	if q.Limit > 0 {
+		limit = &q.Limit
+	}
+
+	rows, err := database.DBpool.Query(ctx,
+		`SELECT `+entryColumns+` FROM audit_log
+		 WHERE ($1 = 0 OR org_id = $1)
+		   AND ($2 = 0 OR actor_id = $2)
+		   AND ($3 = '' OR action = $3)
+		   AND ($4 = '' OR entity_type = $4)
+		   AND ($5 = '' OR entity_id = $5)
+		   AND ($6::timestamptz IS NULL OR created_at >= $6)
+		   AND ($7::timestamptz IS NULL OR created_at <= $7)
+		   AND ($8 = 0 OR id < $8)
+		 ORDER BY id DESC
+		 LIMIT $9`,
+		q.OrgID, q.ActorID, q.Action, q.EntityType, q.EntityID, from, to, q.BeforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Verification is the result of checking the chain.
+type Verification struct {
+	Checked int64 `json:"checked"`
+	// BrokenAt is the first entry whose hash does not match its content or
+	// the entry before it, or 0 if the chain is intact.
+	BrokenAt int64 `json:"brokenAt"`
+	// Head is the hash of the newest entry. Keeping a copy elsewhere also
+	// reveals entries removed from the end.
+	Head string `json:"head"`
+}
+
+// Verify recomputes the hash of every entry in order.
+func Verify(ctx context.Context) (Verification, error) {
+	var v Verification
+	rows, err := database.DBpool.Query(ctx, "SELECT "+entryColumns+" FROM audit_log ORDER BY id")
+	if err != nil {
+		return v, err
+	}
+	defer rows.Close()
+
+	prev := ""
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return v, err
+		}
+		v.Checked++
+		if v.BrokenAt == 0 && (e.PrevHash != prev || e.digest() != e.Hash) {
+			v.BrokenAt = e.ID
+		}
+		prev = e.Hash
+	}
+	v.Head = prev
+	return v, rows.Err()
+}
@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCanonical(t *testing.T) {
+	a, err := canonical([]byte(`{"b": 1, "a": {"y": [1, 2.0], "x": "s"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// jsonb as Postgres returns it: other key order and spacing
+	b, err := canonical([]byte(`{"a":{"x":"s","y":[1,2]},"b":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(a) != string(b) {
+		t.Errorf("canonical forms differ: %s and %s", a, b)
+	}
+	for _, empty := range []string{"", "null"} {
+		if got, err := canonical([]byte(empty)); got != nil || err != nil {
+			t.Errorf("canonical(%q) = %s, %v; want nil", empty, got, err)
+		}
+	}
+	if _, err := canonical([]byte("{")); err == nil {
+		t.Error("invalid JSON accepted")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before, _ := encode(map[string]interface{}{"name": "A", "active": true, "gone": 1})
+	after, _ := encode(map[string]interface{}{"name": "B", "active": true, "new": "x"})
+	raw, err := diff(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes map[string]Change
+	if err := json.Unmarshal(raw, &changes); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 {
+		t.Errorf("changes = %s, want name, gone and new", raw)
+	}
+	if c := changes["name"]; c.From != "A" || c.To != "B" {
+		t.Errorf("name changed %v", c)
+	}
+	if c := changes["gone"]; c.From != float64(1) || c.To != nil {
+		t.Errorf("gone changed %v", c)
+	}
+	if _, ok := changes["active"]; ok {
+		t.Error("unchanged field listed")
+	}
+
+	// Creations and deletions have no changes
+	if raw, _ := diff(nil, after); raw != nil {
+		t.Errorf("diff of a creation = %s", raw)
+	}
+}
+
+// row is a stored entry as scanEntry reads it.
+type row []interface{}
+
+func (r row) Scan(dest ...interface{}) error {
+	for i, d := range dest {
+		switch d := d.(type) {
+		case *int64:
+			*d = r[i].(int64)
+		case *int:
+			*d = r[i].(int)
+		case **int:
+			*d = r[i].(*int)
+		case *string:
+			*d = r[i].(string)
+		case **string:
+			*d = r[i].(*string)
+		case *time.Time:
+			*d = r[i].(time.Time)
+		}
+	}
+	return nil
+}
+
+func TestDigestSurvivesStorage(t *testing.T) {
+	actor := 3
+	e := Entry{
+		OrgID: 1, ActorID: &actor, Actor: "admin", Action: "user.update",
+		EntityType: "user", EntityID: "7", IP: "10.0.0.1", UserAgent: "test",
+		CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC),
+		PrevHash:  "abc",
+	}
+	e.Before, _ = encode(map[string]interface{}{"role": "user", "name": "Bob"})
+	e.After, _ = encode(map[string]interface{}{"role": "admin", "name": "Bob"})
+	e.Changes, _ = diff(e.Before, e.After)
+	e.Hash = e.digest()
+
+	// Postgres hands jsonb back reformatted and times in the session zone
+	before := `{"name": "Bob", "role": "user"}`
+	after := `{"name": "Bob", "role": "admin"}`
+	changes := `{"role": {"to": "admin", "from": "user"}}`
+	stored, err := scanEntry(row{
+		int64(1), e.OrgID, e.ActorID, e.Actor, e.Action, e.EntityType, e.EntityID,
+		&before, &after, &changes, e.IP, e.UserAgent, e.CreatedAt.In(time.FixedZone("CEST", 2*3600)),
+		e.PrevHash, e.Hash,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stored.digest(); got != e.Hash {
+		t.Errorf("digest after storage = %s, want %s", got, e.Hash)
+	}
+
+	tampered := stored
+	tampered.Actor = "someone else"
+	if tampered.digest() == e.Hash {
+		t.Error("digest did not change with the content")
+	}
+	relinked := stored
+	relinked.PrevHash = "abd"
+	if relinked.digest() == e.Hash {
+		t.Error("digest did not change with the previous hash")
+	}
+}
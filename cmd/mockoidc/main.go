@@ -0,0 +1,42 @@
+// Command mockoidc is an OpenID Connect provider for trying single sign-on
+// locally. Its login page logs in as any username with any groups, without
+// a password. It keeps everything in memory and a new signing key per run.
+//
+//	go run ./cmd/mockoidc -addr localhost:9000
+//
+// and start the service with
+//
+//	OIDC_ISSUER=http://localhost:9000 OIDC_CLIENT_ID=tm \
+//	OIDC_REDIRECT_URL=http://localhost:8000/api/oidc/callback \
+//	OIDC_ROLE_MAP=fleet-admins=admin,staff=user
+//
+// then open http://localhost:8000/api/oidc/login.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"tm/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9000", "listen address")
+	issuer := flag.String("issuer", "", "issuer URL (default http://<addr>)")
+	clientID := flag.String("client-id", "tm", "accepted client ID")
+	clientSecret := flag.String("client-secret", "", "client secret required at the token endpoint, if any")
+	groups := flag.String("groups", "staff", "groups suggested on the login page")
+	flag.Parse()
+
+	if *issuer == "" {
+		*issuer = "http://" + *addr
+	}
+	p, err := oidctest.New(*issuer, *clientID, *clientSecret)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p.Groups = *groups
+
+	log.Printf("Mock OIDC provider %s for client %s listening on %s\n", p.Issuer, p.ClientID, *addr)
+	log.Fatal(http.ListenAndServe(*addr, p.Handler()))
+}
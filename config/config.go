@@ -0,0 +1,679 @@
+// Package config loads the service configuration from an optional YAML file
+// and environment variables, which take precedence over the file.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Database struct {
+	DSN      string `yaml:"dsn" json:"dsn"`
+	MaxConns int32  `yaml:"max_conns" json:"maxConns"`
+	MinConns int32  `yaml:"min_conns" json:"minConns"`
+}
+
+// Server sets where the API listens. Behind a load balancer or reverse proxy,
+// requests coming from one of TrustedProxies (addresses or CIDR ranges) are
+// attributed to the client address the proxy puts in ProxyHeader. The header
+// must hold that address alone, like X-Real-IP set by nginx: the first entry
+// of X-Forwarded-For is whatever the client sent.
+type Server struct {
+	ListenAddr     string   `yaml:"listen_addr" json:"listenAddr"`
+	CORSOrigins    []string `yaml:"cors_origins" json:"corsOrigins"`
+	TrustedProxies []string `yaml:"trusted_proxies" json:"trustedProxies"`
+	ProxyHeader    string   `yaml:"proxy_header" json:"proxyHeader"`
+}
+
+type JWT struct {
+	Secret     string        `yaml:"secret" json:"secret"`
+	AccessTTL  time.Duration `yaml:"access_ttl" json:"accessTTL"`
+	RefreshTTL time.Duration `yaml:"refresh_ttl" json:"refreshTTL"`
+}
+
+// MarshalJSON writes the TTLs as duration strings such as "72h0m0s".
+func (j JWT) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"secret":     j.Secret,
+		"accessTTL":  j.AccessTTL.String(),
+		"refreshTTL": j.RefreshTTL.String(),
+	})
+}
+
+// Login throttles password guessing. After FreeAttempts failures each further
+// attempt has to wait BaseDelay, doubling up to MaxDelay; reaching the max
+// failures locks the username or IP for Lockout. Failures older than Window
+// are forgotten. Accounts with two-factor authentication get a pre-auth
+// token valid for PreAuthTTL to send their code with; TOTPIssuer names the
+// service in authenticator apps. Failed logins are kept for review for
+// FailureRetention.
+type Login struct {
+	Store           string        `yaml:"store" json:"store"` // postgres or memory
+	FreeAttempts    int           `yaml:"free_attempts" json:"freeAttempts"`
+	MaxUserFailures int           `yaml:"max_user_failures" json:"maxUserFailures"`
+	MaxIPFailures   int           `yaml:"max_ip_failures" json:"maxIPFailures"`
+	Window          time.Duration `yaml:"window" json:"window"`
+	Lockout         time.Duration `yaml:"lockout" json:"lockout"`
+	BaseDelay       time.Duration `yaml:"base_delay" json:"baseDelay"`
+	MaxDelay        time.Duration `yaml:"max_delay" json:"maxDelay"`
+	PreAuthTTL      time.Duration `yaml:"pre_auth_ttl" json:"preAuthTTL"`
+	TOTPIssuer      string        `yaml:"totp_issuer" json:"totpIssuer"`
+
+	FailureRetention time.Duration `yaml:"failure_retention" json:"failureRetention"`
+}
+
+// MarshalJSON writes the durations as duration strings such as "15m0s".
+func (l Login) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"store":           l.Store,
+		"freeAttempts":    l.FreeAttempts,
+		"maxUserFailures": l.MaxUserFailures,
+		"maxIPFailures":   l.MaxIPFailures,
+		"window":          l.Window.String(),
+		"lockout":         l.Lockout.String(),
+		"baseDelay":       l.BaseDelay.String(),
+		"maxDelay":        l.MaxDelay.String(),
+		"preAuthTTL":      l.PreAuthTTL.String(),
+		"totpIssuer":      l.TOTPIssuer,
+
+		"failureRetention": l.FailureRetention.String(),
+	})
+}
+
+// Password is the policy for new passwords and the reset flow.
+// BreachedList names a file of refused passwords, one per line, either plain
+// or as SHA-1 hex as in the Have I Been Pwned lists (":count" is ignored).
+// The last History passwords of a user cannot be used again. Reset links are
+// ResetURL with "?token=..." appended, valid for ResetTTL.
+type Password struct {
+	MinLength    int           `yaml:"min_length" json:"minLength"`
+	BreachedList string        `yaml:"breached_list" json:"breachedList"`
+	History      int           `yaml:"history" json:"history"`
+	ResetTTL     time.Duration `yaml:"reset_ttl" json:"resetTTL"`
+	ResetURL     string        `yaml:"reset_url" json:"resetURL"`
+}
+
+// MarshalJSON writes the reset TTL as a duration string such as "30m0s".
+func (p Password) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"minLength":    p.MinLength,
+		"breachedList": p.BreachedList,
+		"history":      p.History,
+		"resetTTL":     p.ResetTTL.String(),
+		"resetURL":     p.ResetURL,
+	})
+}
+
+type SMTP struct {
+	Host     string `yaml:"host" json:"host"`
+	Port     int    `yaml:"port" json:"port"`
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+	From     string `yaml:"from" json:"from"`
+}
+
+// Notify says how messages reach users. Email goes through SMTP once a host
+// is set and SMS is posted to an HTTP gateway once SMSWebhook is set; until
+// then messages are only written to the log.
+type Notify struct {
+	SMTP       SMTP   `yaml:"smtp" json:"smtp"`
+	SMSWebhook string `yaml:"sms_webhook" json:"smsWebhook"`
+}
+
+// OIDC enables single sign-on with an OpenID Connect provider once Issuer is
+// set. RedirectURL is /api/oidc/callback of this service as browsers reach
+// it. After logging in the browser is sent to PostLoginURL with the session
+// cookies set, or gets the tokens as JSON if it is empty. The role comes from
+// the first value of RoleClaim in the ID token that RoleMap knows, else
+// DefaultRole; a user without either cannot log in. With Provision, unknown
+// users are created in organization OrgID on their first login. Users who
+// have or need two-factor authentication here still enter their code unless
+// the amr or acr claim of the ID token has one of MFAValues, showing the
+// provider checked a second factor itself.
+type OIDC struct {
+	Issuer        string            `yaml:"issuer" json:"issuer"`
+	ClientID      string            `yaml:"client_id" json:"clientId"`
+	ClientSecret  string            `yaml:"client_secret" json:"clientSecret"`
+	RedirectURL   string            `yaml:"redirect_url" json:"redirectURL"`
+	PostLoginURL  string            `yaml:"post_login_url" json:"postLoginURL"`
+	Scopes        []string          `yaml:"scopes" json:"scopes"`
+	UsernameClaim string            `yaml:"username_claim" json:"usernameClaim"`
+	RoleClaim     string            `yaml:"role_claim" json:"roleClaim"`
+	RoleMap       map[string]string `yaml:"role_map" json:"roleMap"`
+	DefaultRole   string            `yaml:"default_role" json:"defaultRole"`
+	Provision     bool              `yaml:"provision" json:"provision"`
+	OrgID         int               `yaml:"org_id" json:"orgId"`
+	MFAValues     []string          `yaml:"mfa_values" json:"mfaValues"`
+}
+
+type Geocoder struct {
+	Cities    string `yaml:"cities" json:"cities"`
+	Regions   string `yaml:"regions" json:"regions"`
+	Countries string `yaml:"countries" json:"countries"`
+	Roads     string `yaml:"roads" json:"roads"`
+}
+
+type Locations struct {
+	FullResolutionDays int `yaml:"full_resolution_days" json:"fullResolutionDays"`
+	DownsampleMinutes  int `yaml:"downsample_minutes" json:"downsampleMinutes"`
+	RetentionDays      int `yaml:"retention_days" json:"retentionDays"` // 0 keeps history forever
+	PremakeMonths      int `yaml:"premake_months" json:"premakeMonths"`
+}
+
+type S3 struct {
+	Endpoint  string `yaml:"endpoint" json:"endpoint"`
+	Region    string `yaml:"region" json:"region"`
+	Bucket    string `yaml:"bucket" json:"bucket"`
+	AccessKey string `yaml:"access_key" json:"accessKey"`
+	SecretKey string `yaml:"secret_key" json:"secretKey"`
+}
+
+type Archive struct {
+	HotDays int    `yaml:"hot_days" json:"hotDays"` // 0 disables archiving
+	Dir     string `yaml:"dir" json:"dir"`
+	S3      S3     `yaml:"s3" json:"s3"`
+}
+
+// BodyLimitMB is the size limit of request bodies, fiber's default. Scans
+// are uploaded in the body, so MaxFileMB must leave room for the form
+// around them.
+const BodyLimitMB = 4
+
+// Documents says where the scans of driver documents are kept and how big
+// they may be. Expiry alerts go out AlertDays days before a document expires,
+// and drivers without a valid document of every Required type are not
+// allowed to drive.
+type Documents struct {
+	Dir       string   `yaml:"dir" json:"dir"`
+	MaxFileMB int      `yaml:"max_file_mb" json:"maxFileMb"`
+	AlertDays []int    `yaml:"alert_days" json:"alertDays"`
+	Required  []string `yaml:"required" json:"required"`
+}
+
+// Config is the complete service configuration.
+type Config struct {
+	Database  Database  `yaml:"database" json:"database"`
+	Server    Server    `yaml:"server" json:"server"`
+	JWT       JWT       `yaml:"jwt" json:"jwt"`
+	Login     Login     `yaml:"login" json:"login"`
+	Password  Password  `yaml:"password" json:"password"`
+	Notify    Notify    `yaml:"notify" json:"notify"`
+	OIDC      OIDC      `yaml:"oidc" json:"oidc"`
+	Geocoder  Geocoder  `yaml:"geocoder" json:"geocoder"`
+	Locations Locations `yaml:"locations" json:"locations"`
+	Archive   Archive   `yaml:"archive" json:"archive"`
+	Documents Documents `yaml:"documents" json:"documents"`
+	// Protocols maps device protocol names to the TCP port they listen on.
+	Protocols map[string]int `yaml:"protocols" json:"protocols"`
+}
+
+// C is the configuration in effect, set by Load.
+var C Config
+
+func defaults() Config {
+	return Config{
+		Database: Database{MaxConns: 10, MinConns: 0},
+		Server:   Server{ListenAddr: "0.0.0.0:8000", CORSOrigins: []string{"*"}, ProxyHeader: "X-Real-IP"},
+		JWT:      JWT{AccessTTL: 15 * time.Minute, RefreshTTL: 7 * 24 * time.Hour},
+		Login: Login{
+			Store:           "postgres",
+			FreeAttempts:    2,
+			MaxUserFailures: 5,
+			MaxIPFailures:   50,
+			Window:          15 * time.Minute,
+			Lockout:         15 * time.Minute,
+			BaseDelay:       time.Second,
+			MaxDelay:        30 * time.Second,
+			PreAuthTTL:      5 * time.Minute,
+			TOTPIssuer:      "TM",
+
+			FailureRetention: 90 * 24 * time.Hour,
+		},
+		Password: Password{MinLength: 8, History: 5, ResetTTL: 30 * time.Minute},
+		Notify:   Notify{SMTP: SMTP{Port: 587}},
+		OIDC: OIDC{
+			Scopes:        []string{"openid", "profile", "email"},
+			UsernameClaim: "preferred_username",
+			RoleClaim:     "groups",
+			Provision:     true,
+			OrgID:         1,
+			MFAValues:     []string{"mfa"},
+		},
+		Locations: Locations{
+			FullResolutionDays: 90,
+			DownsampleMinutes:  5,
+			PremakeMonths:      3,
+		},
+		Archive: Archive{Dir: "archive"},
+		Documents: Documents{
+			Dir:       "driver_documents",
+			MaxFileMB: 3,
+			AlertDays: []int{30, 14, 3},
+			Required:  []string{"licence"},
+		},
+	}
+}
+
+// Load reads the file named by CONFIG_FILE, if set, applies environment
+// variable overrides and validates the result into C. It exits on any error.
+func Load() {
+	cfg, err := load(os.Getenv("CONFIG_FILE"), os.LookupEnv)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v\n", err)
+	}
+	C = cfg
+}
+
+func load(file string, lookup func(string) (string, bool)) (Config, error) {
+	cfg := defaults()
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return cfg, err
+		}
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil {
+			return cfg, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	e := envReader{lookup: lookup}
+	e.str("DATABASE_URL", &cfg.Database.DSN)
+	e.int32("DB_MAX_CONNS", &cfg.Database.MaxConns)
+	e.int32("DB_MIN_CONNS", &cfg.Database.MinConns)
+	e.str("LISTEN_ADDR", &cfg.Server.ListenAddr)
+	e.list("CORS_ORIGINS", &cfg.Server.CORSOrigins)
+	e.list("TRUSTED_PROXIES", &cfg.Server.TrustedProxies)
+	e.str("PROXY_HEADER", &cfg.Server.ProxyHeader)
+	e.str("JWT_SECRET", &cfg.JWT.Secret)
+	e.duration("JWT_ACCESS_TTL", &cfg.JWT.AccessTTL)
+	e.duration("JWT_REFRESH_TTL", &cfg.JWT.RefreshTTL)
+	e.str("LOGIN_STORE", &cfg.Login.Store)
+	e.int("LOGIN_FREE_ATTEMPTS", &cfg.Login.FreeAttempts)
+	e.int("LOGIN_MAX_USER_FAILURES", &cfg.Login.MaxUserFailures)
+	e.int("LOGIN_MAX_IP_FAILURES", &cfg.Login.MaxIPFailures)
+	e.duration("LOGIN_WINDOW", &cfg.Login.Window)
+	e.duration("LOGIN_LOCKOUT", &cfg.Login.Lockout)
+	e.duration("LOGIN_BASE_DELAY", &cfg.Login.BaseDelay)
+	e.duration("LOGIN_MAX_DELAY", &cfg.Login.MaxDelay)
+	e.duration("LOGIN_PRE_AUTH_TTL", &cfg.Login.PreAuthTTL)
+	e.str("LOGIN_TOTP_ISSUER", &cfg.Login.TOTPIssuer)
+	e.duration("LOGIN_FAILURE_RETENTION", &cfg.Login.FailureRetention)
+	e.int("PASSWORD_MIN_LENGTH", &cfg.Password.MinLength)
+	e.str("PASSWORD_BREACHED_LIST", &cfg.Password.BreachedList)
+	e.int("PASSWORD_HISTORY", &cfg.Password.History)
+	e.duration("PASSWORD_RESET_TTL", &cfg.Password.ResetTTL)
+	e.str("PASSWORD_RESET_URL", &cfg.Password.ResetURL)
+	e.str("NOTIFY_SMTP_HOST", &cfg.Notify.SMTP.Host)
+	e.int("NOTIFY_SMTP_PORT", &cfg.Notify.SMTP.Port)
+	e.str("NOTIFY_SMTP_USERNAME", &cfg.Notify.SMTP.Username)
+	e.str("NOTIFY_SMTP_PASSWORD", &cfg.Notify.SMTP.Password)
+	e.str("NOTIFY_SMTP_FROM", &cfg.Notify.SMTP.From)
+	e.str("NOTIFY_SMS_WEBHOOK", &cfg.Notify.SMSWebhook)
+	e.str("OIDC_ISSUER", &cfg.OIDC.Issuer)
+	e.str("OIDC_CLIENT_ID", &cfg.OIDC.ClientID)
+	e.str("OIDC_CLIENT_SECRET", &cfg.OIDC.ClientSecret)
+	e.str("OIDC_REDIRECT_URL", &cfg.OIDC.RedirectURL)
+	e.str("OIDC_POST_LOGIN_URL", &cfg.OIDC.PostLoginURL)
+	e.list("OIDC_SCOPES", &cfg.OIDC.Scopes)
+	e.str("OIDC_USERNAME_CLAIM", &cfg.OIDC.UsernameClaim)
+	e.str("OIDC_ROLE_CLAIM", &cfg.OIDC.RoleClaim)
+	e.pairs("OIDC_ROLE_MAP", &cfg.OIDC.RoleMap)
+	e.str("OIDC_DEFAULT_ROLE", &cfg.OIDC.DefaultRole)
+	e.bool("OIDC_PROVISION", &cfg.OIDC.Provision)
+	e.int("OIDC_ORG_ID", &cfg.OIDC.OrgID)
+	e.list("OIDC_MFA_VALUES", &cfg.OIDC.MFAValues)
+	e.str("GEOCODER_CITIES", &cfg.Geocoder.Cities)
+	e.str("GEOCODER_REGIONS", &cfg.Geocoder.Regions)
+	e.str("GEOCODER_COUNTRIES", &cfg.Geocoder.Countries)
+	e.str("GEOCODER_ROADS", &cfg.Geocoder.Roads)
+	e.int("LOCATION_FULL_RESOLUTION_DAYS", &cfg.Locations.FullResolutionDays)
+	e.int("LOCATION_DOWNSAMPLE_MINUTES", &cfg.Locations.DownsampleMinutes)
+	e.int("LOCATION_RETENTION_DAYS", &cfg.Locations.RetentionDays)
+	e.int("LOCATION_PREMAKE_MONTHS", &cfg.Locations.PremakeMonths)
+	e.int("ARCHIVE_HOT_DAYS", &cfg.Archive.HotDays)
+	e.str("ARCHIVE_DIR", &cfg.Archive.Dir)
+	e.str("ARCHIVE_S3_ENDPOINT", &cfg.Archive.S3.Endpoint)
+	e.str("ARCHIVE_S3_REGION", &cfg.Archive.S3.Region)
+	e.str("ARCHIVE_S3_BUCKET", &cfg.Archive.S3.Bucket)
+	e.str("ARCHIVE_S3_ACCESS_KEY", &cfg.Archive.S3.AccessKey)
+	e.str("ARCHIVE_S3_SECRET_KEY", &cfg.Archive.S3.SecretKey)
+	e.str("DOCUMENTS_DIR", &cfg.Documents.Dir)
+	e.int("DOCUMENTS_MAX_FILE_MB", &cfg.Documents.MaxFileMB)
+	e.ints("DOCUMENTS_ALERT_DAYS", &cfg.Documents.AlertDays)
+	e.list("DOCUMENTS_REQUIRED", &cfg.Documents.Required)
+	e.ports("PROTOCOL_PORTS", &cfg.Protocols)
+	if e.err != nil {
+		return cfg, e.err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate reports the first problem found in the configuration.
+func (c Config) Validate() error {
+	if c.Database.DSN == "" {
+		return fmt.Errorf("database DSN is required (DATABASE_URL)")
+	}
+	if _, err := url.Parse(c.Database.DSN); err != nil {
+		return fmt.Errorf("database DSN: %w", err)
+	}
+	if c.Database.MaxConns < 1 || c.Database.MinConns < 0 || c.Database.MinConns > c.Database.MaxConns {
+		return fmt.Errorf("database pool sizes must satisfy 0 <= min_conns <= max_conns and max_conns >= 1")
+	}
+	if c.Server.ListenAddr == "" {
+		return fmt.Errorf("listen address is required (LISTEN_ADDR)")
+	}
+	if len(c.Server.CORSOrigins) == 0 {
+		return fmt.Errorf("at least one CORS origin is required (CORS_ORIGINS)")
+	}
+	for _, p := range c.Server.TrustedProxies {
+		if net.ParseIP(p) == nil {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				return fmt.Errorf("trusted proxy %q is not an IP address or CIDR range (TRUSTED_PROXIES)", p)
+			}
+		}
+	}
+	if len(c.Server.TrustedProxies) > 0 && c.Server.ProxyHeader == "" {
+		return fmt.Errorf("a proxy header is required with trusted proxies (PROXY_HEADER)")
+	}
+	if len(c.JWT.Secret) < 32 {
+		return fmt.Errorf("JWT secret must be at least 32 characters (JWT_SECRET)")
+	}
+	if c.JWT.AccessTTL <= 0 || c.JWT.RefreshTTL < c.JWT.AccessTTL {
+		return fmt.Errorf("JWT access TTL must be positive and not longer than the refresh TTL")
+	}
+	if c.Login.Store != "postgres" && c.Login.Store != "memory" {
+		return fmt.Errorf("login store must be postgres or memory (LOGIN_STORE)")
+	}
+	if c.Login.FreeAttempts < 0 || c.Login.MaxUserFailures <= c.Login.FreeAttempts || c.Login.MaxIPFailures <= c.Login.FreeAttempts {
+		return fmt.Errorf("login max failures must be greater than free_attempts")
+	}
+	if c.Login.Window <= 0 || c.Login.Lockout <= 0 || c.Login.BaseDelay < 0 || c.Login.MaxDelay < c.Login.BaseDelay {
+		return fmt.Errorf("login window and lockout must be positive and max_delay not shorter than base_delay")
+	}
+	if c.Login.PreAuthTTL <= 0 || c.Login.TOTPIssuer == "" {
+		return fmt.Errorf("login pre_auth_ttl must be positive and totp_issuer not empty")
+	}
+	if c.Login.FailureRetention < c.Login.Window {
+		return fmt.Errorf("login failure_retention must not be shorter than the window (LOGIN_FAILURE_RETENTION)")
+	}
+	if c.Password.MinLength < 1 || c.Password.History < 0 || c.Password.ResetTTL <= 0 {
+		return fmt.Errorf("password min_length and reset_ttl must be positive and history not negative")
+	}
+	if c.Notify.SMTP.Host != "" && (c.Notify.SMTP.Port < 1 || c.Notify.SMTP.Port > 65535 || c.Notify.SMTP.From == "") {
+		return fmt.Errorf("notify smtp needs a port between 1 and 65535 and a from address")
+	}
+	if c.OIDC.Issuer != "" {
+		if u, err := url.Parse(c.OIDC.Issuer); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("oidc issuer must be an absolute URL (OIDC_ISSUER)")
+		}
+		if c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "" {
+			return fmt.Errorf("oidc needs a client_id and a redirect_url")
+		}
+		openid := false
+		for _, s := range c.OIDC.Scopes {
+			openid = openid || s == "openid"
+		}
+		if !openid || c.OIDC.UsernameClaim == "" || c.OIDC.OrgID < 1 {
+			return fmt.Errorf("oidc scopes must include openid, username_claim must be set and org_id must be positive")
+		}
+	}
+	if c.Locations.FullResolutionDays < 0 || c.Locations.DownsampleMinutes <= 0 || c.Locations.RetentionDays < 0 || c.Locations.PremakeMonths < 0 {
+		return fmt.Errorf("location retention settings must not be negative and downsample_minutes must be positive")
+	}
+	if c.Locations.RetentionDays > 0 && c.Locations.RetentionDays < c.Locations.FullResolutionDays {
+		return fmt.Errorf("location retention_days must not be shorter than full_resolution_days")
+	}
+	if c.Archive.HotDays < 0 {
+		return fmt.Errorf("archive hot_days must not be negative")
+	}
+	if c.Archive.HotDays > 0 && c.Locations.RetentionDays > 0 && c.Locations.RetentionDays < c.Archive.HotDays {
+		return fmt.Errorf("location retention_days must not be shorter than archive hot_days, or partitions are dropped before they are archived")
+	}
+	if c.Archive.HotDays > 0 && c.Archive.S3.Endpoint != "" && (c.Archive.S3.Bucket == "" || c.Archive.S3.Region == "") {
+		return fmt.Errorf("archive S3 storage needs a bucket and a region")
+	}
+	if c.Documents.Dir == "" || c.Documents.MaxFileMB < 1 || c.Documents.MaxFileMB >= BodyLimitMB {
+		return fmt.Errorf("documents need a dir and max_file_mb between 1 and %d (DOCUMENTS_MAX_FILE_MB)", BodyLimitMB-1)
+	}
+	for _, days := range c.Documents.AlertDays {
+		if days < 1 || days > 365 {
+			return fmt.Errorf("documents alert_days must be between 1 and 365, got %d", days)
+		}
+	}
+	seen := make(map[int]string)
+	for name, port := range c.Protocols {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("protocol %s: port %d is out of range", name, port)
+		}
+		if other, ok := seen[port]; ok {
+			return fmt.Errorf("protocols %s and %s both use port %d", other, name, port)
+		}
+		seen[port] = name
+	}
+	return nil
+}
+
+const redacted = "********"
+
+// dsnPassword matches the password settings of a keyword/value DSN, with
+// the value quoted or not.
+var dsnPassword = regexp.MustCompile(`(?i)\b(password|sslpassword)\s*=\s*('(?:[^'\\]|\\.)*'|\S*)`)
+
+// redactDSN masks the passwords of a database DSN, given as a URL or as
+// keyword/value pairs.
+func redactDSN(dsn string) string {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsnPassword.ReplaceAllString(dsn, "$1="+redacted)
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return redacted
+	}
+	u.RawQuery = redactQuery(u.RawQuery, func(key string) bool {
+		return strings.EqualFold(key, "password") || strings.EqualFold(key, "sslpassword")
+	})
+	return u.Redacted()
+}
+
+// redactURL masks the password and all query values of a URL, as gateways
+// often take their token in the query string.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return redacted
+	}
+	u.RawQuery = redactQuery(u.RawQuery, func(string) bool { return true })
+	u.Fragment = ""
+	return u.Redacted()
+}
+
+// redactQuery masks the values of the parameters of a raw query string
+// that secret reports true for, keeping the rest as they are.
+func redactQuery(raw string, secret func(key string) bool) string {
+	params := strings.Split(raw, "&")
+	for i, p := range params {
+		rawKey, _, found := strings.Cut(p, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			key = rawKey
+		}
+		if found && secret(key) {
+			params[i] = rawKey + "=" + redacted
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// Redacted returns a copy of the configuration that is safe to show: secrets
+// are masked and passwords and tokens are removed from the database DSN and
+// the SMS webhook URL.
+func (c Config) Redacted() Config {
+	c.Database.DSN = redactDSN(c.Database.DSN)
+	if c.JWT.Secret != "" {
+		c.JWT.Secret = redacted
+	}
+	if c.Archive.S3.SecretKey != "" {
+		c.Archive.S3.SecretKey = redacted
+	}
+	if c.Notify.SMTP.Password != "" {
+		c.Notify.SMTP.Password = redacted
+	}
+	if c.Notify.SMSWebhook != "" {
+		c.Notify.SMSWebhook = redactURL(c.Notify.SMSWebhook)
+	}
+	if c.OIDC.ClientSecret != "" {
+		c.OIDC.ClientSecret = redacted
+	}
+	return c
+}
+
+// envReader applies environment overrides, keeping the first parse error.
+type envReader struct {
+	lookup func(string) (string, bool)
+	err    error
+}
+
+func (e *envReader) get(name string) (string, bool) {
+	v, ok := e.lookup(name)
+	return v, ok && e.err == nil
+}
+
+func (e *envReader) fail(name, v, want string) {
+	e.err = fmt.Errorf("%s must be %s, got %q", name, want, v)
+}
+
+func (e *envReader) str(name string, dst *string) {
+	if v, ok := e.get(name); ok {
+		*dst = v
+	}
+}
+
+func (e *envReader) int(name string, dst *int) {
+	if v, ok := e.get(name); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			e.fail(name, v, "an integer")
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envReader) int32(name string, dst *int32) {
+	if v, ok := e.get(name); ok {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			e.fail(name, v, "an integer")
+			return
+		}
+		*dst = int32(n)
+	}
+}
+
+func (e *envReader) duration(name string, dst *time.Duration) {
+	if v, ok := e.get(name); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			e.fail(name, v, "a duration such as 15m or 72h")
+			return
+		}
+		*dst = d
+	}
+}
+
+func (e *envReader) list(name string, dst *[]string) {
+	if v, ok := e.get(name); ok {
+		var items []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*dst = items
+	}
+}
+
+func (e *envReader) ints(name string, dst *[]int) {
+	if v, ok := e.get(name); ok {
+		var items []int
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			n, err := strconv.Atoi(item)
+			if err != nil {
+				e.fail(name, v, "a comma separated list of integers")
+				return
+			}
+			items = append(items, n)
+		}
+		*dst = items
+	}
+}
+
+func (e *envReader) bool(name string, dst *bool) {
+	if v, ok := e.get(name); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			e.fail(name, v, "true or false")
+			return
+		}
+		*dst = b
+	}
+}
+
+// pairs parses "key=value" pairs separated by commas, e.g. "fleet-admins=admin,staff=user".
+func (e *envReader) pairs(name string, dst *map[string]string) {
+	v, ok := e.get(name)
+	if !ok {
+		return
+	}
+	m := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, value, found := strings.Cut(pair, "=")
+		if !found || key == "" || value == "" {
+			e.fail(name, v, "a comma separated list of key=value pairs")
+			return
+		}
+		m[key] = value
+	}
+	*dst = m
+}
+
+// ports parses "name=port" pairs separated by commas, e.g. "gt06=5023,teltonika=5027".
+func (e *envReader) ports(name string, dst *map[string]int) {
+	v, ok := e.get(name)
+	if !ok {
+		return
+	}
+	ports := make(map[string]int)
+	for _, pair := range strings.Split(v, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		proto, port, found := strings.Cut(pair, "=")
+		n, err := strconv.Atoi(port)
+		if !found || proto == "" || err != nil {
+			e.fail(name, v, "a comma separated list of protocol=port pairs")
+			return
+		}
+		ports[proto] = n
+	}
+	*dst = ports
+}
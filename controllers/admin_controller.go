@@ -2,18 +2,20 @@ package controllers
 
 import (
 	"context"
-	"time"
+	"log"
+	"net/mail"
+	"regexp"
+	"strconv"
 	"tm/database"
+	"tm/loginguard"
 	"tm/models"
+	"tm/rbac"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/jackc/pgx/v4"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtSecret = []byte("your_secret_key")
-
 type LoginInput struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -29,8 +31,50 @@ func checkPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
+// canGrantRole reports whether the caller may give a role to a user, or act
+// on a user who has it: only if the caller's role has every permission of it.
+func canGrantRole(c *fiber.Ctx, role string) bool {
+	return rbac.Covers(roleOf(c), role)
+}
+
+// lockAdmins locks the active users of an organization whose role can manage
+// users, so that two admins cannot remove each other at once, and returns
+// their ids.
+func lockAdmins(ctx context.Context, tx pgx.Tx, orgId int) ([]int, error) {
+	rows, err := tx.Query(ctx,
+		`SELECT id FROM users
+		 WHERE org_id = $1 AND active AND role IN (SELECT role FROM role_permissions WHERE permission = $2)
+		 ORDER BY id FOR UPDATE`, orgId, rbac.UserManage)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var admins []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		admins = append(admins, id)
+	}
+	return admins, rows.Err()
+}
+
+// removesLastAdmin reports whether taking the user id from admins would leave
+// none.
+func removesLastAdmin(admins []int, id int) bool {
+	return len(admins) == 1 && admins[0] == id
+}
+
+// dropsAdmin reports whether an update may take the user out of the admins,
+// by giving them a role that cannot manage users or deactivating them.
+func dropsAdmin(input *models.UpdateUserRequest) bool {
+	return (input.Role != nil && !rbac.Can(*input.Role, rbac.UserManage)) || (input.Active != nil && !*input.Active)
+}
+
 // @Summary Login
-// @Description Login
+// @Description Login. Users with two-factor authentication, or whose role requires it, get a pre-auth token instead ("two_factor" is "2fa" or "2fa_setup") to finish the login at /api/login/2fa.
 // @Tags User
 // @Accept json
 // @Produce json
@@ -38,6 +82,8 @@ func checkPasswordHash(password, hash string) bool {
 // @Success 200 {object} map[string]interface{} "token"
 // @Failure 400 {object} map[string]interface{} "Bad request"
 // @Failure 401 {object} map[string]interface{} "Invalid username or password"
+// @Failure 403 {object} map[string]interface{} "Account is disabled"
+// @Failure 429 {object} map[string]interface{} "Too many failed logins"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/login [post]
 func Login(c *fiber.Ctx) error {
@@ -46,65 +92,151 @@ func Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
 	}
 
-	var user models.User
-	err := database.DBpool.QueryRow(context.Background(), "SELECT id, username, password, role FROM users WHERE username=$1", input.Username).Scan(&user.Id, &user.Username, &user.Password, &user.Role)
+	ctx := context.Background()
+	guard := loginguard.Default
+	attempt, err := guard.Begin(ctx, input.Username, c.IP())
 	if err != nil {
+		return tooManyAttempts(c, err)
+	}
+	failed := func(reason string, orgId *int) error {
+		err := attempt.Failed(ctx, loginguard.Failure{
+			Username:  input.Username,
+			IP:        c.IP(),
+			UserAgent: c.Get(fiber.HeaderUserAgent),
+			Reason:    reason,
+			OrgID:     orgId,
+		})
+		if err != nil {
+			log.Println("Error recording failed login:", err)
+		}
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid username or password"})
 	}
 
+	var user models.User
+	var active, enabled2FA, required2FA bool
+	err = database.DBpool.QueryRow(ctx,
+		`SELECT u.id, u.username, u.password, u.role, u.org_id, u.active, u.totp_enabled, r.require_2fa
+		 FROM users u JOIN roles r ON r.name = u.role
+		 WHERE u.username=$1`, input.Username,
+	).Scan(&user.Id, &user.Username, &user.Password, &user.Role, &user.OrgId, &active, &enabled2FA, &required2FA)
+	if err == pgx.ErrNoRows {
+		return failed(loginguard.ReasonUnknownUser, nil)
+	}
+	if err != nil {
+		if err := attempt.Cancel(ctx); err != nil {
+			log.Println("Error releasing login attempt:", err)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to look up user"})
+	}
+
 	if !checkPasswordHash(input.Password, user.Password) {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid username or password"})
+		return failed(loginguard.ReasonBadPassword, &user.OrgId)
+	}
+	if err := attempt.Passed(ctx); err != nil {
+		log.Println("Error releasing login attempt:", err)
+	}
+	if !active {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Account is disabled"})
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":       user.Id,
-		"username": user.Username,
-		"role":     user.Role,
-		"exp":      time.Now().Add(time.Hour * 72).Unix(),
-	})
+	// The failures are only forgotten once the second factor is passed too,
+	// so a known password does not give unlimited code guesses.
+	if enabled2FA {
+		return issuePreAuthToken(c, user, preAuthCode)
+	}
+	if required2FA {
+		return issuePreAuthToken(c, user, preAuthSetup)
+	}
 
-	tokenString, err := token.SignedString(jwtSecret)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	return startSession(c, user, nil)
+}
+
+// userColumns are the columns of users u that make a models.UserResponse,
+// in the order scanUser reads them.
+const userColumns = `u.id, u.username, u.role, u.org_id, u.full_name, u.email, u.phone,
+	u.active, u.totp_enabled, u.created_at, u.last_login_at`
+
+func scanUser(row pgx.Row) (models.UserResponse, error) {
+	var u models.UserResponse
+	err := row.Scan(&u.Id, &u.Username, &u.Role, &u.OrgId, &u.FullName, &u.Email, &u.Phone,
+		&u.Active, &u.TwoFactor, &u.CreatedAt, &u.LastLoginAt)
+	return u, err
+}
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 ()-]{5,19}$`)
+
+// checkContact returns an error message if an email address or phone number
+// that is set is malformed. Empty ones are allowed and clear the field.
+func checkContact(email, phone *string) string {
+	if email != nil && *email != "" {
+		if a, err := mail.ParseAddress(*email); err != nil || a.Address != *email {
+			return "invalid email address"
+		}
 	}
+	if phone != nil && *phone != "" && !phonePattern.MatchString(*phone) {
+		return "invalid phone number"
+	}
+	return ""
+}
 
-	c.Cookie(&fiber.Cookie{
-		Name:     "jwt",
-		Value:    tokenString,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HTTPOnly: true,
-		Secure:   false,
-	})
+// checkRole returns an error response if the caller may not give a role.
+func checkRole(c *fiber.Ctx, role string) (bool, error) {
+	var exists bool
+	err := database.DBpool.QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM roles WHERE name=$1)", role).Scan(&exists)
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error", "message": err.Error()})
+	}
+	if !exists {
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown role " + role})
+	}
+	if !canGrantRole(c, role) {
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not allowed to grant role " + role})
+	}
+	return true, nil
+}
 
-	return c.JSON(fiber.Map{"token": tokenString, "Rule": user.Role})
+// checkTarget returns an error response if a user is not in the caller's
+// organization, or has a role with a permission the caller lacks.
+func checkTarget(c *fiber.Ctx, id int) (bool, error) {
+	var role string
+	err := database.DBpool.QueryRow(context.Background(), "SELECT role FROM users WHERE id=$1 AND org_id=$2", id, orgOf(c)).Scan(&role)
+	if err == pgx.ErrNoRows {
+		return false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	if !canGrantRole(c, role) {
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not allowed to manage a user with role " + role})
+	}
+	return true, nil
 }
 
 // @Summary Get All Users
-// @Description Retrieve all users
+// @Description Retrieve all users of the organization
 // @Tags Admin
 // @Produce json
-// @Success 200 {array} models.User
+// @Success 200 {array} models.UserResponse
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/admin/allusers [get]
 func GetAllUser(c *fiber.Ctx) error {
-	rows, err := database.DBpool.Query(context.Background(), "SELECT id, username, password, role FROM users")
+	rows, err := database.DBpool.Query(context.Background(), "SELECT "+userColumns+" FROM users u WHERE u.org_id=$1 ORDER BY u.id", orgOf(c))
 	if err != nil {
-		return c.Status(500).SendString(err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving users"})
 	}
 	defer rows.Close()
 
-	var users []models.User
+	users := []models.UserResponse{}
 	for rows.Next() {
-		var user models.User
-		err := rows.Scan(&user.Id, &user.Username, &user.Password, &user.Role)
+		user, err := scanUser(rows)
 		if err != nil {
-			return c.Status(500).SendString(err.Error())
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error scanning user"})
 		}
 		users = append(users, user)
 	}
 
 	if err = rows.Err(); err != nil {
-		return c.Status(500).SendString(err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving users"})
 	}
 
 	return c.JSON(fiber.Map{"users": users})
@@ -115,120 +247,283 @@ func GetAllUser(c *fiber.Ctx) error {
 // @Tags Admin
 // @Produce json
 // @Param id path int true "User ID"
-// @Success 200 {object} models.User
+// @Success 200 {object} models.UserResponse
 // @Failure 404 {object} map[string]interface{} "User not found"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/admin/getuser/{id} [get]
 func GetUserById(c *fiber.Ctx) error {
 	id := c.Params("id")
 
-	row := database.DBpool.QueryRow(context.Background(), "SELECT id, username, password, role FROM users WHERE id = $1", id)
-
-	var user models.User
-	err := row.Scan(&user.Id, &user.Username, &user.Password, &user.Role)
+	user, err := scanUser(database.DBpool.QueryRow(context.Background(), "SELECT "+userColumns+" FROM users u WHERE u.id = $1 AND u.org_id = $2", id, orgOf(c)))
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).SendString("User not found")
-		}
-		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving user"})
 	}
 
 	return c.JSON(fiber.Map{"user": user})
 }
 
 // @Summary Create User
-// @Description Create a new user
+// @Description Create a new user in the organization. The role defaults to "user".
 // @Tags Admin
 // @Accept json
 // @Produce json
-// @Param user body models.User true "User"
-// @Success 201 {object} models.User
+// @Param user body models.CreateUserRequest true "User"
+// @Success 201 {object} models.UserResponse
 // @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 403 {object} map[string]interface{} "Role not allowed"
+// @Failure 409 {object} map[string]interface{} "Username taken"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/admin/createuser [post]
 func CreateUser(c *fiber.Ctx) error {
-	user := new(models.User)
-	if err := c.BodyParser(user); err != nil {
-		return c.Status(400).SendString(err.Error())
+	input := new(models.CreateUserRequest)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "message": err.Error()})
 	}
 
-	if user.Username == "" || user.Password == "" {
+	if input.Username == "" || input.Password == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Username and password cannot be empty"})
 	}
-	hashedPassword, err := hashPassword(user.Password)
-	if err != nil {
-		return c.Status(500).SendString("Error hashing password")
+	if msg := checkContact(input.Email, input.Phone); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if input.Role == "" {
+		input.Role = "user"
+	}
+	if ok, resp := checkRole(c, input.Role); !ok {
+		return resp
+	}
+	active := input.Active == nil || *input.Active
+
+	hashedPassword, resp := hashNewPassword(c, 0, input.Username, input.Password)
+	if hashedPassword == "" {
+		return resp
 	}
 
-	err = database.DBpool.QueryRow(context.Background(), "INSERT INTO users (username, password) VALUES ($1, $2) RETURNING id", user.Username, hashedPassword).Scan(&user.Id)
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create user", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	user, err := scanUser(tx.QueryRow(ctx,
+		`INSERT INTO users AS u (username, password, role, org_id, full_name, email, phone, active)
+		 VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8)
+		 ON CONFLICT (username) DO NOTHING
+		 RETURNING `+userColumns,
+		input.Username, hashedPassword, input.Role, orgOf(c), input.FullName, input.Email, input.Phone, active))
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Username is already taken"})
+	}
 	if err != nil {
-		return c.Status(500).SendString(err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create user", "message": err.Error()})
 	}
+	if err := recordAudit(c, tx, "user.create", "user", user.Id, nil, user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create user", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create user", "message": err.Error()})
+	}
+	recordPassword(user.Id, hashedPassword)
 
-	return c.Status(201).JSON(user)
+	return c.Status(fiber.StatusCreated).JSON(user)
 }
 
 // @Summary Update User
-// @Description Update an existing user
+// @Description Change the fields of a user that are set and leave the others, so the password only needs to be sent to change it
 // @Tags Admin
 // @Accept json
 // @Produce json
 // @Param id path int true "User ID"
-// @Param user body models.User true "User"
-// @Success 200 {object} map[string]interface{} "User updated"
+// @Param user body models.UpdateUserRequest true "Changes"
+// @Success 200 {object} models.UserResponse
 // @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 403 {object} map[string]interface{} "Role not allowed, or the user's role has a permission the caller lacks"
 // @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 409 {object} map[string]interface{} "Username taken, or the last admin of the organization would be demoted or deactivated"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/admin/update/{id} [put]
 func UpdateUser(c *fiber.Ctx) error {
-	id := c.Params("id")
-	user := new(models.User)
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+	}
+	input := new(models.UpdateUserRequest)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "message": err.Error()})
+	}
 
-	if err := c.BodyParser(user); err != nil {
-		return c.Status(fiber.StatusBadRequest).SendString("Invalid request body: " + err.Error())
+	ctx := context.Background()
+	orgId := orgOf(c)
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update user", "message": err.Error()})
 	}
+	defer tx.Rollback(ctx)
 
-	if user.Username == "" || user.Password == "" || user.Role == "" {
-		return c.Status(fiber.StatusBadRequest).SendString("Username, password, and role must not be empty")
+	// The admins are locked before the user, in the same order as DeleteUser.
+	if dropsAdmin(input) {
+		admins, err := lockAdmins(ctx, tx, orgId)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update user", "message": err.Error()})
+		}
+		if removesLastAdmin(admins, id) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "The last admin of the organization cannot be demoted or deactivated"})
+		}
 	}
 
-	hashedPassword, err := hashPassword(user.Password)
+	current, err := scanUser(tx.QueryRow(ctx, "SELECT "+userColumns+" FROM users u WHERE u.id = $1 AND u.org_id = $2 FOR UPDATE", id, orgId))
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Error hashing password")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving user"})
+	}
+
+	if !canGrantRole(c, current.Role) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not allowed to manage a user with role " + current.Role})
+	}
+	if input.Username != nil && *input.Username == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Username cannot be empty"})
+	}
+	if msg := checkContact(input.Email, input.Phone); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if input.Role != nil && *input.Role != current.Role {
+		if ok, resp := checkRole(c, *input.Role); !ok {
+			return resp
+		}
+	}
+	if input.Active != nil && !*input.Active && id == userOf(c) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You cannot deactivate your own account"})
+	}
+	if input.Username != nil && *input.Username != current.Username {
+		var taken bool
+		err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE username=$1)", *input.Username).Scan(&taken)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error", "message": err.Error()})
+		}
+		if taken {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Username is already taken"})
+		}
 	}
 
-	commandTag, err := database.DBpool.Exec(context.Background(),
-		"UPDATE users SET username=$1, password=$2, role=$3 WHERE id=$4",
-		user.Username, hashedPassword, user.Role, id)
+	var hashedPassword *string
+	if input.Password != nil {
+		username := current.Username
+		if input.Username != nil {
+			username = *input.Username
+		}
+		hashed, resp := hashNewPassword(c, id, username, *input.Password)
+		if hashed == "" {
+			return resp
+		}
+		hashedPassword = &hashed
+	}
+
+	user, err := scanUser(tx.QueryRow(ctx,
+		`UPDATE users u SET
+		     username  = COALESCE($1, username),
+		     password  = COALESCE($2, password),
+		     role      = COALESCE($3, role),
+		     full_name = COALESCE($4, full_name),
+		     email     = CASE WHEN $5::text IS NULL THEN email ELSE NULLIF($5, '') END,
+		     phone     = CASE WHEN $6::text IS NULL THEN phone ELSE NULLIF($6, '') END,
+		     active    = COALESCE($7, active)
+		 WHERE u.id = $8 AND u.org_id = $9
+		 RETURNING `+userColumns,
+		input.Username, hashedPassword, input.Role, input.FullName, input.Email, input.Phone, input.Active, id, orgId))
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Database error: " + err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update user", "message": err.Error()})
+	}
+	if err := recordAudit(c, tx, "user.update", "user", id, current, user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update user", "message": err.Error()})
+	}
+	if hashedPassword != nil {
+		// The hash is not part of the user, so it would not show in the diff
+		if err := recordAudit(c, tx, "user.set_password", "user", id, nil, nil); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update user", "message": err.Error()})
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update user", "message": err.Error()})
+	}
+	if hashedPassword != nil {
+		recordPassword(id, *hashedPassword)
 	}
 
-	if commandTag.RowsAffected() == 0 {
-		return c.Status(fiber.StatusNotFound).SendString("User not found or no changes were made")
+	// Tokens carry the role, so sessions opened under the old one must go,
+	// as must those of a user who was deactivated or got a new password.
+	if user.Role != current.Role || !user.Active || hashedPassword != nil {
+		revokeUserSessions(id)
 	}
 
-	return c.SendStatus(fiber.StatusOK)
+	return c.JSON(user)
 }
 
 // @Summary Delete User
-// @Description Delete a user by ID
+// @Description Delete a user by ID. Admins cannot delete themselves, and the last active admin of an organization cannot be deleted.
 // @Tags Admin
+// @Produce json
 // @Param id path int true "User ID"
-// @Success 200 {object} map[string]interface{} "User deleted"
+// @Success 200 {object} map[string]interface{} "Deleted successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 403 {object} map[string]interface{} "The user's role has a permission the caller lacks"
 // @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 409 {object} map[string]interface{} "Last admin of the organization"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/admin/delete/{id} [delete]
 func DeleteUser(c *fiber.Ctx) error {
-	id := c.Params("id")
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+	}
+	if id == userOf(c) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You cannot delete your own account"})
+	}
+	if ok, resp := checkTarget(c, id); !ok {
+		return resp
+	}
+
+	ctx := context.Background()
+	orgId := orgOf(c)
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		log.Println("Error deleting user:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete user"})
+	}
+	defer tx.Rollback(ctx)
 
-	commandTag, err := database.DBpool.Exec(context.Background(), "DELETE FROM users WHERE id=$1", id)
+	admins, err := lockAdmins(ctx, tx, orgId)
 	if err != nil {
-		return c.Status(500).SendString(err.Error())
+		log.Println("Error deleting user:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete user"})
+	}
+	if removesLastAdmin(admins, id) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "The last admin of the organization cannot be deleted"})
+	}
+
+	user, err := scanUser(tx.QueryRow(ctx, "DELETE FROM users u WHERE id=$1 AND org_id=$2 RETURNING "+userColumns, id, orgId))
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
-	if commandTag.RowsAffected() == 0 {
-		return c.Status(404).SendString("User not found")
+	if err == nil {
+		err = recordAudit(c, tx, "user.delete", "user", user.Id, user, nil)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		log.Println("Error deleting user:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete user"})
 	}
+	revokeUserSessions(user.Id)
 
-	return c.SendStatus(200)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Deleted successfully"})
 }
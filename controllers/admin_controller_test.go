@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"tm/models"
+	"tm/rbac"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestCanGrantRole(t *testing.T) {
+	rbac.SetGrants(map[string][]string{
+		"superadmin": {rbac.UserManage, rbac.SystemRead, rbac.OrgManage},
+		"admin":      {rbac.UserManage},
+		"user":       {},
+	})
+	defer rbac.SetGrants(nil)
+
+	tests := []struct {
+		caller, target string
+		want           bool
+	}{
+		{"superadmin", "superadmin", true},
+		{"superadmin", "admin", true},
+		{"admin", "user", true},
+		{"admin", "admin", true},
+		{"admin", "superadmin", false},
+		{"user", "admin", false},
+	}
+	for _, tt := range tests {
+		app := fiber.New()
+		var got bool
+		app.Get("/", func(c *fiber.Ctx) error {
+			c.Locals("claims", jwt.MapClaims{"role": tt.caller})
+			got = canGrantRole(c, tt.target)
+			return nil
+		})
+		if _, err := app.Test(httptest.NewRequest("GET", "/", nil)); err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s acting on %s: canGrantRole = %v, want %v", tt.caller, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestDeleteUserRefusesSelf(t *testing.T) {
+	app := fiber.New()
+	app.Delete("/:id", func(c *fiber.Ctx) error {
+		c.Locals("claims", jwt.MapClaims{"id": float64(7), "org": float64(1), "role": "admin"})
+		return c.Next()
+	}, DeleteUser)
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodDelete, "/7", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("deleting oneself: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestLastAdminIsKept(t *testing.T) {
+	rbac.SetGrants(map[string][]string{
+		"admin":   {rbac.UserManage},
+		"manager": {rbac.UserManage},
+		"user":    {},
+	})
+	defer rbac.SetGrants(nil)
+
+	str := func(s string) *string { return &s }
+	active := func(a bool) *bool { return &a }
+	tests := []struct {
+		name   string
+		input  models.UpdateUserRequest
+		admins []int
+		refuse bool
+	}{
+		{"demote last admin", models.UpdateUserRequest{Role: str("user")}, []int{7}, true},
+		{"deactivate last admin", models.UpdateUserRequest{Active: active(false)}, []int{7}, true},
+		{"demote one of two admins", models.UpdateUserRequest{Role: str("user")}, []int{3, 7}, false},
+		{"deactivate a user", models.UpdateUserRequest{Active: active(false)}, []int{3}, false},
+		{"role that manages users", models.UpdateUserRequest{Role: str("manager")}, []int{7}, false},
+		{"reactivate", models.UpdateUserRequest{Active: active(true)}, []int{7}, false},
+		{"rename", models.UpdateUserRequest{FullName: str("Ayşe")}, []int{7}, false},
+	}
+	for _, tt := range tests {
+		refused := dropsAdmin(&tt.input) && removesLastAdmin(tt.admins, 7)
+		if refused != tt.refuse {
+			t.Errorf("%s: refused = %v, want %v", tt.name, refused, tt.refuse)
+		}
+	}
+}
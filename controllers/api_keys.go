@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+	"tm/apikeys"
+	"tm/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxAPIKeyName = 100
+	maxAPIKeyDays = 3650
+)
+
+type CreateAPIKeyInput struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays is how long the key works; 0 means until it is revoked.
+	ExpiresInDays int `json:"expires_in_days"`
+	// Role is what an organization key may do. Keys of a user act with
+	// the role of the user.
+	Role string `json:"role"`
+}
+
+// CreatedAPIKey is a new key together with its secret, which is only ever
+// shown in this response.
+type CreatedAPIKey struct {
+	apikeys.Key
+	Secret string `json:"key"`
+}
+
+// createAPIKey checks the input for a new key and creates it for the owner
+// set in k.
+func createAPIKey(c *fiber.Ctx, input *CreateAPIKeyInput, k apikeys.Key) error {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" || len([]rune(input.Name)) > maxAPIKeyName {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name is required and must be at most 100 characters"})
+	}
+	if len(input.Scopes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "at least one scope is required, of " + strings.Join(apikeys.Scopes, ", ")})
+	}
+	for _, s := range input.Scopes {
+		if !apikeys.ValidScope(s) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown scope " + s})
+		}
+	}
+	if input.ExpiresInDays < 0 || input.ExpiresInDays > maxAPIKeyDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "expires_in_days must be between 0 and 3650"})
+	}
+
+	creator := userOf(c)
+	k.OrgID = orgOf(c)
+	k.Name = input.Name
+	k.Scopes = input.Scopes
+	k.CreatedBy = &creator
+	if input.ExpiresInDays > 0 {
+		expires := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		k.ExpiresAt = &expires
+	}
+
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create API key", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	created, secret, err := apikeys.Create(ctx, tx, k)
+	if err == nil {
+		err = recordAudit(c, tx, "api_key.create", "api_key", created.ID, nil, created)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create API key", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(CreatedAPIKey{Key: created, Secret: secret})
+}
+
+// revokeAPIKey revokes the key in the id parameter, limited to the keys of
+// a user unless userId is 0.
+func revokeAPIKey(c *fiber.Ctx, userId int) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid API key id"})
+	}
+
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke API key"})
+	}
+	defer tx.Rollback(ctx)
+
+	k, err := apikeys.Revoke(ctx, tx, id, orgOf(c), userId)
+	if err == apikeys.ErrInvalid {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "API key not found"})
+	}
+	if err == nil {
+		err = recordAudit(c, tx, "api_key.revoke", "api_key", k.ID, k, nil)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke API key"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Revoked"})
+}
+
+// @Summary Get own API keys
+// @Description The caller's API keys that have not been revoked. Secrets are not included.
+// @Tags User
+// @Produce json
+// @Success 200 {array} apikeys.Key
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me/api_keys [get]
+func GetMyAPIKeys(c *fiber.Ctx) error {
+	keys, err := apikeys.List(context.Background(), orgOf(c), userOf(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving API keys"})
+	}
+
+	return c.JSON(keys)
+}
+
+// @Summary Create own API key
+// @Description Create a key that acts as the caller, for use as "Authorization: Bearer <key>". Scopes choose the route groups it works on (devices, drivers, admin, each also as a read-only ":read" form). The key is only shown in this response.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param input body CreateAPIKeyInput true "Name, scopes and expiry"
+// @Success 201 {object} CreatedAPIKey
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me/api_keys [post]
+func CreateMyAPIKey(c *fiber.Ctx) error {
+	input := new(CreateAPIKeyInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if input.Role != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "keys of a user have the role of the user"})
+	}
+
+	userId := userOf(c)
+	return createAPIKey(c, input, apikeys.Key{UserID: &userId})
+}
+
+// @Summary Revoke own API key
+// @Description Revoke one of the caller's API keys. It stops working at once.
+// @Tags User
+// @Param id path int true "API key ID"
+// @Success 200 {object} map[string]interface{} "Revoked"
+// @Failure 404 {object} map[string]interface{} "API key not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me/api_keys/{id} [delete]
+func RevokeMyAPIKey(c *fiber.Ctx) error {
+	return revokeAPIKey(c, userOf(c))
+}
+
+// @Summary Get API keys
+// @Description All API keys of the organization that have not been revoked, those of users included
+// @Tags Admin
+// @Produce json
+// @Success 200 {array} apikeys.Key
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/api_key/all [get]
+func GetAPIKeys(c *fiber.Ctx) error {
+	keys, err := apikeys.List(context.Background(), orgOf(c), 0)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving API keys"})
+	}
+
+	return c.JSON(keys)
+}
+
+// @Summary Create organization API key
+// @Description Create a key that belongs to the organization rather than a user and acts with the given role, for integrations that should outlive any account. The key is only shown in this response.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body CreateAPIKeyInput true "Name, role, scopes and expiry"
+// @Success 201 {object} CreatedAPIKey
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 403 {object} map[string]interface{} "Role not allowed"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/api_key/create [post]
+func CreateAPIKey(c *fiber.Ctx) error {
+	input := new(CreateAPIKeyInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if input.Role == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "role is required"})
+	}
+	if ok, resp := checkRole(c, input.Role); !ok {
+		return resp
+	}
+
+	return createAPIKey(c, input, apikeys.Key{Role: &input.Role})
+}
+
+// @Summary Revoke API key
+// @Description Revoke any API key of the organization, including those of users
+// @Tags Admin
+// @Param id path int true "API key ID"
+// @Success 200 {object} map[string]interface{} "Revoked"
+// @Failure 404 {object} map[string]interface{} "API key not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/api_key/delete/{id} [delete]
+func RevokeAPIKey(c *fiber.Ctx) error {
+	return revokeAPIKey(c, 0)
+}
@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestBySession(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   bool
+	}{
+		{"user session", jwt.MapClaims{"id": float64(7), "sid": "s1"}, true},
+		{"api key", jwt.MapClaims{"id": float64(7), "key": "tm_abc"}, false},
+		{"no claims", nil, false},
+	}
+	for _, tt := range tests {
+		app := fiber.New()
+		var got bool
+		app.Get("/", func(c *fiber.Ctx) error {
+			if tt.claims != nil {
+				c.Locals("claims", tt.claims)
+			}
+			got = bySession(c)
+			return nil
+		})
+		if _, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil)); err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: bySession = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package controllers
+
+import (
+	"tm/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// @Summary Get configuration
+// @Description Show the configuration in effect with secrets and the database password masked
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} config.Config
+// @Router /api/admin/config [get]
+func GetConfig(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(config.C.Redacted())
+}
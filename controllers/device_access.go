@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"context"
+	"tm/database"
+	"tm/rbac"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// deviceScope is the set of devices a caller may see: the devices of an
+// organization, narrowed to an explicit list unless devices is nil.
+type deviceScope struct {
+	orgId   int
+	devices []string
+}
+
+// everyDevice is the scope of background work that serves all organizations.
+var everyDevice = deviceScope{orgId: allOrgs}
+
+// deviceScopeFilter restricts a query on devices d to a scope passed as the
+// parameters $1 (organization) and $2 (device list).
+const deviceScopeFilter = `($1 = 0 OR d.org_id = $1) AND ($2::text[] IS NULL OR d.device_id = ANY($2))`
+
+// allows reports whether a device of the scope's organization is in the scope.
+func (s deviceScope) allows(deviceId string) bool {
+	if s.devices == nil {
+		return true
+	}
+	for _, id := range s.devices {
+		if id == deviceId {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeFor returns the devices a user may see in an organization. Roles with
+// device:all see all of them; others only those assigned to the user, either
+// directly or through a device group.
+func scopeFor(ctx context.Context, orgId, userId int, role string) (deviceScope, error) {
+	scope := deviceScope{orgId: orgId}
+	if rbac.Can(role, rbac.DeviceAll) {
+		return scope, nil
+	}
+
+	rows, err := database.DBpool.Query(ctx,
+		`SELECT device_id FROM user_devices WHERE user_id = $1
+		 UNION
+		 SELECT m.device_id FROM user_device_groups g
+		 JOIN device_group_members m ON m.group_id = g.group_id
+		 WHERE g.user_id = $1`, userId)
+	if err != nil {
+		return scope, err
+	}
+	defer rows.Close()
+
+	scope.devices = []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return scope, err
+		}
+		scope.devices = append(scope.devices, id)
+	}
+	return scope, rows.Err()
+}
+
+// scopeOf returns the devices the caller of a request may see.
+func scopeOf(c *fiber.Ctx) (deviceScope, error) {
+	return scopeFor(context.Background(), orgOf(c), userOf(c), roleOf(c))
+}
+
+// canSeeDevice reports whether a device exists in a scope.
+func canSeeDevice(ctx context.Context, scope deviceScope, deviceId string) (bool, error) {
+	if !scope.allows(deviceId) {
+		return false, nil
+	}
+	return deviceInOrg(ctx, scope.orgId, deviceId)
+}
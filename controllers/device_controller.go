@@ -4,10 +4,12 @@ import (
 	"context"
 	"log"
 	"time"
+	"tm/archive"
 	"tm/database"
 	"tm/models"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v4"
 )
 
 // @Summary Get all devices with their last known location
@@ -18,48 +20,31 @@ import (
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/device/last_locations [get]
 func GetAllDevicesLastLocation(c *fiber.Ctx) error {
-
-	rows, err := database.DBpool.Query(context.Background(), "SELECT device_id, battery_level, signal_status, is_locked,status FROM devices")
+	scope, err := scopeOf(c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving devices"})
 	}
-	defer rows.Close()
-
-	var devices []models.DeviceSchema
-	for rows.Next() {
-		var device models.DeviceSchema
-		err := rows.Scan(&device.DeviceId, &device.BatteryLevel, &device.SignalStatus, &device.IsLocked, &device.Status)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error scanning device"})
-		}
-
-		locationRow := database.DBpool.QueryRow(context.Background(), "SELECT timestamp, latitude, longitude FROM device_locations WHERE device_id=$1 ORDER BY timestamp DESC LIMIT 1", device.DeviceId)
-		var location models.DeviceLocation
-		err = locationRow.Scan(&location.Timestamp, &location.Latitude, &location.Longitude)
-		if err != nil {
-			device.Location = models.DeviceLocation{}
-		} else {
-			device.Location = location
-		}
-
-		devices = append(devices, device)
-	}
-
-	if err = rows.Err(); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error processing devices"})
+	devices, err := fetchDevicesWithLastPosition(context.Background(), scope)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving devices"})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(devices)
+	return c.Status(fiber.StatusOK).JSON(toDeviceSchemas(devices))
 }
 
+// maxClockSkew is how far ahead of the server's clock a device timestamp
+// may be.
+const maxClockSkew = 5 * time.Minute
+
 // @Summary Add device location
-// @Description Add a new location entry for a device
+// @Description Add a new location entry for a device. The timestamp is the device's; when it is omitted the time of receipt is used. A missing speed is derived from the fix before it in time.
 // @Tags Devices
 // @Accept json
 // @Produce json
 // @Param location body models.DeviceLocationRequest true "Device location"
 // @Success 201 {object} map[string]interface{} "Location added successfully"
 // @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Device not found"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/device/locations [post]
 func AddDeviceLocation(c *fiber.Ctx) error {
@@ -76,35 +61,169 @@ func AddDeviceLocation(c *fiber.Ctx) error {
 	// deviceId'yi ekrana yazdır
 	log.Printf("Received deviceId: %s\n", deviceId)
 
-	// Güncel Unix zaman damgasını al
-	timestamp := time.Now().Unix()
+	// Cihaz kullanıcının görebildiği cihazlardan olmalı
+	scope, err := scopeOf(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add location", "details": err.Error()})
+	}
+	ok, err := canSeeDevice(context.Background(), scope, deviceId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add location", "details": err.Error()})
+	}
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "device not found"})
+	}
+
+	// Cihazın zaman damgası yoksa şimdiki zamanı al
+	now := time.Now()
+	fix := models.DeviceLocation{
+		Timestamp: now.Unix(),
+		Latitude:  requestData.Latitude,
+		Longitude: requestData.Longitude,
+		Speed:     requestData.Speed,
+	}
+	if requestData.Timestamp != nil {
+		if *requestData.Timestamp <= 0 || *requestData.Timestamp > now.Add(maxClockSkew).Unix() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "timestamp must be unix seconds and not in the future"})
+		}
+		fix.Timestamp = *requestData.Timestamp
+	}
 
-	// Veritabanına yeni location bilgisini ekleyin
-	_, err := database.DBpool.Exec(
-		context.Background(),
-		"INSERT INTO device_locations (device_id, timestamp, latitude, longitude) VALUES ($1, $2, $3, $4)",
-		deviceId, timestamp, requestData.Latitude, requestData.Longitude,
-	)
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add location", "details": err.Error()})
+	}
+	defer tx.Rollback(ctx)
 
+	// Aynı cihazın konumları sırayla eklenir, böylece hız doğru öncekiyle hesaplanır
+	if _, err := tx.Exec(ctx, "SELECT 1 FROM devices WHERE device_id=$1 FOR NO KEY UPDATE", deviceId); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add location", "details": err.Error()})
+	}
+
+	// Cihaz hız göndermediyse önceki konumdan hesapla
+	prev, err := previousFix(ctx, tx, deviceId, fix.Timestamp)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add location", "details": err.Error()})
 	}
+	deriveSpeed(prev, &fix)
+
+	// Veritabanına yeni location bilgisini ekleyin
+	var late bool
+	err = tx.QueryRow(ctx,
+		`WITH inserted AS (
+		   INSERT INTO device_locations (device_id, timestamp, latitude, longitude, speed) VALUES ($1, $2, $3, $4, $5)
+		 )
+		 SELECT EXISTS (SELECT 1 FROM device_locations WHERE device_id=$1 AND timestamp > $2)`,
+		deviceId, fix.Timestamp, fix.Latitude, fix.Longitude, fix.Speed,
+	).Scan(&late)
+	// Arşivlenmiş bir aya düşen geç konumlar cihazın arşivine de yazılır
+	if err == nil {
+		err = archive.NoteLate(ctx, tx, deviceId, fix.Timestamp)
+	}
+	// Elle gönderilen konumlar denetim kaydına yazılır; cihaz ve entegrasyon
+	// verisi yazılmaz, böylece kayıt zincirinin kilidini beklemez
+	if err == nil && bySession(c) {
+		err = recordAudit(c, tx, "device.add_location", "device", deviceId, nil, fix)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add location", "details": err.Error()})
+	}
+
+	updatePosition(deviceId, fix)
+	// Geç gelen konumlar devam eden hız ihlalini bozmasın
+	if !late {
+		detectOverspeed(ctx, deviceId, fix)
+	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Location added successfully"})
 }
 
+// @Summary Lock or unlock device
+// @Description Command a device to lock or unlock. The device picks up the new state from is_locked.
+// @Tags Devices
+// @Accept json
+// @Produce json
+// @Param id path string true "Device ID"
+// @Param lock body models.DeviceLockRequest true "Whether the device is to be locked"
+// @Success 200 {object} map[string]interface{} "Updated successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Device not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/device/lock/{id} [post]
+func SetDeviceLock(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var request models.DeviceLockRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON", "message": err.Error()})
+	}
+	if request.Locked == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "locked is required"})
+	}
+
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update device", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	var previous bool
+	err = tx.QueryRow(ctx, "SELECT is_locked FROM devices WHERE device_id=$1 FOR UPDATE", id).Scan(&previous)
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "device not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update device", "message": err.Error()})
+	}
+	if _, err := tx.Exec(ctx, "UPDATE devices SET is_locked=$1 WHERE device_id=$2", *request.Locked, id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update device", "message": err.Error()})
+	}
+	action := "device.unlock"
+	if *request.Locked {
+		action = "device.lock"
+	}
+	if err := recordAudit(c, tx, action, "device", id, models.DeviceLockRequest{Locked: &previous}, request); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update device", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update device", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Updated successfully"})
+}
+
 // @Summary Get device locations
-// @Description Get all locations for a specific device
+// @Description Get all locations for a specific device, including archived history. Large tracks can be simplified with a tolerance and returned as a Google encoded polyline.
 // @Tags Devices
 // @Produce json
 // @Param id path string true "Device ID"
+// @Param from query int false "Start of the range (unix seconds)"
+// @Param to query int false "End of the range (unix seconds)"
+// @Param tolerance query number false "Simplification tolerance in meters"
+// @Param algorithm query string false "Simplification algorithm: dp (Douglas-Peucker, default) or vw (Visvalingam-Whyatt)"
+// @Param format query string false "Response format: json (default) or polyline"
 // @Success 200 {array} models.DeviceLocation
+// @Success 200 {object} models.EncodedTrack
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Device not found"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/device/location_list/{id} [get]
 func GetDeviceLocations(c *fiber.Ctx) error {
 	deviceId := c.Params("id")
 
-	rows, err := database.DBpool.Query(context.Background(), "SELECT timestamp, latitude, longitude FROM device_locations WHERE device_id=$1 ORDER BY timestamp DESC", deviceId)
+	opts, err := parseTrackOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rows, err := database.DBpool.Query(context.Background(),
+		"SELECT timestamp, latitude, longitude, speed FROM device_locations WHERE device_id=$1 AND timestamp BETWEEN $2 AND $3 ORDER BY timestamp DESC",
+		deviceId, opts.From, opts.To)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving locations"})
 	}
@@ -113,7 +232,7 @@ func GetDeviceLocations(c *fiber.Ctx) error {
 	var locations []models.DeviceLocation
 	for rows.Next() {
 		var location models.DeviceLocation
-		err := rows.Scan(&location.Timestamp, &location.Latitude, &location.Longitude)
+		err := rows.Scan(&location.Timestamp, &location.Latitude, &location.Longitude, &location.Speed)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error scanning location"})
 		}
@@ -124,6 +243,19 @@ func GetDeviceLocations(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error processing locations"})
 	}
 
+	// Archives are only read for partitions no longer in the database.
+	if archive.Enabled() {
+		archived, err := archive.ReadDevice(context.Background(), deviceId, opts.From, opts.To)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving archived locations"})
+		}
+		locations = append(locations, archived...)
+	}
+
+	locations = simplifyTrack(locations, opts)
+	if opts.Format == "polyline" {
+		return c.Status(fiber.StatusOK).JSON(encodeTrack(locations))
+	}
 	return c.Status(fiber.StatusOK).JSON(locations)
 }
 
@@ -135,8 +267,14 @@ func GetDeviceLocations(c *fiber.Ctx) error {
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/device/all_device [get]
 func GetAllDevices(c *fiber.Ctx) error {
+	scope, err := scopeOf(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving devices"})
+	}
 
-	rows, err := database.DBpool.Query(context.Background(), "SELECT device_id, battery_level, signal_status, is_locked,status FROM devices")
+	rows, err := database.DBpool.Query(context.Background(),
+		"SELECT d.device_id, d.battery_level, d.signal_status, d.is_locked, d.status, "+currentDriverColumns+
+			" FROM devices d "+currentDriverJoin+" WHERE "+deviceScopeFilter, scope.orgId, scope.devices)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving devices"})
 	}
@@ -145,10 +283,13 @@ func GetAllDevices(c *fiber.Ctx) error {
 	var devices []models.DeviceAll
 	for rows.Next() {
 		var device models.DeviceAll
-		err := rows.Scan(&device.DeviceId, &device.BatteryLevel, &device.SignalStatus, &device.IsLocked, &device.Status)
+		var driver currentDriver
+		err := rows.Scan(&device.DeviceId, &device.BatteryLevel, &device.SignalStatus, &device.IsLocked, &device.Status,
+			&driver.id, &driver.name, &driver.phone)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error scanning device"})
 		}
+		device.Driver = driver.model()
 
 		devices = append(devices, device)
 	}
@@ -170,9 +311,16 @@ func GetAllDevices(c *fiber.Ctx) error {
 // @Failure 500 {object} ErrorResponse
 // @Router /api/main [get]
 func Home_page(c *fiber.Ctx) error {
+	scope, err := scopeOf(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get status counts",
+		})
+	}
+
 	// Query to get the count of devices grouped by status
-	query := `SELECT status, COUNT(*) as count FROM devices GROUP BY status;`
-	rows, err := database.DBpool.Query(context.Background(), query)
+	query := `SELECT status, COUNT(*) as count FROM devices d WHERE ` + deviceScopeFilter + ` GROUP BY status;`
+	rows, err := database.DBpool.Query(context.Background(), query, scope.orgId, scope.devices)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to get status counts",
@@ -199,42 +347,14 @@ func Home_page(c *fiber.Ctx) error {
 	}
 
 	// Query to get the latest location of each device
-	query = "SELECT device_id, battery_level, signal_status, is_locked, status FROM devices"
-	rows, err = database.DBpool.Query(context.Background(), query)
+	devices, err := fetchDevicesWithLastPosition(context.Background(), scope)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving devices"})
 	}
-	defer rows.Close()
-
-	var devices []models.DeviceSchema
-	for rows.Next() {
-		var device models.DeviceSchema
-		err := rows.Scan(&device.DeviceId, &device.BatteryLevel, &device.SignalStatus, &device.IsLocked, &device.Status)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error scanning device"})
-		}
-
-		// Query to get the latest location of the device
-		locationQuery := "SELECT timestamp, latitude, longitude FROM device_locations WHERE device_id=$1 ORDER BY timestamp DESC LIMIT 1"
-		locationRow := database.DBpool.QueryRow(context.Background(), locationQuery, device.DeviceId)
-		var location models.DeviceLocation
-		err = locationRow.Scan(&location.Timestamp, &location.Latitude, &location.Longitude)
-		if err != nil {
-			device.Location = models.DeviceLocation{}
-		} else {
-			device.Location = location
-		}
-
-		devices = append(devices, device)
-	}
-
-	if err = rows.Err(); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error processing devices"})
-	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"Status":    statusCounts,
-		"Locations": devices,
+		"Locations": toDeviceSchemas(devices),
 	})
 }
 
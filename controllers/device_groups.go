@@ -0,0 +1,414 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"tm/database"
+	"tm/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+// unknownIds returns a message naming the devices, device groups and users
+// that do not exist in an organization, or "" if they all do.
+func unknownIds(ctx context.Context, orgId int, deviceIds []string, groupIds, userIds []int) (string, error) {
+	var devices []string
+	var groups, users []int32
+	err := database.DBpool.QueryRow(ctx,
+		`SELECT
+		   (SELECT array_agg(x) FROM unnest($2::text[]) x
+		    WHERE NOT EXISTS (SELECT 1 FROM devices WHERE device_id = x AND org_id = $1)),
+		   (SELECT array_agg(x) FROM unnest($3::int[]) x
+		    WHERE NOT EXISTS (SELECT 1 FROM device_groups WHERE id = x AND org_id = $1)),
+		   (SELECT array_agg(x) FROM unnest($4::int[]) x
+		    WHERE NOT EXISTS (SELECT 1 FROM users WHERE id = x AND org_id = $1))`,
+		orgId, deviceIds, groupIds, userIds).Scan(&devices, &groups, &users)
+	if err != nil {
+		return "", err
+	}
+
+	var problems []string
+	if len(devices) > 0 {
+		problems = append(problems, "unknown devices "+strings.Join(devices, ", "))
+	}
+	if len(groups) > 0 {
+		problems = append(problems, fmt.Sprint("unknown device groups ", groups))
+	}
+	if len(users) > 0 {
+		problems = append(problems, fmt.Sprint("unknown users ", users))
+	}
+	return strings.Join(problems, "; "), nil
+}
+
+// @Summary Get all device groups
+// @Description List the device groups of the organization with their devices
+// @Tags Admin
+// @Produce json
+// @Success 200 {array} models.DeviceGroup
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/device_group/all [get]
+func GetDeviceGroups(c *fiber.Ctx) error {
+	rows, err := database.DBpool.Query(context.Background(),
+		`SELECT g.id, g.name,
+		        COALESCE(array_agg(m.device_id ORDER BY m.device_id) FILTER (WHERE m.device_id IS NOT NULL), '{}')
+		 FROM device_groups g
+		 LEFT JOIN device_group_members m ON m.group_id = g.id
+		 WHERE g.org_id = $1
+		 GROUP BY g.id, g.name
+		 ORDER BY g.name`, orgOf(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving device groups"})
+	}
+	defer rows.Close()
+
+	groups := []models.DeviceGroup{}
+	for rows.Next() {
+		var g models.DeviceGroup
+		if err := rows.Scan(&g.ID, &g.Name, &g.DeviceIds); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error scanning device group"})
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving device groups"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(groups)
+}
+
+// @Summary Create device group
+// @Description Create a device group, optionally with its devices
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param group body models.DeviceGroup true "Device group"
+// @Success 201 {object} models.DeviceGroup
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 409 {object} map[string]interface{} "Device group already exists"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/device_group/create [post]
+func CreateDeviceGroup(c *fiber.Ctx) error {
+	group := new(models.DeviceGroup)
+	if err := c.BodyParser(group); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON", "message": err.Error()})
+	}
+	group.Name = strings.TrimSpace(group.Name)
+	if group.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name is required"})
+	}
+	if group.DeviceIds == nil {
+		group.DeviceIds = []string{}
+	}
+
+	ctx := context.Background()
+	orgId := orgOf(c)
+	if msg, err := unknownIds(ctx, orgId, group.DeviceIds, nil, nil); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create device group", "message": err.Error()})
+	} else if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create device group", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx,
+		"INSERT INTO device_groups (org_id, name) VALUES ($1, $2) ON CONFLICT (org_id, name) DO NOTHING RETURNING id",
+		orgId, group.Name).Scan(&group.ID)
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "device group already exists"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create device group", "message": err.Error()})
+	}
+	_, err = tx.Exec(ctx,
+		"INSERT INTO device_group_members (group_id, device_id) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING",
+		group.ID, group.DeviceIds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create device group", "message": err.Error()})
+	}
+	if err := recordAudit(c, tx, "device_group.create", "device_group", group.ID, nil, group); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create device group", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create device group", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(group)
+}
+
+// @Summary Change device group devices
+// @Description Add devices to and remove devices from a device group in one request
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Device group ID"
+// @Param change body models.DeviceGroupChange true "Devices to add and remove"
+// @Success 200 {object} map[string]interface{} "Number of devices added and removed"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/device_group/devices/{id} [put]
+func ChangeDeviceGroupDevices(c *fiber.Ctx) error {
+	groupId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid device group id"})
+	}
+	change := new(models.DeviceGroupChange)
+	if err := c.BodyParser(change); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON", "message": err.Error()})
+	}
+
+	ctx := context.Background()
+	orgId := orgOf(c)
+	if msg, err := unknownIds(ctx, orgId, change.Add, []int{groupId}, nil); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update device group", "message": err.Error()})
+	} else if msg != "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update device group", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	added, err := tx.Exec(ctx,
+		"INSERT INTO device_group_members (group_id, device_id) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING",
+		groupId, change.Add)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update device group", "message": err.Error()})
+	}
+	removed, err := tx.Exec(ctx,
+		"DELETE FROM device_group_members WHERE group_id = $1 AND device_id = ANY($2)",
+		groupId, change.Remove)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update device group", "message": err.Error()})
+	}
+	if err := recordAudit(c, tx, "device_group.change_devices", "device_group", groupId, nil, change); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update device group", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update device group", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"added": added.RowsAffected(), "removed": removed.RowsAffected()})
+}
+
+// @Summary Delete device group
+// @Description Delete a device group. Users assigned to it lose access to its devices.
+// @Tags Admin
+// @Param id path int true "Device group ID"
+// @Success 200 {object} map[string]interface{} "Deleted successfully"
+// @Failure 404 {object} map[string]interface{} "Not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/device_group/delete/{id} [delete]
+func DeleteDeviceGroup(c *fiber.Ctx) error {
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete device group", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, "DELETE FROM device_groups WHERE id=$1 AND org_id=$2", c.Params("id"), orgOf(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete device group", "message": err.Error()})
+	}
+	if result.RowsAffected() == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "device group not found"})
+	}
+	if err := recordAudit(c, tx, "device_group.delete", "device_group", c.Params("id"), nil, nil); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete device group", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete device group", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Deleted successfully"})
+}
+
+// userAccess reads the devices and device groups assigned to a user of an
+// organization.
+func userAccess(ctx context.Context, q rowQuerier, userId interface{}, orgId int) (models.UserAccess, error) {
+	access := models.UserAccess{DeviceIds: []string{}, GroupIds: []int{}}
+	err := q.QueryRow(ctx,
+		`SELECT
+		   COALESCE((SELECT array_agg(device_id ORDER BY device_id) FROM user_devices WHERE user_id = u.id), '{}'),
+		   COALESCE((SELECT array_agg(group_id ORDER BY group_id) FROM user_device_groups WHERE user_id = u.id), '{}')
+		 FROM users u WHERE u.id = $1 AND u.org_id = $2`,
+		userId, orgId).Scan(&access.DeviceIds, &access.GroupIds)
+	return access, err
+}
+
+// @Summary Get user device access
+// @Description Get the devices and device groups assigned to a user. They only matter for roles without device:all.
+// @Tags Admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.UserAccess
+// @Failure 404 {object} map[string]interface{} "Not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/user_access/{id} [get]
+func GetUserAccess(c *fiber.Ctx) error {
+	access, err := userAccess(context.Background(), database.DBpool, c.Params("id"), orgOf(c))
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving user access"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(access)
+}
+
+// @Summary Set user device access
+// @Description Replace the devices and device groups assigned to a user
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param access body models.UserAccess true "Assigned devices and device groups"
+// @Success 200 {object} models.UserAccess
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/user_access/{id} [put]
+func SetUserAccess(c *fiber.Ctx) error {
+	userId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+	}
+	access := new(models.UserAccess)
+	if err := c.BodyParser(access); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON", "message": err.Error()})
+	}
+	if access.DeviceIds == nil {
+		access.DeviceIds = []string{}
+	}
+	if access.GroupIds == nil {
+		access.GroupIds = []int{}
+	}
+
+	ctx := context.Background()
+	if msg, err := unknownIds(ctx, orgOf(c), access.DeviceIds, access.GroupIds, []int{userId}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update user access", "message": err.Error()})
+	} else if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update user access", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the user keeps concurrent changes out of the recorded state
+	if _, err := tx.Exec(ctx, "SELECT 1 FROM users WHERE id = $1 FOR UPDATE", userId); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update user access", "message": err.Error()})
+	}
+	before, err := userAccess(ctx, tx, userId, orgOf(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update user access", "message": err.Error()})
+	}
+
+	for _, stmt := range []struct {
+		sql  string
+		args []interface{}
+	}{
+		{"DELETE FROM user_devices WHERE user_id = $1", []interface{}{userId}},
+		{"DELETE FROM user_device_groups WHERE user_id = $1", []interface{}{userId}},
+		{"INSERT INTO user_devices (user_id, device_id) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING", []interface{}{userId, access.DeviceIds}},
+		{"INSERT INTO user_device_groups (user_id, group_id) SELECT $1, unnest($2::int[]) ON CONFLICT DO NOTHING", []interface{}{userId, access.GroupIds}},
+	} {
+		if _, err := tx.Exec(ctx, stmt.sql, stmt.args...); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update user access", "message": err.Error()})
+		}
+	}
+	if err := recordAudit(c, tx, "user.set_access", "user", userId, before, access); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update user access", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update user access", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(access)
+}
+
+// @Summary Change device access in bulk
+// @Description Grant (action "add") or revoke (action "remove") devices and device groups for many users at once
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param change body models.AccessChange true "Users, devices and device groups"
+// @Success 200 {object} map[string]interface{} "Number of assignments changed"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/user_access/bulk [post]
+func ChangeUserAccess(c *fiber.Ctx) error {
+	change := new(models.AccessChange)
+	if err := c.BodyParser(change); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON", "message": err.Error()})
+	}
+
+	var deviceSQL, groupSQL string
+	switch change.Action {
+	case "add":
+		deviceSQL = `INSERT INTO user_devices (user_id, device_id)
+		             SELECT u, d FROM unnest($1::int[]) u CROSS JOIN unnest($2::text[]) d ON CONFLICT DO NOTHING`
+		groupSQL = `INSERT INTO user_device_groups (user_id, group_id)
+		            SELECT u, g FROM unnest($1::int[]) u CROSS JOIN unnest($2::int[]) g ON CONFLICT DO NOTHING`
+	case "remove":
+		deviceSQL = "DELETE FROM user_devices WHERE user_id = ANY($1) AND device_id = ANY($2)"
+		groupSQL = "DELETE FROM user_device_groups WHERE user_id = ANY($1) AND group_id = ANY($2)"
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "action must be add or remove"})
+	}
+	if len(change.UserIds) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "user_ids is required"})
+	}
+	if change.DeviceIds == nil {
+		change.DeviceIds = []string{}
+	}
+	if change.GroupIds == nil {
+		change.GroupIds = []int{}
+	}
+
+	ctx := context.Background()
+	if msg, err := unknownIds(ctx, orgOf(c), change.DeviceIds, change.GroupIds, change.UserIds); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update user access", "message": err.Error()})
+	} else if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update user access", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	devices, err := tx.Exec(ctx, deviceSQL, change.UserIds, change.DeviceIds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update user access", "message": err.Error()})
+	}
+	groups, err := tx.Exec(ctx, groupSQL, change.UserIds, change.GroupIds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update user access", "message": err.Error()})
+	}
+	granted := models.UserAccess{DeviceIds: change.DeviceIds, GroupIds: change.GroupIds}
+	for _, userId := range change.UserIds {
+		if err := recordAudit(c, tx, "user.access_"+change.Action, "user", userId, nil, granted); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update user access", "message": err.Error()})
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update user access", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"devices": devices.RowsAffected(), "groups": groups.RowsAffected()})
+}
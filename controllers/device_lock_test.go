@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSetDeviceLockRequiresLocked(t *testing.T) {
+	app := fiber.New()
+	app.Post("/:id", SetDeviceLock)
+
+	for _, body := range []string{`{}`, `{"locked":`} {
+		req := httptest.NewRequest(fiber.MethodPost, "/dev1", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("body %s: status %d, want 400", body, resp.StatusCode)
+		}
+	}
+}
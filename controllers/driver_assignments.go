@@ -0,0 +1,435 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+	"tm/database"
+	"tm/geo"
+	"tm/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+// currentDriverJoin joins devices d with the driver of their open
+// assignment, if any, for the columns in currentDriverColumns.
+const (
+	currentDriverJoin = `
+	LEFT JOIN driver_assignments cda ON cda.device_id = d.device_id AND cda.ended_at IS NULL
+	LEFT JOIN driver cdr ON cdr.id = cda.driver_id`
+	currentDriverColumns = "cdr.id, cdr.name, cdr.phone"
+)
+
+// currentDriver receives currentDriverColumns, which are all NULL for
+// devices without a driver.
+type currentDriver struct {
+	id          *int
+	name, phone *string
+}
+
+func (d currentDriver) model() *models.CurrentDriver {
+	if d.id == nil {
+		return nil
+	}
+	return &models.CurrentDriver{ID: *d.id, Name: *d.name, Phone: *d.phone}
+}
+
+// assignmentColumns lists the columns of driver_assignments a and driver dr
+// scanned into models.DriverAssignment, in order.
+const assignmentColumns = `a.id, a.driver_id, dr.name, a.device_id, a.vehicle_id,
+	(SELECT v.plate FROM vehicles v WHERE v.id = a.vehicle_id), a.started_at, a.ended_at, a.assigned_by`
+
+func scanAssignment(row pgx.Row) (models.DriverAssignment, error) {
+	var a models.DriverAssignment
+	err := row.Scan(&a.ID, &a.DriverId, &a.DriverName, &a.DeviceId, &a.VehicleId, &a.Plate, &a.StartedAt, &a.EndedAt, &a.AssignedBy)
+	return a, err
+}
+
+// collectAssignments scans the rows of a query for assignmentColumns.
+func collectAssignments(rows pgx.Rows, err error) ([]models.DriverAssignment, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	assignments := []models.DriverAssignment{}
+	for rows.Next() {
+		a, err := scanAssignment(rows)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, rows.Err()
+}
+
+// errAssignedOutOfScope is returned by openAssignment when it would end an
+// assignment to a device outside the caller's scope.
+var errAssignedOutOfScope = errors.New("the driver or vehicle is assigned to a device you cannot manage")
+
+// openAssignment ends the open assignments of a driver, a device and a
+// vehicle and opens one between them, returning both. A nil deviceId or
+// vehicleId leaves that side out. It returns pgx.ErrNoRows if another
+// transaction opened an assignment for either side in the meantime, and
+// errAssignedOutOfScope if one of the ended assignments is to a device
+// outside scope.
+func openAssignment(ctx context.Context, tx pgx.Tx, scope deviceScope, orgId, driverId int, deviceId *string, vehicleId *int, by int) ([]models.DriverAssignment, models.DriverAssignment, error) {
+	ended, err := collectAssignments(tx.Query(ctx,
+		`UPDATE driver_assignments a SET ended_at = now() FROM driver dr
+		 WHERE dr.id = a.driver_id AND (a.driver_id = $1 OR a.device_id = $2 OR a.vehicle_id = $3) AND a.ended_at IS NULL
+		 RETURNING `+assignmentColumns, driverId, deviceId, vehicleId))
+	if err != nil {
+		return nil, models.DriverAssignment{}, err
+	}
+	for _, a := range ended {
+		if a.DeviceId != nil && !scope.allows(*a.DeviceId) {
+			return nil, models.DriverAssignment{}, errAssignedOutOfScope
+		}
+	}
+
+	// The unique indexes on open assignments turn a concurrent assignment
+	// into no row.
+	assignment, err := scanAssignment(tx.QueryRow(ctx,
+		`WITH a AS (
+		   INSERT INTO driver_assignments (org_id, driver_id, device_id, vehicle_id, assigned_by)
+		   VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING RETURNING *
+		 )
+		 SELECT `+assignmentColumns+` FROM a JOIN driver dr ON dr.id = a.driver_id`,
+		orgId, driverId, deviceId, vehicleId, by))
+	return ended, assignment, err
+}
+
+// @Summary Assign driver
+// @Description Make a driver the driver of a vehicle or a device from now on. A vehicle brings the device installed in it, and a device the vehicle it is installed in. Open assignments of the driver, the vehicle and the device are ended first, so each has at most one. Assigning a driver to what it already drives changes nothing.
+// @Tags Drivers
+// @Accept json
+// @Produce json
+// @Param input body models.AssignDriverRequest true "Driver, and vehicle or device"
+// @Success 200 {object} models.DriverAssignment "Already assigned"
+// @Success 201 {object} models.DriverAssignment
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Driver, vehicle or device not found"
+// @Failure 409 {object} map[string]interface{} "Changed concurrently, or assigned to a device out of scope"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/driver/assign [post]
+func AssignDriver(c *fiber.Ctx) error {
+	input := new(models.AssignDriverRequest)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON", "message": err.Error()})
+	}
+	if input.DriverId <= 0 || (input.DeviceId == "" && input.VehicleId <= 0) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "driver_id and a device_id or vehicle_id are required"})
+	}
+
+	ctx := context.Background()
+	scope, err := scopeOf(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to assign driver", "message": err.Error()})
+	}
+	orgId := orgOf(c)
+	var deviceId *string
+	var vehicleId *int
+	if input.VehicleId > 0 {
+		err := database.DBpool.QueryRow(ctx,
+			"SELECT id, device_id FROM vehicles WHERE id = $1 AND org_id = $2", input.VehicleId, orgId).Scan(&vehicleId, &deviceId)
+		if err == pgx.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "vehicle not found"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to assign driver", "message": err.Error()})
+		}
+		if input.DeviceId != "" && (deviceId == nil || *deviceId != input.DeviceId) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "the device is not installed in the vehicle"})
+		}
+	} else {
+		deviceId = &input.DeviceId
+		err := database.DBpool.QueryRow(ctx,
+			"SELECT id FROM vehicles WHERE device_id = $1 AND org_id = $2", input.DeviceId, orgId).Scan(&vehicleId)
+		if err != nil && err != pgx.ErrNoRows {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to assign driver", "message": err.Error()})
+		}
+	}
+
+	if deviceId != nil {
+		if ok, err := canSeeDevice(ctx, scope, *deviceId); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to assign driver", "message": err.Error()})
+		} else if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Device not found"})
+		}
+	}
+	var exists bool
+	err = database.DBpool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM driver WHERE id = $1 AND org_id = $2)", input.DriverId, orgId).Scan(&exists)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to assign driver", "message": err.Error()})
+	}
+	if !exists {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "driver not found"})
+	}
+
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to assign driver", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	current, err := scanAssignment(tx.QueryRow(ctx,
+		`SELECT `+assignmentColumns+` FROM driver_assignments a JOIN driver dr ON dr.id = a.driver_id
+		 WHERE a.driver_id = $1 AND a.device_id IS NOT DISTINCT FROM $2 AND a.vehicle_id IS NOT DISTINCT FROM $3
+		   AND a.ended_at IS NULL`, input.DriverId, deviceId, vehicleId))
+	if err == nil {
+		return c.Status(fiber.StatusOK).JSON(current)
+	}
+	if err != pgx.ErrNoRows {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to assign driver", "message": err.Error()})
+	}
+
+	ended, assignment, err := openAssignment(ctx, tx, scope, orgId, input.DriverId, deviceId, vehicleId, userOf(c))
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "the driver, vehicle or device was assigned at the same time, try again"})
+	}
+	if err == errAssignedOutOfScope {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to assign driver", "message": err.Error()})
+	}
+	if err := recordAudit(c, tx, "driver.assign", "driver", input.DriverId, ended, assignment); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to assign driver", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to assign driver", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(assignment)
+}
+
+// @Summary Unassign driver
+// @Description End the open assignment of a driver, leaving its vehicle and device without a driver
+// @Tags Drivers
+// @Produce json
+// @Param id path int true "Driver ID"
+// @Success 200 {object} models.DriverAssignment
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Driver not assigned"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/driver/unassign/{id} [post]
+func UnassignDriver(c *fiber.Ctx) error {
+	driverId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid driver id"})
+	}
+	scope, err := scopeOf(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to unassign driver", "message": err.Error()})
+	}
+
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to unassign driver", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	assignment, err := scanAssignment(tx.QueryRow(ctx,
+		`UPDATE driver_assignments a SET ended_at = now() FROM driver dr
+		 WHERE dr.id = a.driver_id AND a.driver_id = $1 AND a.org_id = $2 AND a.ended_at IS NULL
+		   AND ($3::text[] IS NULL OR a.device_id = ANY($3))
+		 RETURNING `+assignmentColumns, driverId, scope.orgId, scope.devices))
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "driver is not assigned to a device"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to unassign driver", "message": err.Error()})
+	}
+	if err := recordAudit(c, tx, "driver.unassign", "driver", driverId, nil, assignment); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to unassign driver", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to unassign driver", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(assignment)
+}
+
+// @Summary Get driver assignments
+// @Description Assignment history, newest first, optionally for one driver, vehicle or device and overlapping a time range
+// @Tags Drivers
+// @Produce json
+// @Param driver_id query int false "Driver ID"
+// @Param vehicle_id query int false "Vehicle ID"
+// @Param device_id query string false "Device ID"
+// @Param from query int false "Start of the range (unix seconds)"
+// @Param to query int false "End of the range (unix seconds)"
+// @Success 200 {array} models.DriverAssignment
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/driver/assignments [get]
+func GetDriverAssignments(c *fiber.Ctx) error {
+	driverId := c.QueryInt("driver_id")
+	from, to, err := timeRange(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	scope, err := scopeOf(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving assignments"})
+	}
+
+	assignments, err := collectAssignments(database.DBpool.Query(context.Background(),
+		`SELECT `+assignmentColumns+`
+		 FROM driver_assignments a
+		 JOIN driver dr ON dr.id = a.driver_id
+		 WHERE a.org_id = $1 AND ($2::text[] IS NULL OR a.device_id = ANY($2))
+		   AND ($3 = 0 OR a.driver_id = $3) AND ($4 = '' OR a.device_id = $4) AND ($5 = 0 OR a.vehicle_id = $5)
+		   AND EXTRACT(EPOCH FROM a.started_at)::bigint <= $7
+		   AND (a.ended_at IS NULL OR EXTRACT(EPOCH FROM a.ended_at)::bigint >= $6)
+		 ORDER BY a.started_at DESC, a.id DESC`,
+		scope.orgId, scope.devices, driverId, c.Query("device_id"), c.QueryInt("vehicle_id"), from, to))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving assignments"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(assignments)
+}
+
+// @Summary Get driver report
+// @Description Distance, assigned and driving time, top speed and overspeeds of a driver over a time range, with one trip per assignment. Trips only cover the part of an assignment inside the range. Driving time counts the intervals between fixes in which the device moved.
+// @Tags Drivers
+// @Produce json
+// @Param id path int true "Driver ID"
+// @Param from query int false "Start of the range (unix seconds)"
+// @Param to query int false "End of the range (unix seconds)"
+// @Success 200 {object} models.DriverReport
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Driver not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/driver/report/{id} [get]
+func GetDriverReport(c *fiber.Ctx) error {
+	driverId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid driver id"})
+	}
+	from, to, err := timeRange(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if now := time.Now().Unix(); to > now {
+		to = now
+	}
+
+	ctx := context.Background()
+	scope, err := scopeOf(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error building report"})
+	}
+	var exists bool
+	err = database.DBpool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM driver WHERE id = $1 AND org_id = $2)", driverId, scope.orgId).Scan(&exists)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error building report"})
+	}
+	if !exists {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "driver not found"})
+	}
+
+	rows, err := database.DBpool.Query(ctx,
+		`SELECT a.id, a.device_id,
+		        GREATEST(EXTRACT(EPOCH FROM a.started_at)::bigint, $4),
+		        LEAST(COALESCE(EXTRACT(EPOCH FROM a.ended_at)::bigint, $5), $5)
+		 FROM driver_assignments a
+		 JOIN devices d ON d.device_id = a.device_id
+		 WHERE `+deviceScopeFilter+` AND a.driver_id = $3
+		   AND EXTRACT(EPOCH FROM a.started_at)::bigint <= $5
+		   AND (a.ended_at IS NULL OR EXTRACT(EPOCH FROM a.ended_at)::bigint >= $4)
+		 ORDER BY a.started_at`,
+		scope.orgId, scope.devices, driverId, from, to)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error building report"})
+	}
+	report := models.DriverReport{DriverId: driverId, From: from, To: to, Trips: []models.DriverTrip{}}
+	for rows.Next() {
+		var trip models.DriverTrip
+		if err := rows.Scan(&trip.AssignmentId, &trip.DeviceId, &trip.Start, &trip.End); err != nil {
+			rows.Close()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error building report"})
+		}
+		report.Trips = append(report.Trips, trip)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error building report"})
+	}
+
+	for i := range report.Trips {
+		trip := &report.Trips[i]
+		if err := measureTrip(ctx, driverId, trip); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error building report"})
+		}
+		report.Distance += trip.Distance
+		report.AssignedTime += trip.End - trip.Start
+		report.DrivingTime += trip.DrivingTime
+		report.Overspeeds += trip.Overspeeds
+	}
+
+	return c.Status(fiber.StatusOK).JSON(report)
+}
+
+// A device is taken to be driving between two fixes if it covered the
+// distance between them at movingSpeed or faster. Gaps longer than
+// maxFixGap are not counted, as nothing is known about them.
+const (
+	movingSpeed = 5.0     // km/h
+	maxFixGap   = 10 * 60 // seconds
+)
+
+// drivingTime returns the seconds between two fixes that count as driving.
+func drivingTime(prev, next models.DeviceLocation) int64 {
+	dt := next.Timestamp - prev.Timestamp
+	if dt > maxFixGap {
+		return 0
+	}
+	speed, ok := geo.SpeedKmh(prev.Latitude, prev.Longitude, prev.Timestamp, next.Latitude, next.Longitude, next.Timestamp)
+	if !ok || speed < movingSpeed {
+		return 0
+	}
+	return dt
+}
+
+// measureTrip fills in the distance, driving time, top speed and overspeeds
+// of a trip from the locations and events of its device between its start
+// and end.
+func measureTrip(ctx context.Context, driverId int, trip *models.DriverTrip) error {
+	rows, err := database.DBpool.Query(ctx,
+		"SELECT timestamp, latitude, longitude, speed FROM device_locations WHERE device_id=$1 AND timestamp BETWEEN $2 AND $3 ORDER BY timestamp",
+		trip.DeviceId, trip.Start, trip.End)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var prev *models.DeviceLocation
+	for rows.Next() {
+		var location models.DeviceLocation
+		if err := rows.Scan(&location.Timestamp, &location.Latitude, &location.Longitude, &location.Speed); err != nil {
+			return err
+		}
+		if prev != nil {
+			trip.Distance += geo.Distance(prev.Latitude, prev.Longitude, location.Latitude, location.Longitude)
+			trip.DrivingTime += drivingTime(*prev, location)
+		}
+		if location.Speed != nil && *location.Speed > trip.MaxSpeed {
+			trip.MaxSpeed = *location.Speed
+		}
+		trip.Points++
+		prev = &location
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return database.DBpool.QueryRow(ctx,
+		"SELECT COUNT(*) FROM events WHERE driver_id=$1 AND device_id=$2 AND type=$3 AND start_time BETWEEN $4 AND $5",
+		driverId, trip.DeviceId, eventTypeOverspeed, trip.Start, trip.End).Scan(&trip.Overspeeds)
+}
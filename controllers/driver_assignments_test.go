@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"testing"
+	"tm/models"
+)
+
+func TestDrivingTime(t *testing.T) {
+	start := models.DeviceLocation{Timestamp: 1000, Latitude: 50, Longitude: 8}
+	tests := []struct {
+		name string
+		next models.DeviceLocation
+		want int64
+	}{
+		// About 111 m in a minute, 6.7 km/h
+		{"moving", models.DeviceLocation{Timestamp: 1060, Latitude: 50.001, Longitude: 8}, 60},
+		{"standing", models.DeviceLocation{Timestamp: 1060, Latitude: 50.00001, Longitude: 8}, 0},
+		{"gap", models.DeviceLocation{Timestamp: 1000 + maxFixGap + 1, Latitude: 51, Longitude: 8}, 0},
+		{"same time", models.DeviceLocation{Timestamp: 1000, Latitude: 50.001, Longitude: 8}, 0},
+	}
+	for _, tt := range tests {
+		if got := drivingTime(start, tt.next); got != tt.want {
+			t.Errorf("%s: drivingTime = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
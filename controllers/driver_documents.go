@@ -0,0 +1,577 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"mime"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"tm/database"
+	"tm/documents"
+	"tm/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	maxDocumentNumber = 50
+	maxFileName       = 255
+	maxExpiringDays   = 365
+)
+
+var countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// documentColumns lists the columns of driver_documents d and driver dr
+// scanned into models.DriverDocument, in order.
+const documentColumns = `d.id, d.driver_id, dr.name, d.type, d.number, d.issuing_country,
+	to_char(d.issued_on, 'YYYY-MM-DD'), to_char(d.expires_on, 'YYYY-MM-DD'),
+	d.file_name, d.file_type, d.file_size, d.created_at, d.updated_at`
+
+func scanDocument(row pgx.Row, extra ...interface{}) (models.DriverDocument, error) {
+	var d models.DriverDocument
+	dest := append([]interface{}{&d.ID, &d.DriverId, &d.DriverName, &d.Type, &d.Number, &d.IssuingCountry,
+		&d.IssuedOn, &d.ExpiresOn, &d.FileName, &d.FileType, &d.FileSize, &d.CreatedAt, &d.UpdatedAt}, extra...)
+	err := row.Scan(dest...)
+	return d, err
+}
+
+func collectDocuments(rows pgx.Rows, err error) ([]models.DriverDocument, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	docs := []models.DriverDocument{}
+	for rows.Next() {
+		d, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, d)
+	}
+	return docs, rows.Err()
+}
+
+// checkDocument normalizes a document from a request and answers 400 if it
+// is invalid.
+func checkDocument(c *fiber.Ctx, d *models.DriverDocument) (bool, error) {
+	d.Type = strings.ToLower(strings.TrimSpace(d.Type))
+	d.Number = strings.TrimSpace(d.Number)
+	d.IssuingCountry = strings.ToUpper(strings.TrimSpace(d.IssuingCountry))
+	var issued, expires time.Time
+	var problem string
+	switch {
+	case !documents.ValidType(d.Type):
+		problem = "type must be one of " + strings.Join(documents.Types, ", ")
+	case len([]rune(d.Number)) > maxDocumentNumber:
+		problem = "number must be at most 50 characters"
+	case d.IssuingCountry != "" && !countryPattern.MatchString(d.IssuingCountry):
+		problem = "issuing_country must be a two letter country code"
+	case !parseDate(&d.IssuedOn, &issued) || !parseDate(&d.ExpiresOn, &expires):
+		problem = "issued_on and expires_on must be dates as YYYY-MM-DD"
+	case d.IssuedOn != nil && d.ExpiresOn != nil && expires.Before(issued):
+		problem = "expires_on must not be before issued_on"
+	}
+	if problem != "" {
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": problem})
+	}
+	return true, nil
+}
+
+// parseDate parses an optional "YYYY-MM-DD" date into t, treating an empty
+// one as none.
+func parseDate(s **string, t *time.Time) bool {
+	if *s == nil || strings.TrimSpace(**s) == "" {
+		*s = nil
+		return true
+	}
+	var err error
+	*t, err = time.Parse("2006-01-02", strings.TrimSpace(**s))
+	return err == nil
+}
+
+func documentId(c *fiber.Ctx) (int, bool) {
+	id, err := strconv.Atoi(c.Params("id"))
+	return id, err == nil
+}
+
+// @Summary Get driver documents
+// @Description The documents of a driver, those expiring first first
+// @Tags Drivers
+// @Produce json
+// @Param id path int true "Driver ID"
+// @Success 200 {array} models.DriverDocument
+// @Failure 404 {object} map[string]interface{} "Driver not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/driver/documents/{id} [get]
+func GetDriverDocuments(c *fiber.Ctx) error {
+	driverId, ok := documentId(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid driver id"})
+	}
+	ctx := context.Background()
+	orgId := orgOf(c)
+	var exists bool
+	err := database.DBpool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM driver WHERE id = $1 AND org_id = $2)", driverId, orgId).Scan(&exists)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving documents"})
+	}
+	if !exists {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "driver not found"})
+	}
+
+	docs, err := collectDocuments(database.DBpool.Query(ctx,
+		`SELECT `+documentColumns+` FROM driver_documents d JOIN driver dr ON dr.id = d.driver_id
+		 WHERE d.driver_id = $1 AND d.org_id = $2
+		 ORDER BY d.expires_on NULLS LAST, d.id`, driverId, orgId))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving documents"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(docs)
+}
+
+// @Summary Get expiring driver documents
+// @Description Documents of all drivers that expired or expire within a number of days, soonest first
+// @Tags Drivers
+// @Produce json
+// @Param days query int false "Days ahead, 30 by default"
+// @Success 200 {array} models.DriverDocument
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/driver/document/expiring [get]
+func GetExpiringDocuments(c *fiber.Ctx) error {
+	days := c.QueryInt("days", 30)
+	if days < 0 || days > maxExpiringDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "days must be between 0 and 365"})
+	}
+
+	docs, err := collectDocuments(database.DBpool.Query(context.Background(),
+		`SELECT `+documentColumns+` FROM driver_documents d JOIN driver dr ON dr.id = d.driver_id
+		 WHERE d.org_id = $1 AND d.expires_on <= current_date + $2::int
+		 ORDER BY d.expires_on, d.id`, orgOf(c), days))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving documents"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(docs)
+}
+
+// @Summary Get driver document alerts
+// @Description Expiry alerts of the organization's documents raised within a number of days, newest first, including those nobody could be sent by email or SMS
+// @Tags Drivers
+// @Produce json
+// @Param days query int false "Days back, 30 by default"
+// @Success 200 {array} models.DriverDocumentAlert
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/driver/document/alerts [get]
+func GetDocumentAlerts(c *fiber.Ctx) error {
+	days := c.QueryInt("days", 30)
+	if days < 0 || days > maxExpiringDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "days must be between 0 and 365"})
+	}
+
+	rows, err := database.DBpool.Query(context.Background(),
+		`SELECT d.id, d.driver_id, dr.name, d.type, d.number, a.days, to_char(a.expires_on, 'YYYY-MM-DD'),
+		        a.channels, a.created_at, a.delivered_at
+		 FROM driver_document_alerts a
+		 JOIN driver_documents d ON d.id = a.document_id
+		 JOIN driver dr ON dr.id = d.driver_id
+		 WHERE d.org_id = $1 AND a.created_at >= now() - make_interval(days => $2)
+		 ORDER BY a.created_at DESC, d.id`, orgOf(c), days)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving alerts"})
+	}
+	defer rows.Close()
+
+	alerts := []models.DriverDocumentAlert{}
+	for rows.Next() {
+		var a models.DriverDocumentAlert
+		err := rows.Scan(&a.DocumentId, &a.DriverId, &a.DriverName, &a.Type, &a.Number, &a.Days, &a.ExpiresOn,
+			&a.Channels, &a.CreatedAt, &a.DeliveredAt)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error scanning alert"})
+		}
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error processing alerts"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(alerts)
+}
+
+// @Summary Create driver document
+// @Description Add a document to a driver. The scan is uploaded afterwards to /api/driver/document/file/{id}.
+// @Tags Drivers
+// @Accept json
+// @Produce json
+// @Param document body models.DriverDocument true "Document"
+// @Success 201 {object} models.DriverDocument
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Driver not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/driver/document/create [post]
+func CreateDriverDocument(c *fiber.Ctx) error {
+	input := new(models.DriverDocument)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON", "message": err.Error()})
+	}
+	if ok, resp := checkDocument(c, input); !ok {
+		return resp
+	}
+
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create document", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	doc, err := scanDocument(tx.QueryRow(ctx,
+		`WITH d AS (
+		   INSERT INTO driver_documents (org_id, driver_id, type, number, issuing_country, issued_on, expires_on)
+		   SELECT org_id, id, $3, $4, $5, $6::date, $7::date FROM driver WHERE id = $1 AND org_id = $2
+		   RETURNING *
+		 )
+		 SELECT `+documentColumns+` FROM d JOIN driver dr ON dr.id = d.driver_id`,
+		input.DriverId, orgOf(c), input.Type, input.Number, input.IssuingCountry, input.IssuedOn, input.ExpiresOn))
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "driver not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create document", "message": err.Error()})
+	}
+	if err := recordAudit(c, tx, "driver_document.create", "driver", doc.DriverId, nil, doc); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create document", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create document", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(doc)
+}
+
+// @Summary Update driver document
+// @Description Change the type, number, issuing country or dates of a document. Its driver and scan stay.
+// @Tags Drivers
+// @Accept json
+// @Produce json
+// @Param id path int true "Document ID"
+// @Param document body models.DriverDocument true "Document"
+// @Success 200 {object} models.DriverDocument
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Document not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/driver/document/update/{id} [put]
+func UpdateDriverDocument(c *fiber.Ctx) error {
+	id, ok := documentId(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid document id"})
+	}
+	input := new(models.DriverDocument)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON", "message": err.Error()})
+	}
+	if ok, resp := checkDocument(c, input); !ok {
+		return resp
+	}
+
+	ctx := context.Background()
+	orgId := orgOf(c)
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update document", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := scanDocument(tx.QueryRow(ctx,
+		`SELECT `+documentColumns+` FROM driver_documents d JOIN driver dr ON dr.id = d.driver_id
+		 WHERE d.id = $1 AND d.org_id = $2 FOR UPDATE OF d`, id, orgId))
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "document not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update document", "message": err.Error()})
+	}
+
+	doc, err := scanDocument(tx.QueryRow(ctx,
+		`UPDATE driver_documents d
+		 SET type = $3, number = $4, issuing_country = $5, issued_on = $6::date, expires_on = $7::date, updated_at = now()
+		 FROM driver dr
+		 WHERE dr.id = d.driver_id AND d.id = $1 AND d.org_id = $2
+		 RETURNING `+documentColumns,
+		id, orgId, input.Type, input.Number, input.IssuingCountry, input.IssuedOn, input.ExpiresOn))
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "document not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update document", "message": err.Error()})
+	}
+	if err := recordAudit(c, tx, "driver_document.update", "driver", doc.DriverId, before, doc); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update document", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update document", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(doc)
+}
+
+// @Summary Delete driver document
+// @Description Delete a document and its scan
+// @Tags Drivers
+// @Produce json
+// @Param id path int true "Document ID"
+// @Success 200 {object} map[string]interface{} "Deleted successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Document not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/driver/document/delete/{id} [delete]
+func DeleteDriverDocument(c *fiber.Ctx) error {
+	id, ok := documentId(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid document id"})
+	}
+
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete document", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	var fileKey *string
+	deleted, err := scanDocument(tx.QueryRow(ctx,
+		`DELETE FROM driver_documents d USING driver dr
+		 WHERE dr.id = d.driver_id AND d.id = $1 AND d.org_id = $2
+		 RETURNING `+documentColumns+`, d.file_key`, id, orgOf(c)), &fileKey)
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "document not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete document", "message": err.Error()})
+	}
+	if err := recordAudit(c, tx, "driver_document.delete", "driver", deleted.DriverId, deleted, nil); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete document", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete document", "message": err.Error()})
+	}
+	if fileKey != nil {
+		if err := documents.Remove(*fileKey); err != nil {
+			log.Println("Error removing document scan:", err)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Deleted successfully"})
+}
+
+// @Summary Upload driver document scan
+// @Description Upload the scan of a document as the multipart form field "file", replacing any earlier one. PDF, JPEG and PNG files are accepted.
+// @Tags Drivers
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "Document ID"
+// @Param file formData file true "Scan"
+// @Success 200 {object} models.DriverDocument
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Document not found"
+// @Failure 413 {object} map[string]interface{} "File too large"
+// @Failure 415 {object} map[string]interface{} "Not a PDF, JPEG or PNG file"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/driver/document/file/{id} [put]
+func UploadDriverDocumentFile(c *fiber.Ctx) error {
+	id, ok := documentId(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid document id"})
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "the scan must be sent as the form field file"})
+	}
+	if header.Size > documents.MaxBytes() {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "file is too large"})
+	}
+	name := strings.TrimSpace(filepath.Base(strings.ReplaceAll(header.Filename, `\`, "/")))
+	if r := []rune(name); len(r) > maxFileName {
+		name = string(r[len(r)-maxFileName:])
+	}
+
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to store scan", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	// The lock makes concurrent uploads to the document take turns, so each
+	// one removes the scan the one before it stored.
+	orgId := orgOf(c)
+	var driverId int
+	var oldKey *string
+	err = tx.QueryRow(ctx,
+		"SELECT driver_id, file_key FROM driver_documents WHERE id = $1 AND org_id = $2 FOR UPDATE",
+		id, orgId).Scan(&driverId, &oldKey)
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "document not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to store scan", "message": err.Error()})
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot read the uploaded file"})
+	}
+	defer file.Close()
+	key, contentType, err := documents.Save(orgId, driverId, file)
+	if err == documents.ErrFileType {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to store scan", "message": err.Error()})
+	}
+
+	doc, err := scanDocument(tx.QueryRow(ctx,
+		`UPDATE driver_documents d
+		 SET file_key = $3, file_name = $4, file_type = $5, file_size = $6, updated_at = now()
+		 FROM driver dr
+		 WHERE dr.id = d.driver_id AND d.id = $1 AND d.org_id = $2
+		 RETURNING `+documentColumns,
+		id, orgId, key, name, contentType, header.Size))
+	if err == nil {
+		err = recordAudit(c, tx, "driver_document.upload", "driver", doc.DriverId, nil, doc)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		documents.Remove(key)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to store scan", "message": err.Error()})
+	}
+	if oldKey != nil {
+		if err := documents.Remove(*oldKey); err != nil {
+			log.Println("Error removing replaced document scan:", err)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(doc)
+}
+
+// @Summary Download driver document scan
+// @Description Download the uploaded scan of a document
+// @Tags Drivers
+// @Produce application/pdf
+// @Produce image/jpeg
+// @Produce image/png
+// @Param id path int true "Document ID"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Document or scan not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/driver/document/file/{id} [get]
+func GetDriverDocumentFile(c *fiber.Ctx) error {
+	id, ok := documentId(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid document id"})
+	}
+
+	var key *string
+	var name, contentType string
+	err := database.DBpool.QueryRow(context.Background(),
+		"SELECT file_key, file_name, file_type FROM driver_documents WHERE id = $1 AND org_id = $2",
+		id, orgOf(c)).Scan(&key, &name, &contentType)
+	if err == pgx.ErrNoRows || (err == nil && key == nil) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "scan not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving scan"})
+	}
+
+	file, err := documents.Open(*key)
+	if err != nil {
+		log.Println("Error opening document scan:", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "scan not found"})
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving scan"})
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	return c.SendStream(file, int(info.Size()))
+}
+
+// validDocument holds for driver documents d that are in force today.
+const validDocument = `(d.issued_on IS NULL OR d.issued_on <= current_date)
+	AND (d.expires_on IS NULL OR d.expires_on >= current_date)`
+
+// driverAllowed returns a condition that holds if the driver with the id
+// in column has a valid document of each of the types in the text array
+// parameter required.
+func driverAllowed(column, required string) string {
+	return `NOT EXISTS (
+	  SELECT 1 FROM unnest(` + required + `::text[]) AS r(type)
+	  WHERE NOT EXISTS (
+	    SELECT 1 FROM driver_documents d
+	    WHERE d.driver_id = ` + column + ` AND d.type = r.type AND ` + validDocument + `))`
+}
+
+// @Summary Get drivers not allowed to drive
+// @Description Drivers who lack a valid document of a required type (set in the configuration, a licence by default), with the reasons and what each is assigned to
+// @Tags Drivers
+// @Produce json
+// @Success 200 {array} models.DriverClearance
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/driver/not_allowed [get]
+func GetDriversNotAllowed(c *fiber.Ctx) error {
+	rows, err := database.DBpool.Query(context.Background(),
+		`SELECT dr.id, dr.name, dr.phone, r.type,
+		        (SELECT to_char(max(d.expires_on), 'YYYY-MM-DD') FROM driver_documents d
+		         WHERE d.driver_id = dr.id AND d.type = r.type),
+		        a.device_id, (SELECT v.plate FROM vehicles v WHERE v.id = a.vehicle_id)
+		 FROM driver dr
+		 CROSS JOIN unnest($2::text[]) AS r(type)
+		 LEFT JOIN driver_assignments a ON a.driver_id = dr.id AND a.ended_at IS NULL
+		 WHERE dr.org_id = $1 AND NOT EXISTS (
+		   SELECT 1 FROM driver_documents d
+		   WHERE d.driver_id = dr.id AND d.type = r.type AND `+validDocument+`)
+		 ORDER BY dr.name, dr.id, r.type`, orgOf(c), documents.Required)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving drivers"})
+	}
+	defer rows.Close()
+
+	drivers := []models.DriverClearance{}
+	for rows.Next() {
+		var d models.DriverClearance
+		var docType string
+		var expired *string
+		if err := rows.Scan(&d.DriverId, &d.Name, &d.Phone, &docType, &expired, &d.DeviceId, &d.Plate); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error scanning driver"})
+		}
+		reason := "no valid " + strings.ReplaceAll(docType, "_", " ")
+		if expired != nil {
+			reason += ", the latest expires on " + *expired
+		}
+		if n := len(drivers); n > 0 && drivers[n-1].DriverId == d.DriverId {
+			drivers[n-1].Reasons = append(drivers[n-1].Reasons, reason)
+			continue
+		}
+		d.Reasons = []string{reason}
+		drivers = append(drivers, d)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error processing drivers"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(drivers)
+}
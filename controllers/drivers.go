@@ -2,15 +2,26 @@ package controllers
 
 import (
 	"context"
+	"log"
 	"strconv"
 	"time"
 	"tm/database"
+	"tm/documents"
 	"tm/models"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v4"
 )
 
+// driverColumns lists the columns scanned into models.Driver, in order.
+const driverColumns = "id, create_time, name, phone, country"
+
+func scanDriver(row pgx.Row) (models.Driver, error) {
+	var driver models.Driver
+	err := row.Scan(&driver.ID, &driver.CreateTime, &driver.Name, &driver.Phone, &driver.Country)
+	return driver, err
+}
+
 // @Summary Get all drivers
 // @Description Get all devices
 // @Tags Drivers
@@ -19,7 +30,7 @@ import (
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/driver/all_driver [get]
 func GetAllDrivers(c *fiber.Ctx) error {
-	rows, err := database.DBpool.Query(context.Background(), "SELECT * FROM driver")
+	rows, err := database.DBpool.Query(context.Background(), "SELECT "+driverColumns+" FROM driver WHERE org_id = $1", orgOf(c))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(err.Error())
 	}
@@ -27,7 +38,7 @@ func GetAllDrivers(c *fiber.Ctx) error {
 	var drivers []models.Driver
 	for rows.Next() {
 		var driver models.Driver
-		err := rows.Scan(&driver.ID, &driver.CreateTime, &driver.Name, &driver.Phone, &driver.CarNumber, &driver.CarModel, &driver.Weight, &driver.Country)
+		err := rows.Scan(&driver.ID, &driver.CreateTime, &driver.Name, &driver.Phone, &driver.Country)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(err.Error())
 		}
@@ -48,9 +59,7 @@ func GetAllDrivers(c *fiber.Ctx) error {
 // @Router /api/driver/get_driver/{id} [get]
 func GetDriverById(c *fiber.Ctx) error {
 	id := c.Params("id")
-	row := database.DBpool.QueryRow(context.Background(), "SELECT * FROM driver WHERE id = $1", id)
-	var driver models.Driver
-	err := row.Scan(&driver.ID, &driver.CreateTime, &driver.Name, &driver.Phone, &driver.CarNumber, &driver.CarModel, &driver.Weight, &driver.Country)
+	driver, err := scanDriver(database.DBpool.QueryRow(context.Background(), "SELECT "+driverColumns+" FROM driver WHERE id = $1 AND org_id = $2", id, orgOf(c)))
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return c.Status(fiber.StatusNotFound).SendString(err.Error())
@@ -87,20 +96,28 @@ func CreateDriver(c *fiber.Ctx) error {
 
 	// Insert the new driver into the database
 	query := `
-        INSERT INTO driver (create_time, name, phone, car_number, car_model, weight, country) 
-        VALUES ($1, $2, $3, $4, $5, $6, $7) 
+        INSERT INTO driver (create_time, name, phone, country, org_id) 
+        VALUES ($1, $2, $3, $4, $5) 
         RETURNING id`
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to insert driver into database",
+			"message": err.Error(),
+		})
+	}
+	defer tx.Rollback(ctx)
+
 	var driverID int
-	err := database.DBpool.QueryRow(
-		context.Background(),
+	err = tx.QueryRow(
+		ctx,
 		query,
 		driver.CreateTime,
 		driver.Name,
 		driver.Phone,
-		driver.CarNumber,
-		driver.CarModel,
-		driver.Weight,
-		driver.Country).Scan(&driverID)
+		driver.Country,
+		orgOf(c)).Scan(&driverID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   "failed to insert driver into database",
@@ -110,6 +127,18 @@ func CreateDriver(c *fiber.Ctx) error {
 
 	// Set the new driver's ID
 	driver.ID = driverID
+	if err := recordAudit(c, tx, "driver.create", "driver", driver.ID, nil, driver); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to insert driver into database",
+			"message": err.Error(),
+		})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to insert driver into database",
+			"message": err.Error(),
+		})
+	}
 
 	// Return the newly created driver
 	return c.Status(fiber.StatusCreated).JSON(driver)
@@ -134,21 +163,44 @@ func DeleteDriver(c *fiber.Ctx) error {
 		})
 	}
 
-	query := `DELETE FROM driver WHERE id = $1`
-	result, err := database.DBpool.Exec(context.Background(), query, id)
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   "failed to delete driver from database",
 			"message": err.Error(),
 		})
 	}
+	defer tx.Rollback(ctx)
 
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
+	query := `DELETE FROM driver WHERE id = $1 AND org_id = $2 RETURNING ` + driverColumns
+	deleted, err := scanDriver(tx.QueryRow(ctx, query, id, orgOf(c)))
+	if err == pgx.ErrNoRows {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "driver not found",
 		})
 	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to delete driver from database",
+			"message": err.Error(),
+		})
+	}
+	if err := recordAudit(c, tx, "driver.delete", "driver", deleted.ID, deleted, nil); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to delete driver from database",
+			"message": err.Error(),
+		})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to delete driver from database",
+			"message": err.Error(),
+		})
+	}
+	if err := documents.RemoveDriver(orgOf(c), deleted.ID); err != nil {
+		log.Println("Error removing driver document scans:", err)
+	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Deleted successfully",
@@ -187,21 +239,43 @@ func UpdateDriver(c *fiber.Ctx) error {
 	// Set the ID from the URL parameter
 	driver.ID, _ = strconv.Atoi(id)
 
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to update driver in database",
+			"message": err.Error(),
+		})
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := scanDriver(tx.QueryRow(ctx, "SELECT "+driverColumns+" FROM driver WHERE id = $1 AND org_id = $2 FOR UPDATE", driver.ID, orgOf(c)))
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "driver not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to update driver in database",
+			"message": err.Error(),
+		})
+	}
+	driver.CreateTime = before.CreateTime
+
 	// Update the driver's details in the database
 	query := `
         UPDATE driver 
-        SET name = $1, phone = $2, car_number = $3, car_model = $4, weight = $5, country = $6
-        WHERE id = $7`
-	result, err := database.DBpool.Exec(
-		context.Background(),
+        SET name = $1, phone = $2, country = $3
+        WHERE id = $4 AND org_id = $5`
+	result, err := tx.Exec(
+		ctx,
 		query,
 		driver.Name,
 		driver.Phone,
-		driver.CarNumber,
-		driver.CarModel,
-		driver.Weight,
 		driver.Country,
 		driver.ID,
+		orgOf(c),
 	)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -217,6 +291,19 @@ func UpdateDriver(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := recordAudit(c, tx, "driver.update", "driver", driver.ID, before, driver); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to update driver in database",
+			"message": err.Error(),
+		})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "failed to update driver in database",
+			"message": err.Error(),
+		})
+	}
+
 	// Return the updated driver
 	return c.Status(fiber.StatusOK).JSON(driver)
 }
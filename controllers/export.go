@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"mime"
+	"tm/database"
+	"tm/export"
+	"tm/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+// @Summary Export device track
+// @Description Export the locations of a device over a time range as GPX 1.1, KML or GeoJSON. Detected events are included as waypoints / point features. The file is streamed.
+// @Tags Devices
+// @Produce application/gpx+xml
+// @Produce application/vnd.google-earth.kml+xml
+// @Produce application/geo+json
+// @Param id path string true "Device ID"
+// @Param format query string true "gpx, kml or geojson"
+// @Param from query int false "Start of the range (unix seconds)"
+// @Param to query int false "End of the range (unix seconds)"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Device not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/device/export/{id} [get]
+func ExportDeviceTrack(c *fiber.Ctx) error {
+	deviceId := c.Params("id")
+
+	format, ok := export.Formats[c.Query("format")]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "format must be gpx, kml or geojson"})
+	}
+	from, to, err := timeRange(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Events are few and must precede the track in GPX, so load them up front.
+	events, err := deviceEvents(context.Background(), deviceId, from, to)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving events"})
+	}
+
+	// Errors of the query itself still get a proper response; once the
+	// file is being sent, a failure can only cut it off.
+	rows, err := database.DBpool.Query(context.Background(),
+		"SELECT timestamp, latitude, longitude, speed FROM device_locations WHERE device_id=$1 AND timestamp BETWEEN $2 AND $3 ORDER BY timestamp",
+		deviceId, from, to)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving locations"})
+	}
+
+	c.Set(fiber.HeaderContentType, format.ContentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": deviceId + "." + format.Extension}))
+
+	// A failure closes the pipe with an error, so the chunked response ends
+	// without its last chunk and the client sees an incomplete transfer
+	// instead of a truncated file.
+	pr, pw := io.Pipe()
+	go func() {
+		defer rows.Close()
+		w := bufio.NewWriter(pw)
+		err := streamTrack(format.New(w), "Device "+deviceId, events, rows)
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			log.Println("Error exporting track:", err)
+		}
+		pw.CloseWithError(err)
+	}()
+	c.Context().SetBodyStream(pr, -1)
+	return nil
+}
+
+// streamTrack writes the locations of a device row by row as they are read.
+func streamTrack(w export.Writer, name string, events []models.Event, rows pgx.Rows) error {
+	if err := w.Begin(name, events); err != nil {
+		return err
+	}
+	for rows.Next() {
+		var location models.DeviceLocation
+		if err := rows.Scan(&location.Timestamp, &location.Latitude, &location.Longitude, &location.Speed); err != nil {
+			return err
+		}
+		if err := w.Point(location); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return w.End()
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"context"
+	"tm/database"
+	"tm/geocoder"
+	"tm/models"
+)
+
+// lastPositionQuery joins every device with its latest fix from the
+// device_last_position projection, which a trigger on device_locations keeps
+// current, and with its current driver. One round trip replaces a query per
+// device.
+const lastPositionQuery = `
+	SELECT d.device_id, d.org_id, d.battery_level, d.signal_status, d.is_locked, d.status,
+	       p.timestamp, p.latitude, p.longitude, p.speed, ` + currentDriverColumns + `
+	FROM devices d
+	LEFT JOIN device_last_position p ON p.device_id = d.device_id
+	` + currentDriverJoin + `
+	WHERE ` + deviceScopeFilter + `
+	ORDER BY d.device_id`
+
+// fetchDevicesWithLastPosition returns the devices in a scope with their
+// latest location, or a nil Location for devices that never reported one.
+func fetchDevicesWithLastPosition(ctx context.Context, scope deviceScope) ([]models.DeviceAll, error) {
+	rows, err := database.DBpool.Query(ctx, lastPositionQuery, scope.orgId, scope.devices)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []models.DeviceAll
+	for rows.Next() {
+		var device models.DeviceAll
+		var timestamp *int64
+		var latitude, longitude, speed *float64
+		var driver currentDriver
+		err := rows.Scan(&device.DeviceId, &device.OrgId, &device.BatteryLevel, &device.SignalStatus, &device.IsLocked, &device.Status,
+			&timestamp, &latitude, &longitude, &speed, &driver.id, &driver.name, &driver.phone)
+		if err != nil {
+			return nil, err
+		}
+		device.Driver = driver.model()
+		if timestamp != nil {
+			device.Location = &models.DeviceLocation{Timestamp: *timestamp, Latitude: *latitude, Longitude: *longitude, Speed: speed}
+			device.Address = geocoder.Describe(*latitude, *longitude)
+		}
+		devices = append(devices, device)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// toDeviceSchemas converts devices to the response shape that carries an
+// empty location instead of a nil one.
+func toDeviceSchemas(devices []models.DeviceAll) []models.DeviceSchema {
+	schemas := make([]models.DeviceSchema, 0, len(devices))
+	for _, d := range devices {
+		schema := models.DeviceSchema{
+			DeviceId:     d.DeviceId,
+			BatteryLevel: d.BatteryLevel,
+			SignalStatus: d.SignalStatus,
+			IsLocked:     d.IsLocked,
+			Status:       d.Status,
+			Address:      d.Address,
+			Driver:       d.Driver,
+		}
+		if d.Location != nil {
+			schema.Location = *d.Location
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas
+}
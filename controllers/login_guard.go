@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"time"
+	"tm/database"
+	"tm/loginguard"
+	"tm/rbac"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxLoginFailures = 1000
+
+// @Summary Unlock user
+// @Description Lift the lockout of a user locked after too many failed logins
+// @Tags Admin
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{} "Unlocked"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 403 {object} map[string]interface{} "The user's role has a permission the caller lacks"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/unlock/{id} [post]
+func UnlockUser(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+	}
+	if ok, resp := checkTarget(c, id); !ok {
+		return resp
+	}
+
+	ctx := context.Background()
+	var username string
+	err = database.DBpool.QueryRow(ctx, "SELECT username FROM users WHERE id=$1", id).Scan(&username)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unlock user", "message": err.Error()})
+	}
+
+	if err := loginguard.Default.Unlock(ctx, username); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unlock user", "message": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Unlocked"})
+}
+
+// @Summary Get failed logins
+// @Description List failed logins of the organization's users, newest first. Holders of org:manage also see failures for unknown usernames.
+// @Tags Admin
+// @Produce json
+// @Param username query string false "Only this username"
+// @Param ip query string false "Only this client IP"
+// @Param from query int false "Start of the range (unix seconds)"
+// @Param to query int false "End of the range (unix seconds)"
+// @Param limit query int false "Maximum number of records (default and max 1000)"
+// @Success 200 {array} loginguard.Failure
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/login_failures [get]
+func GetLoginFailures(c *fiber.Ctx) error {
+	q := loginguard.FailureQuery{
+		OrgID:          orgOf(c),
+		IncludeUnknown: rbac.Can(roleOf(c), rbac.OrgManage),
+		Username:       c.Query("username"),
+		IP:             c.Query("ip"),
+		Limit:          maxLoginFailures,
+	}
+	from, to, err := timeRange(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if c.Query("from") != "" {
+		q.From = time.Unix(from, 0)
+	}
+	if c.Query("to") != "" {
+		q.To = time.Unix(to, 0)
+	}
+	if v := c.Query("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 || q.Limit > maxLoginFailures {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and 1000"})
+		}
+	}
+
+	failures, err := loginguard.Default.Store.Failures(context.Background(), q)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving failed logins"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(failures)
+}
@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"tm/database"
+	"tm/loginguard"
+	"tm/models"
+	"tm/rbac"
+	"tm/sessions"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+
+	// Timezones are checked with time.LoadLocation, which needs the zone
+	// database also where the system has none.
+	_ "time/tzdata"
+)
+
+const maxDisplayName = 100
+
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+type ChangePasswordInput struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+// MySession is a session of the caller, marking the one the request was
+// made with.
+type MySession struct {
+	sessions.Session
+	Current bool `json:"current"`
+}
+
+// sessionOf returns the ID of the session the request was made with.
+func sessionOf(c *fiber.Ctx) string {
+	claims, _ := c.Locals("claims").(jwt.MapClaims)
+	sid, _ := claims["sid"].(string)
+	return sid
+}
+
+// @Summary Get own profile
+// @Description The account of the caller with their settings and permissions
+// @Tags User
+// @Produce json
+// @Success 200 {object} models.Profile
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me [get]
+func GetProfile(c *fiber.Ctx) error {
+	var p models.Profile
+	err := database.DBpool.QueryRow(context.Background(),
+		`SELECT id, username, role, org_id, display_name, language, timezone, totp_enabled
+		 FROM users WHERE id=$1`, userOf(c),
+	).Scan(&p.Id, &p.Username, &p.Role, &p.OrgId, &p.DisplayName, &p.Language, &p.Timezone, &p.TwoFactor)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to look up user"})
+	}
+
+	p.Permissions = rbac.Permissions(p.Role)
+	sort.Strings(p.Permissions)
+	return c.JSON(p)
+}
+
+// @Summary Update own profile
+// @Description Change the display name, language (BCP 47 tag such as "tk" or "en-US") or timezone (IANA name such as "Asia/Ashgabat"). Fields left out are not changed.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param input body models.ProfileUpdate true "Settings"
+// @Success 200 {object} models.Profile
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me/update [put]
+func UpdateProfile(c *fiber.Ctx) error {
+	input := new(models.ProfileUpdate)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if input.DisplayName != nil {
+		*input.DisplayName = strings.TrimSpace(*input.DisplayName)
+		if len([]rune(*input.DisplayName)) > maxDisplayName {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "display name must be at most 100 characters"})
+		}
+	}
+	if input.Language != nil && !languagePattern.MatchString(*input.Language) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "language must be a language tag such as en or en-US"})
+	}
+	if input.Timezone != nil {
+		if _, err := time.LoadLocation(*input.Timezone); err != nil || *input.Timezone == "" || *input.Timezone == "Local" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown timezone"})
+		}
+	}
+
+	_, err := database.DBpool.Exec(context.Background(),
+		`UPDATE users SET display_name = COALESCE($1, display_name),
+		                  language     = COALESCE($2, language),
+		                  timezone     = COALESCE($3, timezone)
+		 WHERE id = $4`,
+		input.DisplayName, input.Language, input.Timezone, userOf(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update profile", "message": err.Error()})
+	}
+
+	return GetProfile(c)
+}
+
+// @Summary Change own password
+// @Description Change the caller's password after checking the current one. The new one must meet the password policy. Every other session of the caller is ended.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param input body ChangePasswordInput true "Old and new password"
+// @Success 200 {object} map[string]interface{} "Password changed"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Wrong password"
+// @Failure 429 {object} map[string]interface{} "Too many failed attempts"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me/password [post]
+func ChangePassword(c *fiber.Ctx) error {
+	input := new(ChangePasswordInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if input.NewPassword == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "new password is required"})
+	}
+
+	ctx := context.Background()
+	var user models.User
+	err := database.DBpool.QueryRow(ctx, "SELECT id, username, password, org_id FROM users WHERE id=$1", userOf(c)).Scan(&user.Id, &user.Username, &user.Password, &user.OrgId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to look up user"})
+	}
+
+	// A stolen session must not be a way around the login guard
+	guard := loginguard.Default
+	attempt, err := guard.Begin(ctx, user.Username, c.IP())
+	if err != nil {
+		return tooManyAttempts(c, err)
+	}
+	if !checkPasswordHash(input.OldPassword, user.Password) {
+		err := attempt.Failed(ctx, loginguard.Failure{
+			Username:  user.Username,
+			IP:        c.IP(),
+			UserAgent: c.Get(fiber.HeaderUserAgent),
+			Reason:    loginguard.ReasonBadPassword,
+			OrgID:     &user.OrgId,
+		})
+		if err != nil {
+			log.Println("Error recording failed login:", err)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Wrong password"})
+	}
+	if err := attempt.Passed(ctx); err != nil {
+		log.Println("Error releasing login attempt:", err)
+	}
+
+	hashed, resp := hashNewPassword(c, user.Id, user.Username, input.NewPassword)
+	if hashed == "" {
+		return resp
+	}
+	if _, err := database.DBpool.Exec(ctx, "UPDATE users SET password=$1 WHERE id=$2", hashed, user.Id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to change password", "message": err.Error()})
+	}
+	recordPassword(user.Id, hashed)
+
+	if _, err := sessions.RevokeUserExcept(ctx, user.Id, sessionOf(c)); err != nil {
+		log.Println("Error revoking sessions:", err)
+	}
+	return c.JSON(fiber.Map{"message": "Password changed"})
+}
+
+// @Summary Get own sessions
+// @Description The caller's active sessions, most recently used first
+// @Tags User
+// @Produce json
+// @Success 200 {array} MySession
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me/sessions [get]
+func GetMySessions(c *fiber.Ctx) error {
+	list, err := sessions.List(context.Background(), userOf(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving sessions"})
+	}
+
+	current := sessionOf(c)
+	mine := make([]MySession, len(list))
+	for i, s := range list {
+		mine[i] = MySession{Session: s, Current: s.ID == current}
+	}
+	return c.JSON(mine)
+}
+
+// @Summary Revoke own session
+// @Description End one of the caller's sessions, for example on a lost device. Ending the current one logs out.
+// @Tags User
+// @Param id path string true "Session ID"
+// @Success 200 {object} map[string]interface{} "Revoked"
+// @Failure 404 {object} map[string]interface{} "Session not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me/sessions/{id} [delete]
+func RevokeMySession(c *fiber.Ctx) error {
+	id := c.Params("id")
+	ok, err := sessions.RevokeOwn(context.Background(), id, userOf(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to end session"})
+	}
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+	}
+	if id == sessionOf(c) {
+		clearTokenCookies(c)
+	}
+
+	return c.JSON(fiber.Map{"message": "Revoked"})
+}
+
+// @Summary Revoke other sessions
+// @Description End every session of the caller except the current one
+// @Tags User
+// @Success 200 {object} map[string]interface{} "Number of revoked sessions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me/sessions [delete]
+func RevokeOtherSessions(c *fiber.Ctx) error {
+	n, err := sessions.RevokeUserExcept(context.Background(), userOf(c), sessionOf(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to end sessions"})
+	}
+
+	return c.JSON(fiber.Map{"revoked": n})
+}
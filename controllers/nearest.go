@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"tm/database"
+	"tm/documents"
+	"tm/geo"
+	"tm/geocoder"
+	"tm/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	positionCellSize   = 0.1 // degrees, about 11 km
+	maxNearestRings    = 50
+	defaultNearestK    = 10
+	maxNearestResults  = 500
+	maxNearestRadiusKm = 20000
+)
+
+// The latest fix of every device, indexed by location for the nearest-device
+// search. It is warmed on startup and kept current by ingest and by the
+// database notifications handled in ListenForUpdates.
+var (
+	positions    = make(map[string]models.DeviceLocation)
+	positionGrid = geo.NewGrid[string](positionCellSize)
+	positionsMu  sync.RWMutex
+)
+
+// LoadPositions fills the position index with the latest fix of each device.
+func LoadPositions() error {
+	rows, err := database.DBpool.Query(context.Background(),
+		"SELECT device_id, timestamp, latitude, longitude, speed FROM device_last_position")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var deviceId string
+		var fix models.DeviceLocation
+		if err := rows.Scan(&deviceId, &fix.Timestamp, &fix.Latitude, &fix.Longitude, &fix.Speed); err != nil {
+			return err
+		}
+		updatePosition(deviceId, fix)
+	}
+	return rows.Err()
+}
+
+// updatePosition moves a device in the position index if fix is newer than
+// the one it holds.
+func updatePosition(deviceId string, fix models.DeviceLocation) {
+	positionsMu.Lock()
+	defer positionsMu.Unlock()
+
+	if old, ok := positions[deviceId]; ok {
+		if old.Timestamp > fix.Timestamp {
+			return
+		}
+		positionGrid.Remove(deviceId, old.Latitude, old.Longitude)
+	}
+	positions[deviceId] = fix
+	positionGrid.Add(deviceId, fix.Latitude, fix.Longitude)
+}
+
+type nearestQuery struct {
+	lat, lon float64
+	radius   float64 // meters, 0 means unbounded
+	k        int
+}
+
+type candidate struct {
+	deviceId string
+	fix      models.DeviceLocation
+	distance float64
+}
+
+// nearestPositions returns up to q.k devices from allowed ordered by distance
+// from the query point, limited to q.radius when it is set.
+func nearestPositions(q nearestQuery, allowed map[string]bool) []candidate {
+	positionsMu.RLock()
+	defer positionsMu.RUnlock()
+
+	var found []candidate
+	seen := make(map[string]bool)
+	visit := func(deviceId string) {
+		if seen[deviceId] || !allowed[deviceId] {
+			return
+		}
+		seen[deviceId] = true
+		fix := positions[deviceId]
+		d := geo.Distance(q.lat, q.lon, fix.Latitude, fix.Longitude)
+		if q.radius > 0 && d > q.radius {
+			return
+		}
+		found = append(found, candidate{deviceId: deviceId, fix: fix, distance: d})
+	}
+
+	complete := false
+	for r := 0; r <= maxNearestRings; r++ {
+		bound := positionGrid.RingDistance(q.lat, r)
+		if q.radius > 0 && bound > q.radius {
+			complete = true
+			break
+		}
+		if len(found) >= q.k {
+			sort.Slice(found, func(i, j int) bool { return found[i].distance < found[j].distance })
+			if found[q.k-1].distance < bound {
+				complete = true
+				break
+			}
+		}
+		positionGrid.Ring(q.lat, q.lon, r, visit)
+	}
+
+	// Sparse fleets spread over a continent can outrun the ring limit; the
+	// remaining devices are few enough to check directly.
+	if !complete {
+		for deviceId := range positions {
+			visit(deviceId)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].distance < found[j].distance })
+	if len(found) > q.k {
+		found = found[:q.k]
+	}
+	return found
+}
+
+// @Summary Find nearest devices
+// @Description Find the devices whose latest fix is closest to a point, ranked by distance, within a radius and/or limited to the k nearest
+// @Tags Devices
+// @Produce json
+// @Param lat query number true "Latitude of the point"
+// @Param lon query number true "Longitude of the point"
+// @Param radius query number false "Search radius in meters"
+// @Param k query int false "Maximum number of devices to return (default 10)"
+// @Param status query string false "Only devices with this status"
+// @Param locked query bool false "Only locked (true) or unlocked (false) devices"
+// @Param with_driver query bool false "Only devices driven by a driver allowed to drive (true), or only devices without one (false)"
+// @Success 200 {array} models.NearbyDevice
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/device/nearest [get]
+func GetNearestDevices(c *fiber.Ctx) error {
+	var q nearestQuery
+	var err error
+	if q.lat, err = strconv.ParseFloat(c.Query("lat"), 64); err != nil || q.lat < -90 || q.lat > 90 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "lat must be a latitude in degrees"})
+	}
+	if q.lon, err = strconv.ParseFloat(c.Query("lon"), 64); err != nil || q.lon < -180 || q.lon > 180 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "lon must be a longitude in degrees"})
+	}
+	if v := c.Query("radius"); v != "" {
+		if q.radius, err = strconv.ParseFloat(v, 64); err != nil || q.radius <= 0 || q.radius > maxNearestRadiusKm*1000 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "radius must be a positive number of meters"})
+		}
+	}
+	q.k = defaultNearestK
+	if q.radius > 0 {
+		q.k = maxNearestResults
+	}
+	if v := c.Query("k"); v != "" {
+		if q.k, err = strconv.Atoi(v); err != nil || q.k <= 0 || q.k > maxNearestResults {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "k must be between 1 and 500"})
+		}
+	}
+
+	var locked *bool
+	if v := c.Query("locked"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "locked must be true or false"})
+		}
+		locked = &b
+	}
+	var withDriver *bool
+	if v := c.Query("with_driver"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "with_driver must be true or false"})
+		}
+		withDriver = &b
+	}
+
+	scope, err := scopeOf(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving devices"})
+	}
+
+	rows, err := database.DBpool.Query(context.Background(),
+		`SELECT d.device_id, d.battery_level, d.signal_status, d.is_locked, d.status, `+currentDriverColumns+`
+		 FROM devices d `+currentDriverJoin+`
+		 WHERE `+deviceScopeFilter+` AND ($3 = '' OR d.status = $3) AND ($4::boolean IS NULL OR d.is_locked = $4)
+		   AND ($5::boolean IS NULL OR (cdr.id IS NOT NULL AND `+driverAllowed("cdr.id", "$6")+`) = $5)`,
+		scope.orgId, scope.devices, c.Query("status"), locked, withDriver, documents.Required)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving devices"})
+	}
+	defer rows.Close()
+
+	devices := make(map[string]models.DeviceSchema)
+	allowed := make(map[string]bool)
+	for rows.Next() {
+		var device models.DeviceSchema
+		var driver currentDriver
+		if err := rows.Scan(&device.DeviceId, &device.BatteryLevel, &device.SignalStatus, &device.IsLocked, &device.Status,
+			&driver.id, &driver.name, &driver.phone); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error scanning device"})
+		}
+		device.Driver = driver.model()
+		devices[device.DeviceId] = device
+		allowed[device.DeviceId] = true
+	}
+	if err = rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error processing devices"})
+	}
+
+	result := []models.NearbyDevice{}
+	for _, cand := range nearestPositions(q, allowed) {
+		device := devices[cand.deviceId]
+		device.Location = cand.fix
+		device.Address = geocoder.Describe(cand.fix.Latitude, cand.fix.Longitude)
+		result = append(result, models.NearbyDevice{
+			DeviceSchema: device,
+			Distance:     math.Round(cand.distance),
+			Bearing:      math.Round(geo.Bearing(q.lat, q.lon, cand.fix.Latitude, cand.fix.Longitude)),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+// refreshPositions feeds the latest fixes fetched for the WebSocket broadcast
+// into the position index, which covers fixes written by other services.
+func refreshPositions(devices []models.DeviceAll) {
+	for _, d := range devices {
+		if d.Location != nil {
+			updatePosition(d.DeviceId, *d.Location)
+		}
+	}
+}
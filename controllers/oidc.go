@@ -0,0 +1,398 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+	"tm/config"
+	"tm/database"
+	"tm/models"
+	"tm/oidc"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// oidcLoginTTL is how long a user has to log in at the provider.
+	oidcLoginTTL = 10 * time.Minute
+
+	// noPassword is stored for users created by single sign-on. It is no
+	// bcrypt hash, so no password matches it.
+	noPassword = "!"
+
+	// oidcStateCookie ties a login to the browser that started it, so a
+	// link to the provider cannot be passed to someone else to finish.
+	oidcStateCookie = "oidc_state"
+)
+
+// ssoProvider returns the configured provider, answering the request itself
+// if there is none.
+func ssoProvider(c *fiber.Ctx) (*oidc.Provider, error) {
+	if oidc.Default == nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Single sign-on is not configured"})
+	}
+	return oidc.Default, nil
+}
+
+// beginOIDC stores a new login at the provider, for linkUserId if that is
+// not nil, and returns the URL to send the browser to.
+func beginOIDC(c *fiber.Ctx, p *oidc.Provider, linkUserId *int) (string, error) {
+	var values [3]string
+	for i := range values {
+		v, err := oidc.RandomString()
+		if err != nil {
+			return "", err
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	ctx := context.Background()
+	if _, err := database.DBpool.Exec(ctx, "DELETE FROM oidc_logins WHERE expires_at < now()"); err != nil {
+		return "", err
+	}
+	_, err := database.DBpool.Exec(ctx,
+		"INSERT INTO oidc_logins (state, verifier, nonce, link_user_id, expires_at) VALUES ($1, $2, $3, $4, $5)",
+		state, verifier, nonce, linkUserId, time.Now().Add(oidcLoginTTL))
+	if err != nil {
+		return "", err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/oidc",
+		Expires:  time.Now().Add(oidcLoginTTL),
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return p.AuthURL(ctx, state, nonce, verifier)
+}
+
+// finishOIDC answers the callback once the browser is done: it goes on to
+// the configured page, or gets body as JSON. A pre-auth token is passed to
+// the page in the URL fragment, which browsers do not send to servers, for
+// it to finish the login with the user's code.
+func finishOIDC(c *fiber.Ctx, body fiber.Map) error {
+	c.Cookie(&fiber.Cookie{Name: oidcStateCookie, Path: "/api/oidc", Expires: time.Unix(0, 0), HTTPOnly: true})
+	if u := config.C.OIDC.PostLoginURL; u != "" {
+		if token, ok := body["pre_auth_token"].(string); ok {
+			purpose, _ := body["two_factor"].(string)
+			u += "#" + url.Values{"two_factor": {purpose}, "pre_auth_token": {token}}.Encode()
+		}
+		return c.Redirect(u, fiber.StatusFound)
+	}
+	return c.JSON(body)
+}
+
+// ssoSecondFactor returns the pre-auth purpose a user who logged in at the
+// provider still has to pass here, like after a password, or "" if the ID
+// token shows the provider checked a second factor itself.
+func ssoSecondFactor(u twoFactorUser, id oidc.Identity) string {
+	switch {
+	case id.MFA:
+		return ""
+	case u.enabled:
+		return preAuthCode
+	case u.required:
+		return preAuthSetup
+	}
+	return ""
+}
+
+// ssoUser finds the user of an identity, creating them if provisioning is
+// on, and applies the role the provider gives them. It returns a zero user
+// after answering the request itself.
+func ssoUser(c *fiber.Ctx, p *oidc.Provider, id oidc.Identity) (models.User, error) {
+	ctx := context.Background()
+	role := p.Role(id)
+
+	var user models.User
+	var active bool
+	err := database.DBpool.QueryRow(ctx,
+		`SELECT u.id, u.username, u.role, u.org_id, u.active
+		 FROM user_identities i JOIN users u ON u.id = i.user_id
+		 WHERE i.issuer = $1 AND i.subject = $2`, id.Issuer, id.Subject,
+	).Scan(&user.Id, &user.Username, &user.Role, &user.OrgId, &active)
+	if err == pgx.ErrNoRows {
+		return provisionUser(c, id, role)
+	}
+	if err != nil {
+		return models.User{}, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to look up user"})
+	}
+	if !active {
+		return models.User{}, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Account is disabled"})
+	}
+
+	_, err = database.DBpool.Exec(ctx,
+		"UPDATE user_identities SET last_login_at = now(), email = COALESCE(NULLIF($1, ''), email) WHERE issuer = $2 AND subject = $3",
+		id.Email, id.Issuer, id.Subject)
+	if err != nil {
+		log.Println("Error recording single sign-on:", err)
+	}
+
+	// The provider decides the role of users it maps; others keep theirs
+	if role != "" && role != user.Role {
+		result, err := database.DBpool.Exec(ctx,
+			"UPDATE users SET role = $1 WHERE id = $2 AND EXISTS (SELECT 1 FROM roles WHERE name = $1)", role, user.Id)
+		if err != nil {
+			return models.User{}, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update role"})
+		}
+		if result.RowsAffected() == 1 {
+			revokeUserSessions(user.Id)
+			user.Role = role
+		} else {
+			log.Printf("Single sign-on maps %s to unknown role %s\n", user.Username, role)
+		}
+	}
+	return user, nil
+}
+
+// provisionUser creates the user for an identity no one has linked yet.
+func provisionUser(c *fiber.Ctx, id oidc.Identity, role string) (models.User, error) {
+	cfg := config.C.OIDC
+	if !cfg.Provision {
+		return models.User{}, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "No account is linked to this identity. Log in with your password and link it first."})
+	}
+	if role == "" {
+		return models.User{}, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Your account at the identity provider has no role here"})
+	}
+	username := id.Username
+	if username == "" {
+		username = id.Email
+	}
+	if username == "" {
+		return models.User{}, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "The identity provider sent no username"})
+	}
+
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return models.User{}, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create user"})
+	}
+	defer tx.Rollback(ctx)
+
+	user := models.User{Username: username, Role: role, OrgId: cfg.OrgID}
+	err = tx.QueryRow(ctx,
+		`INSERT INTO users (username, password, role, org_id, full_name, email)
+		 VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+		 ON CONFLICT (username) DO NOTHING RETURNING id`,
+		username, noPassword, role, cfg.OrgID, id.Name, id.Email).Scan(&user.Id)
+	if err == pgx.ErrNoRows {
+		return models.User{}, c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "An account named " + username + " already exists. Log in with its password and link your identity to it."})
+	}
+	if err != nil {
+		return models.User{}, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create user", "message": err.Error()})
+	}
+	_, err = tx.Exec(ctx,
+		"INSERT INTO user_identities (user_id, issuer, subject, email, last_login_at) VALUES ($1, $2, $3, NULLIF($4, ''), now())",
+		user.Id, id.Issuer, id.Subject, id.Email)
+	if err != nil {
+		return models.User{}, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create user", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return models.User{}, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create user"})
+	}
+	log.Printf("Single sign-on created user %s (%s) with role %s\n", username, id.Subject, role)
+	return user, nil
+}
+
+// @Summary Single sign-on login
+// @Description Send the browser to the OpenID Connect provider to log in. It comes back to /api/oidc/callback.
+// @Tags User
+// @Success 302 "Redirect to the provider"
+// @Failure 404 {object} map[string]interface{} "Single sign-on is not configured"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/oidc/login [get]
+func OIDCLogin(c *fiber.Ctx) error {
+	p, resp := ssoProvider(c)
+	if p == nil {
+		return resp
+	}
+
+	u, err := beginOIDC(c, p, nil)
+	if err != nil {
+		log.Println("Error starting single sign-on:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reach the identity provider"})
+	}
+	return c.Redirect(u, fiber.StatusFound)
+}
+
+// @Summary Single sign-on callback
+// @Description Where the provider sends the browser back to. Logs the user in, creating them on their first login if provisioning is on, or links the identity to the user who started /api/me/identities/link. Users who have or need two-factor authentication get a pre-auth token for /api/login/2fa like after a password, unless the ID token's amr or acr shows the provider checked a second factor. With a post-login page the pre-auth token is passed in the URL fragment.
+// @Tags User
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State"
+// @Success 200 {object} map[string]interface{} "token, pre-auth token, or a message after linking"
+// @Success 302 "Redirect to the configured page"
+// @Failure 400 {object} map[string]interface{} "Invalid or expired login"
+// @Failure 401 {object} map[string]interface{} "Login not confirmed by the provider"
+// @Failure 403 {object} map[string]interface{} "No account or role"
+// @Failure 409 {object} map[string]interface{} "Username or identity already in use"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/oidc/callback [get]
+func OIDCCallback(c *fiber.Ctx) error {
+	p, resp := ssoProvider(c)
+	if p == nil {
+		return resp
+	}
+	if e := c.Query("error"); e != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Login at the identity provider failed", "message": e + ": " + c.Query("error_description")})
+	}
+	state := c.Query("state")
+	if state == "" || c.Query("code") == "" || state != c.Cookies(oidcStateCookie) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or expired login"})
+	}
+
+	ctx := context.Background()
+	var verifier, nonce string
+	var linkUserId *int
+	var live bool
+	err := database.DBpool.QueryRow(ctx,
+		"DELETE FROM oidc_logins WHERE state = $1 RETURNING verifier, nonce, link_user_id, expires_at > now()", state,
+	).Scan(&verifier, &nonce, &linkUserId, &live)
+	if err == pgx.ErrNoRows || (err == nil && !live) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or expired login"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to finish login"})
+	}
+
+	id, err := p.Exchange(ctx, c.Query("code"), verifier, nonce)
+	if err != nil {
+		log.Println("Error finishing single sign-on:", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "The identity provider did not confirm the login"})
+	}
+
+	if linkUserId != nil {
+		var identityId int
+		err := database.DBpool.QueryRow(ctx,
+			`INSERT INTO user_identities (user_id, issuer, subject, email) VALUES ($1, $2, $3, NULLIF($4, ''))
+			 ON CONFLICT DO NOTHING RETURNING id`,
+			*linkUserId, id.Issuer, id.Subject, id.Email).Scan(&identityId)
+		if err == pgx.ErrNoRows {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "This identity is linked to another account, or yours already has one at this provider"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to link identity"})
+		}
+		return finishOIDC(c, fiber.Map{"message": "Linked"})
+	}
+
+	user, resp := ssoUser(c, p, id)
+	if user.Id == 0 {
+		return resp
+	}
+	u, err := loadTwoFactorUser(ctx, user.Id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to look up user"})
+	}
+	if purpose := ssoSecondFactor(u, id); purpose != "" {
+		response, err := preAuthResponse(user, purpose)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+		}
+		return finishOIDC(c, response)
+	}
+	response, err := openSession(c, user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create session"})
+	}
+	return finishOIDC(c, response)
+}
+
+// @Summary Get own linked identities
+// @Description The caller's accounts at the single sign-on provider
+// @Tags User
+// @Produce json
+// @Success 200 {array} models.Identity
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me/identities [get]
+func GetMyIdentities(c *fiber.Ctx) error {
+	rows, err := database.DBpool.Query(context.Background(),
+		"SELECT id, issuer, subject, email, created_at, last_login_at FROM user_identities WHERE user_id = $1 ORDER BY id", userOf(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving identities"})
+	}
+	defer rows.Close()
+
+	identities := []models.Identity{}
+	for rows.Next() {
+		var i models.Identity
+		if err := rows.Scan(&i.Id, &i.Issuer, &i.Subject, &i.Email, &i.CreatedAt, &i.LastLoginAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving identities"})
+		}
+		identities = append(identities, i)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving identities"})
+	}
+
+	return c.JSON(identities)
+}
+
+// @Summary Link identity
+// @Description Start linking the caller's account at the single sign-on provider, so they can log in with it from then on. Open the returned URL in the same browser; the provider sends it back to /api/oidc/callback.
+// @Tags User
+// @Produce json
+// @Success 200 {object} map[string]interface{} "url"
+// @Failure 404 {object} map[string]interface{} "Single sign-on is not configured"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me/identities/link [post]
+func LinkIdentity(c *fiber.Ctx) error {
+	p, resp := ssoProvider(c)
+	if p == nil {
+		return resp
+	}
+
+	userId := userOf(c)
+	u, err := beginOIDC(c, p, &userId)
+	if err != nil {
+		log.Println("Error starting single sign-on:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reach the identity provider"})
+	}
+	return c.JSON(fiber.Map{"url": u})
+}
+
+// @Summary Unlink identity
+// @Description Unlink one of the caller's accounts at the single sign-on provider. Users without a password must keep one.
+// @Tags User
+// @Param id path int true "Identity ID"
+// @Success 200 {object} map[string]interface{} "Unlinked"
+// @Failure 400 {object} map[string]interface{} "Last way to log in"
+// @Failure 404 {object} map[string]interface{} "Identity not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me/identities/{id} [delete]
+func UnlinkIdentity(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid identity id"})
+	}
+
+	result, err := database.DBpool.Exec(context.Background(),
+		`DELETE FROM user_identities i USING users u
+		 WHERE i.id = $1 AND i.user_id = $2 AND u.id = i.user_id
+		   AND (u.password <> $3 OR EXISTS (SELECT 1 FROM user_identities o WHERE o.user_id = i.user_id AND o.id <> i.id))`,
+		id, userOf(c), noPassword)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unlink identity"})
+	}
+	if result.RowsAffected() == 0 {
+		var exists bool
+		err := database.DBpool.QueryRow(context.Background(),
+			"SELECT EXISTS (SELECT 1 FROM user_identities WHERE id = $1 AND user_id = $2)", id, userOf(c)).Scan(&exists)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unlink identity"})
+		}
+		if exists {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "This is your only way to log in. Set a password first."})
+		}
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Identity not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Unlinked"})
+}
@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+	"tm/config"
+	"tm/models"
+	"tm/oidc"
+)
+
+func TestSSOSecondFactor(t *testing.T) {
+	tests := []struct {
+		name              string
+		enabled, required bool
+		mfa               bool
+		want              string
+	}{
+		{"no 2FA", false, false, false, ""},
+		{"own TOTP", true, false, false, preAuthCode},
+		{"own TOTP, required by role", true, true, false, preAuthCode},
+		{"required by role, not enrolled", false, true, false, preAuthSetup},
+		{"own TOTP, provider did MFA", true, false, true, ""},
+		{"required by role, provider did MFA", false, true, true, ""},
+	}
+	for _, tt := range tests {
+		u := twoFactorUser{enabled: tt.enabled, required: tt.required}
+		if got := ssoSecondFactor(u, oidc.Identity{MFA: tt.mfa}); got != tt.want {
+			t.Errorf("%s: ssoSecondFactor = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPreAuthToken(t *testing.T) {
+	config.C.JWT.Secret = "a test secret that is long enough to sign"
+	config.C.Login.PreAuthTTL = 5 * time.Minute
+
+	response, err := preAuthResponse(models.User{Id: 7}, preAuthCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, purpose, err := parsePreAuthToken(response["pre_auth_token"].(string))
+	if err != nil || id != 7 || purpose != preAuthCode {
+		t.Errorf("parsePreAuthToken = %d, %q, %v; want 7, %q", id, purpose, err, preAuthCode)
+	}
+
+	if _, _, err := parsePreAuthToken(response["pre_auth_token"].(string) + "x"); err == nil {
+		t.Error("a tampered pre-auth token was accepted")
+	}
+}
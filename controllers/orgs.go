@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"tm/database"
+	"tm/models"
+	"tm/sessions"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jackc/pgx/v4"
+)
+
+// allOrgs makes the queries that take an organization return rows of every
+// organization. It is only used by background work, never for a request.
+const allOrgs = 0
+
+// claimInt reads a numeric claim of the access token checked by
+// middlewares.Authenticate.
+func claimInt(c *fiber.Ctx, name string) int {
+	claims, _ := c.Locals("claims").(jwt.MapClaims)
+	v, _ := claims[name].(float64)
+	return int(v)
+}
+
+// orgOf returns the organization the caller is acting in. Every query made
+// on behalf of a request is scoped by it.
+func orgOf(c *fiber.Ctx) int {
+	return claimInt(c, "org")
+}
+
+// userOf returns the ID of the calling user.
+func userOf(c *fiber.Ctx) int {
+	return claimInt(c, "id")
+}
+
+// roleOf returns the role of the calling user.
+func roleOf(c *fiber.Ctx) string {
+	claims, _ := c.Locals("claims").(jwt.MapClaims)
+	role, _ := claims["role"].(string)
+	return role
+}
+
+// deviceInOrg reports whether a device belongs to an organization.
+func deviceInOrg(ctx context.Context, orgId int, deviceId string) (bool, error) {
+	var ok bool
+	err := database.DBpool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM devices WHERE device_id=$1 AND org_id=$2)", deviceId, orgId).Scan(&ok)
+	return ok, err
+}
+
+// RequireDevice answers 404 unless the caller may see the device in the id
+// parameter, so devices of other organizations or not assigned to the caller
+// look the same as devices that do not exist.
+func RequireDevice(c *fiber.Ctx) error {
+	scope, err := scopeOf(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving device"})
+	}
+	ok, err := canSeeDevice(context.Background(), scope, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving device"})
+	}
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "device not found"})
+	}
+	return c.Next()
+}
+
+// @Summary Get all organizations
+// @Description List the organizations using the platform
+// @Tags Admin
+// @Produce json
+// @Success 200 {array} models.Organization
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/org/all [get]
+func GetOrganizations(c *fiber.Ctx) error {
+	rows, err := database.DBpool.Query(context.Background(), "SELECT id, name, created_at FROM organizations ORDER BY id")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving organizations"})
+	}
+	defer rows.Close()
+
+	orgs := []models.Organization{}
+	for rows.Next() {
+		var o models.Organization
+		if err := rows.Scan(&o.ID, &o.Name, &o.CreatedAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error scanning organization"})
+		}
+		orgs = append(orgs, o)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving organizations"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(orgs)
+}
+
+// @Summary Create organization
+// @Description Create an organization. Its first admin is created with createuser after switching to it.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param org body models.Organization true "Organization"
+// @Success 201 {object} models.Organization
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 409 {object} map[string]interface{} "Organization already exists"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/org/create [post]
+func CreateOrganization(c *fiber.Ctx) error {
+	org := new(models.Organization)
+	if err := c.BodyParser(org); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON", "message": err.Error()})
+	}
+	org.Name = strings.TrimSpace(org.Name)
+	if org.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name is required"})
+	}
+
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create organization", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx,
+		"INSERT INTO organizations (name) VALUES ($1) ON CONFLICT (name) DO NOTHING RETURNING id, created_at",
+		org.Name).Scan(&org.ID, &org.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "organization already exists"})
+	}
+	if err == nil {
+		err = recordAudit(c, tx, "organization.create", "organization", org.ID, nil, org)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create organization", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(org)
+}
+
+// @Summary Switch organization
+// @Description Act in another organization for the rest of the session. Returns a new access token scoped to it.
+// @Tags Admin
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Success 200 {object} map[string]interface{} "token"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/org/switch/{id} [post]
+func SwitchOrganization(c *fiber.Ctx) error {
+	orgId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid organization id"})
+	}
+
+	ctx := context.Background()
+	var exists bool
+	if err := database.DBpool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM organizations WHERE id=$1)", orgId).Scan(&exists); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving organization"})
+	}
+	if !exists {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "organization not found"})
+	}
+
+	claims := c.Locals("claims").(jwt.MapClaims)
+	sid, _ := claims["sid"].(string)
+	if err := sessions.SetOrg(ctx, sid, orgId); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to switch organization"})
+	}
+	session, err := sessions.Get(ctx, sid)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "session expired"})
+	}
+
+	var user models.User
+	err = database.DBpool.QueryRow(ctx, "SELECT id, username, role, org_id FROM users WHERE id=$1", session.UserID).Scan(&user.Id, &user.Username, &user.Role, &user.OrgId)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "session expired"})
+	}
+
+	return issueTokens(c, user, session, "")
+}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"context"
+	"time"
+	"tm/archive"
+	"tm/partitions"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// @Summary Get location partitions
+// @Description List the monthly partitions of device_locations with their size and retention state, the retention policy in effect, the archived partitions and the number of fixes in the default partition, whose timestamps fall outside every monthly one
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} map[string]interface{} "policy and partitions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/partitions [get]
+func GetPartitions(c *fiber.Ctx) error {
+	ctx := context.Background()
+	parts, err := partitions.List(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving partitions"})
+	}
+	outside, err := partitions.DefaultRows(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving partitions"})
+	}
+	archived, err := archive.Entries(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving partitions"})
+	}
+
+	policy := partitions.Current
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"policy": fiber.Map{
+			"fullResolutionDays":   int(policy.FullResolution / (24 * time.Hour)),
+			"downsampleMinutes":    int(policy.DownsampleInterval / time.Minute),
+			"retentionDays":        int(policy.Retention / (24 * time.Hour)),
+			"premakeMonths":        policy.Premake,
+			"checkIntervalMinutes": int(policy.CheckInterval / time.Minute),
+		},
+		"partitions":  parts,
+		"archive":     archived,
+		"defaultRows": outside,
+	})
+}
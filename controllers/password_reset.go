@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+	"tm/config"
+	"tm/database"
+	"tm/loginguard"
+	"tm/notify"
+	"tm/passwords"
+	"tm/sessions"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+// resetCooldown is the least time between two reset messages to one user,
+// so the endpoint cannot be used to flood someone's inbox.
+const resetCooldown = time.Minute
+
+type ForgotPasswordInput struct {
+	Username string `json:"username"`
+}
+
+type ResetPasswordInput struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// hashNewPassword checks a password a user is about to get against the
+// policy and hashes it. If it is refused it answers the request itself and
+// returns "".
+func hashNewPassword(c *fiber.Ctx, userId int, username, password string) (string, error) {
+	err := passwords.Default.Check(context.Background(), userId, username, password)
+	var rejected *passwords.Rejected
+	if errors.As(err, &rejected) {
+		return "", c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": rejected.Reason})
+	}
+	if err != nil {
+		return "", c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check password"})
+	}
+
+	hashed, err := hashPassword(password)
+	if err != nil {
+		return "", c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error hashing password"})
+	}
+	return hashed, nil
+}
+
+// recordPassword adds a password just set to the user's history, logging
+// instead of failing the request that set it.
+func recordPassword(userId int, hash string) {
+	if err := passwords.Default.Record(context.Background(), userId, hash); err != nil {
+		log.Println("Error recording password history:", err)
+	}
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sendResetToken creates a reset token for a user and sends it to their
+// email address, or by SMS if they have none.
+func sendResetToken(userId int, username string, email, phone *string, ip string) {
+	ctx := context.Background()
+	msg := notify.Message{Subject: "Password reset"}
+	switch {
+	case email != nil && *email != "":
+		msg.Channel, msg.To = notify.Email, *email
+	case phone != nil && *phone != "":
+		msg.Channel, msg.To = notify.SMS, *phone
+	default:
+		log.Printf("Password reset requested for %s, who has no email or phone\n", username)
+		return
+	}
+
+	var recent bool
+	err := database.DBpool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM password_resets WHERE user_id=$1 AND created_at > $2)",
+		userId, time.Now().Add(-resetCooldown)).Scan(&recent)
+	if err != nil {
+		log.Println("Error creating password reset:", err)
+		return
+	}
+	if recent {
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Println("Error creating password reset:", err)
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	ttl := config.C.Password.ResetTTL
+
+	// Only the newest link works
+	_, err = database.DBpool.Exec(ctx, "DELETE FROM password_resets WHERE user_id=$1 AND used_at IS NULL", userId)
+	if err == nil {
+		_, err = database.DBpool.Exec(ctx,
+			"INSERT INTO password_resets (user_id, token_hash, ip, expires_at) VALUES ($1, $2, $3, $4)",
+			userId, hashResetToken(token), ip, time.Now().Add(ttl))
+	}
+	if err != nil {
+		log.Println("Error creating password reset:", err)
+		return
+	}
+
+	link := token
+	if base := config.C.Password.ResetURL; base != "" {
+		link = base + "?token=" + url.QueryEscape(token)
+	}
+	msg.Body = fmt.Sprintf("A password reset was requested for your account %s.\n"+
+		"Use this within %s to choose a new password:\n%s\n"+
+		"If you did not ask for it, ignore this message.", username, ttl, link)
+	if err := notify.Default.Send(ctx, msg); err != nil {
+		log.Println("Error sending password reset:", err)
+	}
+}
+
+// @Summary Forgot password
+// @Description Send a password reset link to the email address, or else the phone, of a user. The answer is the same whether or not the user exists.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param input body ForgotPasswordInput true "Username"
+// @Success 202 {object} map[string]interface{} "Accepted"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/password/forgot [post]
+func ForgotPassword(c *fiber.Ctx) error {
+	input := new(ForgotPasswordInput)
+	if err := c.BodyParser(input); err != nil || input.Username == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "username is required"})
+	}
+
+	var userId int
+	var username string
+	var email, phone *string
+	err := database.DBpool.QueryRow(context.Background(),
+		"SELECT id, username, email, phone FROM users WHERE username=$1 AND active", input.Username,
+	).Scan(&userId, &username, &email, &phone)
+	if err != nil && err != pgx.ErrNoRows {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to look up user"})
+	}
+	if err == nil {
+		// Sent in the background so the response time does not tell
+		// whether the user exists.
+		go sendResetToken(userId, username, email, phone, c.IP())
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "If the account exists, a reset link has been sent"})
+}
+
+// @Summary Reset password
+// @Description Set a new password with a token from /api/password/forgot. The token works once; every session of the user is ended and a login lockout is lifted.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param input body ResetPasswordInput true "Token and new password"
+// @Success 200 {object} map[string]interface{} "Password changed"
+// @Failure 400 {object} map[string]interface{} "Invalid token or password"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/password/reset [post]
+func ResetPassword(c *fiber.Ctx) error {
+	input := new(ResetPasswordInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx := context.Background()
+	tokenHash := hashResetToken(input.Token)
+	var userId int
+	var username string
+	err := database.DBpool.QueryRow(ctx,
+		`SELECT u.id, u.username FROM password_resets r JOIN users u ON u.id = r.user_id
+		 WHERE r.token_hash=$1 AND r.used_at IS NULL AND r.expires_at > now() AND u.active`, tokenHash,
+	).Scan(&userId, &username)
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or expired token"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reset password"})
+	}
+
+	hashed, resp := hashNewPassword(c, userId, username, input.NewPassword)
+	if hashed == "" {
+		return resp
+	}
+
+	// Claim the token before using it, so two requests cannot both succeed
+	result, err := database.DBpool.Exec(ctx, "UPDATE password_resets SET used_at=now() WHERE token_hash=$1 AND used_at IS NULL", tokenHash)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reset password"})
+	}
+	if result.RowsAffected() == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or expired token"})
+	}
+	if _, err := database.DBpool.Exec(ctx, "UPDATE users SET password=$1 WHERE id=$2", hashed, userId); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reset password"})
+	}
+	recordPassword(userId, hashed)
+
+	if _, err := sessions.RevokeUser(ctx, userId); err != nil {
+		log.Println("Error revoking sessions:", err)
+	}
+	if err := loginguard.Default.Unlock(ctx, username); err != nil {
+		log.Println("Error resetting login attempts:", err)
+	}
+
+	return c.JSON(fiber.Map{"message": "Password changed"})
+}
@@ -4,27 +4,45 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"sync"
 	"tm/database"
 	"tm/models"
 
 	"github.com/gofiber/websocket/v2"
+	"github.com/golang-jwt/jwt/v4"
 )
 
-// WebSocket upgrader ve client map
-var clients = make(map[*websocket.Conn]bool)
+// WebSocket upgrader ve client map; her istemcinin görebildiği cihazları tutar
+var (
+	clients   = make(map[*websocket.Conn]deviceScope)
+	clientsMu sync.Mutex
+)
 
-// WebSocket bağlantılarını yönetir
+// WebSocket bağlantılarını yönetir. Bağlantı Authenticate'den geçtiği için
+// token claim'leri Locals içinde bulunur. Cihaz atamaları bağlantı kurulurken
+// okunur; değişiklikler yeniden bağlanınca geçerli olur.
 func HandleConnection(c *websocket.Conn) {
 	defer c.Close()
 
-	clients[c] = true
+	claims, _ := c.Locals("claims").(jwt.MapClaims)
+	org, _ := claims["org"].(float64)
+	id, _ := claims["id"].(float64)
+	role, _ := claims["role"].(string)
+	scope, err := scopeFor(context.Background(), int(org), int(id), role)
+	if err != nil {
+		log.Println("Error reading device access:", err)
+		return
+	}
+
+	clientsMu.Lock()
+	clients[c] = scope
+	clientsMu.Unlock()
 	log.Println("Client connected")
 
 	// Eski verileri gönder
-	if err := sendInitialData(c); err != nil {
+	if err := sendInitialData(c, scope); err != nil {
 		log.Println("Error sending initial data:", err)
-		c.Close()
-		delete(clients, c)
+		removeClient(c)
 		return
 	}
 
@@ -32,15 +50,15 @@ func HandleConnection(c *websocket.Conn) {
 		_, _, err := c.ReadMessage()
 		if err != nil {
 			log.Println("Error while reading message:", err)
-			delete(clients, c)
+			removeClient(c)
 			break
 		}
 	}
 }
 
 // Eski verileri alır ve WebSocket istemcisine gönderir
-func sendInitialData(c *websocket.Conn) error {
-	data, err := fetchAllData()
+func sendInitialData(c *websocket.Conn, scope deviceScope) error {
+	data, err := fetchAllData(scope)
 	if err != nil {
 		return err
 	}
@@ -50,62 +68,82 @@ func sendInitialData(c *websocket.Conn) error {
 		return err
 	}
 
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
 	return c.WriteMessage(websocket.TextMessage, message)
 }
 
-// Veritabanından eski verileri alır
-func fetchAllData() ([]models.DeviceAll, error) {
-	rows, err := database.DBpool.Query(context.Background(), "SELECT device_id, battery_level, signal_status, is_locked, status FROM devices")
-	if err != nil {
-		return nil, err
+func removeClient(c *websocket.Conn) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if _, ok := clients[c]; ok {
+		c.Close()
+		delete(clients, c)
 	}
-	defer rows.Close()
+}
 
-	var devices []models.DeviceAll
-	for rows.Next() {
-		var device models.DeviceAll
-		if err := rows.Scan(&device.DeviceId, &device.BatteryLevel, &device.SignalStatus, &device.IsLocked, &device.Status); err != nil {
-			return nil, err
-		}
+// Veritabanından eski verileri alır
+func fetchAllData(scope deviceScope) ([]models.DeviceAll, error) {
+	return fetchDevicesWithLastPosition(context.Background(), scope)
+}
 
-		// Son konum bilgisini al
-		locationRow := database.DBpool.QueryRow(context.Background(), "SELECT timestamp, latitude, longitude FROM device_locations WHERE device_id=$1 ORDER BY timestamp DESC LIMIT 1", device.DeviceId)
-		var location models.DeviceLocation
-		err = locationRow.Scan(&location.Timestamp, &location.Latitude, &location.Longitude)
-		if err != nil {
-			device.Location = nil // Koordinat bilgisi yok
-		} else {
-			device.Location = &location
+// Güncellemeleri her istemciye yalnızca görebildiği cihazlarla yayar
+func broadcastUpdate(data []models.DeviceAll) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	// Organizasyonun tüm cihazlarını gören istemciler aynı mesajı paylaşır
+	shared := make(map[int][]byte)
+	for client, scope := range clients {
+		message, ok := shared[scope.orgId]
+		if !ok || scope.devices != nil {
+			devices := []models.DeviceAll{}
+			for _, d := range data {
+				if d.OrgId == scope.orgId && scope.allows(d.DeviceId) {
+					devices = append(devices, d)
+				}
+			}
+			var err error
+			if message, err = json.Marshal(devices); err != nil {
+				log.Println("Error while marshaling message:", err)
+				return
+			}
+			if scope.devices == nil {
+				shared[scope.orgId] = message
+			}
 		}
-
-		devices = append(devices, device)
+		writeMessage(client, message)
 	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return devices, nil
 }
 
-// Tüm bağlı istemcilere güncellemeleri yayar
-func broadcastUpdate(data []models.DeviceAll) {
-	message, err := json.Marshal(data)
+// Tespit edilen olayları (ör. hız aşımı) cihazı görebilen istemcilere yayar
+func broadcastEvent(orgId int, event models.Event) {
+	message, err := json.Marshal(map[string]interface{}{"type": event.Type, "event": event})
 	if err != nil {
-		log.Println("Error while marshaling message:", err)
+		log.Println("Error while marshaling event:", err)
 		return
 	}
 
-	for client := range clients {
-		err := client.WriteMessage(websocket.TextMessage, message)
-		if err != nil {
-			log.Println("Error while writing message:", err)
-			client.Close()
-			delete(clients, client)
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	for client, scope := range clients {
+		if scope.orgId == orgId && scope.allows(event.DeviceId) {
+			writeMessage(client, message)
 		}
 	}
 }
 
+// İstemciye mesaj gönderir, gönderilemezse bağlantıyı kapatır.
+// clientsMu kilitliyken çağrılmalıdır.
+func writeMessage(client *websocket.Conn, message []byte) {
+	err := client.WriteMessage(websocket.TextMessage, message)
+	if err != nil {
+		log.Println("Error while writing message:", err)
+		client.Close()
+		delete(clients, client)
+	}
+}
+
 // Veritabanından gelen güncellemeleri dinler
 func ListenForUpdates() {
 	conn, err := database.DBpool.Acquire(context.Background())
@@ -131,11 +169,12 @@ func ListenForUpdates() {
 		log.Printf("Received notification: %s", notification.Payload)
 
 		// Güncellenmiş verileri al ve yayınla
-		data, err := fetchAllData()
+		data, err := fetchAllData(everyDevice)
 		if err != nil {
 			log.Println("Error fetching updated data:", err)
 			continue
 		}
+		refreshPositions(data)
 		broadcastUpdate(data)
 	}
 }
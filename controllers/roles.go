@@ -0,0 +1,369 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"tm/database"
+	"tm/models"
+	"tm/rbac"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+// fixedRoles cannot be changed or deleted, so that someone can always manage
+// the others.
+var fixedRoles = map[string]bool{"admin": true, "superadmin": true}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// @Summary Get all roles
+// @Description List roles with the permissions they grant
+// @Tags Admin
+// @Produce json
+// @Success 200 {array} models.Role
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/role/all [get]
+func GetRoles(c *fiber.Ctx) error {
+	rows, err := database.DBpool.Query(context.Background(),
+		`SELECT r.name, r.description, r.require_2fa,
+		        COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+		 FROM roles r
+		 LEFT JOIN role_permissions rp ON rp.role = r.name
+		 GROUP BY r.name, r.description, r.require_2fa
+		 ORDER BY r.name`)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving roles"})
+	}
+	defer rows.Close()
+
+	roles := []models.Role{}
+	for rows.Next() {
+		var r models.Role
+		if err := rows.Scan(&r.Name, &r.Description, &r.Require2FA, &r.Permissions); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error scanning role"})
+		}
+		roles = append(roles, r)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving roles"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(roles)
+}
+
+// @Summary Get all permissions
+// @Description List the permissions that can be granted to roles
+// @Tags Admin
+// @Produce json
+// @Success 200 {array} models.Permission
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/permission/all [get]
+func GetPermissions(c *fiber.Ctx) error {
+	permissions, err := allPermissions(context.Background())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving permissions"})
+	}
+	return c.Status(fiber.StatusOK).JSON(permissions)
+}
+
+func allPermissions(ctx context.Context) ([]models.Permission, error) {
+	rows, err := database.DBpool.Query(ctx, "SELECT name, description FROM permissions ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []models.Permission{}
+	for rows.Next() {
+		var p models.Permission
+		if err := rows.Scan(&p.Name, &p.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, p)
+	}
+	return permissions, rows.Err()
+}
+
+// checkPermissions returns an error message naming the first permission that
+// does not exist, or "" if they all do.
+func checkPermissions(ctx context.Context, names []string) (string, error) {
+	permissions, err := allPermissions(ctx)
+	if err != nil {
+		return "", err
+	}
+	known := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		known[p.Name] = true
+	}
+	for _, name := range names {
+		if !known[name] {
+			return "unknown permission " + name, nil
+		}
+	}
+	return "", nil
+}
+
+// setRolePermissions replaces the permissions granted to a role.
+func setRolePermissions(ctx context.Context, tx pgx.Tx, role string, permissions []string) error {
+	if _, err := tx.Exec(ctx, "DELETE FROM role_permissions WHERE role=$1", role); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx,
+		"INSERT INTO role_permissions (role, permission) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING",
+		role, permissions)
+	return err
+}
+
+// lockRole reads a role with its permissions and locks it for a change.
+func lockRole(ctx context.Context, tx pgx.Tx, name string) (models.Role, error) {
+	r := models.Role{Name: name}
+	err := tx.QueryRow(ctx,
+		`SELECT r.description, r.require_2fa,
+		        ARRAY(SELECT permission FROM role_permissions WHERE role = r.name ORDER BY permission)
+		 FROM roles r WHERE r.name = $1 FOR UPDATE`, name).Scan(&r.Description, &r.Require2FA, &r.Permissions)
+	return r, err
+}
+
+func reloadPermissions() {
+	if err := rbac.Load(); err != nil {
+		log.Println("Error reloading permissions:", err)
+	}
+}
+
+// @Summary Create role
+// @Description Create a role granting the given permissions
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param role body models.Role true "Role"
+// @Success 201 {object} models.Role
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 409 {object} map[string]interface{} "Role already exists"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/role/create [post]
+func CreateRole(c *fiber.Ctx) error {
+	role := new(models.Role)
+	if err := c.BodyParser(role); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON", "message": err.Error()})
+	}
+	if !roleNamePattern.MatchString(role.Name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "role name must be lowercase letters, digits and underscores"})
+	}
+
+	ctx := context.Background()
+	if msg, err := checkPermissions(ctx, role.Permissions); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving permissions"})
+	} else if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create role", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, "INSERT INTO roles (name, description, require_2fa) VALUES ($1, $2, $3) ON CONFLICT (name) DO NOTHING", role.Name, role.Description, role.Require2FA)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create role", "message": err.Error()})
+	}
+	if result.RowsAffected() == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "role already exists"})
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	if err := setRolePermissions(ctx, tx, role.Name, role.Permissions); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create role", "message": err.Error()})
+	}
+	if err := recordAudit(c, tx, "role.create", "role", role.Name, nil, role); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create role", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create role", "message": err.Error()})
+	}
+
+	reloadPermissions()
+	return c.Status(fiber.StatusCreated).JSON(role)
+}
+
+// @Summary Update role
+// @Description Replace the description and permissions of a role. The admin and superadmin roles cannot be changed. Whether the role requires two-factor authentication is set separately.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param name path string true "Role name"
+// @Param role body models.Role true "Role"
+// @Success 200 {object} models.Role
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/role/update/{name} [put]
+func UpdateRole(c *fiber.Ctx) error {
+	name := c.Params("name")
+	if fixedRoles[name] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "the " + name + " role cannot be changed"})
+	}
+
+	role := new(models.Role)
+	if err := c.BodyParser(role); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON", "message": err.Error()})
+	}
+	role.Name = name
+
+	ctx := context.Background()
+	if msg, err := checkPermissions(ctx, role.Permissions); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving permissions"})
+	} else if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update role", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := lockRole(ctx, tx, name)
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update role", "message": err.Error()})
+	}
+	role.Require2FA = before.Require2FA
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE roles SET description=$1 WHERE name=$2", role.Description, name); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update role", "message": err.Error()})
+	}
+	if err := setRolePermissions(ctx, tx, name, role.Permissions); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update role", "message": err.Error()})
+	}
+	if err := recordAudit(c, tx, "role.update", "role", name, before, role); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update role", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update role", "message": err.Error()})
+	}
+
+	reloadPermissions()
+	return c.Status(fiber.StatusOK).JSON(role)
+}
+
+// @Summary Delete role
+// @Description Delete a role that no user has. The admin and superadmin roles cannot be deleted.
+// @Tags Admin
+// @Param name path string true "Role name"
+// @Success 200 {object} map[string]interface{} "Deleted successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Not found"
+// @Failure 409 {object} map[string]interface{} "Role in use"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/role/delete/{name} [delete]
+func DeleteRole(c *fiber.Ctx) error {
+	name := c.Params("name")
+	if fixedRoles[name] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "the " + name + " role cannot be deleted"})
+	}
+
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete role", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := lockRole(ctx, tx, name)
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete role", "message": err.Error()})
+	}
+
+	var inUse bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE role=$1)", name).Scan(&inUse); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete role", "message": err.Error()})
+	}
+	if inUse {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "role is assigned to users"})
+	}
+	// Revoked keys go with the role
+	err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM api_keys WHERE role=$1 AND revoked_at IS NULL)", name).Scan(&inUse)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete role", "message": err.Error()})
+	}
+	if inUse {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "role is assigned to API keys"})
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM roles WHERE name=$1", name); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete role", "message": err.Error()})
+	}
+	if err := recordAudit(c, tx, "role.delete", "role", name, before, nil); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete role", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete role", "message": err.Error()})
+	}
+
+	reloadPermissions()
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Deleted successfully"})
+}
+
+type RoleTwoFactorInput struct {
+	Required bool `json:"required"`
+}
+
+// @Summary Require two-factor authentication
+// @Description Make two-factor authentication mandatory for a role, or optional again. Users of the role without it are asked to enroll at their next login; existing sessions are not ended.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param name path string true "Role name"
+// @Param input body RoleTwoFactorInput true "Whether 2FA is required"
+// @Success 200 {object} map[string]interface{} "Updated"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/role/require_2fa/{name} [put]
+func SetRoleTwoFactor(c *fiber.Ctx) error {
+	input := new(RoleTwoFactorInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON", "message": err.Error()})
+	}
+
+	name := c.Params("name")
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update role", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := lockRole(ctx, tx, name)
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update role", "message": err.Error()})
+	}
+	if _, err := tx.Exec(ctx, "UPDATE roles SET require_2fa=$1 WHERE name=$2", input.Required, name); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update role", "message": err.Error()})
+	}
+	after := before
+	after.Require2FA = input.Required
+	if err := recordAudit(c, tx, "role.require_2fa", "role", name, before, after); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update role", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update role", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"name": name, "require_2fa": input.Required})
+}
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+	"tm/config"
+	"tm/database"
+	"tm/models"
+	"tm/rbac"
+	"tm/sessions"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// issueTokens signs an access token for the session and sets both tokens as
+// cookies. The access cookie expires together with the token it carries.
+// An empty refresh token leaves the current one in place.
+func issueTokens(c *fiber.Ctx, user models.User, session sessions.Session, refresh string) error {
+	response, err := tokenResponse(c, user, session, refresh)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	}
+	return c.JSON(response)
+}
+
+// tokenResponse does the work of issueTokens but returns the response body
+// for the caller to add to.
+func tokenResponse(c *fiber.Ctx, user models.User, session sessions.Session, refresh string) (fiber.Map, error) {
+	now := time.Now()
+	expires := now.Add(config.C.JWT.AccessTTL)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":       user.Id,
+		"username": user.Username,
+		"role":     user.Role,
+		"sid":      session.ID,
+		"org":      session.OrgID,
+		"iat":      now.Unix(),
+		"exp":      expires.Unix(),
+	})
+
+	tokenString, err := token.SignedString([]byte(config.C.JWT.Secret))
+	if err != nil {
+		return nil, err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "jwt",
+		Value:    tokenString,
+		Expires:  expires,
+		HTTPOnly: true,
+		Secure:   false,
+	})
+	permissions := rbac.Permissions(user.Role)
+	sort.Strings(permissions)
+	response := fiber.Map{"token": tokenString, "Rule": user.Role, "permissions": permissions, "org_id": session.OrgID}
+
+	if refresh != "" {
+		c.Cookie(&fiber.Cookie{
+			Name:     "refresh",
+			Value:    refresh,
+			Path:     "/api",
+			Expires:  session.ExpiresAt,
+			HTTPOnly: true,
+			Secure:   false,
+		})
+		response["refresh_token"] = refresh
+	}
+
+	return response, nil
+}
+
+func clearTokenCookies(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{Name: "jwt", Expires: time.Unix(0, 0), HTTPOnly: true})
+	c.Cookie(&fiber.Cookie{Name: "refresh", Path: "/api", Expires: time.Unix(0, 0), HTTPOnly: true})
+}
+
+// @Summary Refresh tokens
+// @Description Exchange a refresh token (cookie or body) for a new access token and refresh token. The old refresh token stops working.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param refreshInput body RefreshInput false "Refresh token, if not sent as a cookie"
+// @Success 200 {object} map[string]interface{} "token"
+// @Failure 401 {object} map[string]interface{} "Invalid refresh token"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/refresh [post]
+func Refresh(c *fiber.Ctx) error {
+	refresh := refreshToken(c)
+	if refresh == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing refresh token"})
+	}
+
+	ctx := context.Background()
+	session, next, err := sessions.Rotate(ctx, refresh, c.IP())
+	if err == sessions.ErrInvalid {
+		clearTokenCookies(c)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid refresh token"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to refresh session"})
+	}
+
+	var user models.User
+	err = database.DBpool.QueryRow(ctx, "SELECT id, username, role, org_id FROM users WHERE id=$1 AND active", session.UserID).Scan(&user.Id, &user.Username, &user.Role, &user.OrgId)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid refresh token"})
+	}
+
+	// Only super admins may stay in an organization that is not their own
+	if session.OrgID != user.OrgId && !rbac.Can(user.Role, rbac.OrgManage) {
+		session.OrgID = user.OrgId
+		if err := sessions.SetOrg(ctx, session.ID, user.OrgId); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to refresh session"})
+		}
+	}
+
+	return issueTokens(c, user, session, next)
+}
+
+// refreshToken returns the refresh token of a request, from its cookie or
+// else from the body.
+func refreshToken(c *fiber.Ctx) string {
+	refresh := c.Cookies("refresh")
+	if refresh == "" {
+		var input RefreshInput
+		if err := c.BodyParser(&input); err == nil {
+			refresh = input.RefreshToken
+		}
+	}
+	return refresh
+}
+
+// LogoutWithRefresh ends the session of the refresh token sent with a logout,
+// which works after the access token has expired. Requests without an active
+// refresh token go on to Logout, which needs a valid access token.
+func LogoutWithRefresh(c *fiber.Ctx) error {
+	refresh := refreshToken(c)
+	if refresh == "" {
+		return c.Next()
+	}
+	revoked, err := sessions.RevokeRefresh(context.Background(), refresh)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to end session"})
+	}
+	if !revoked {
+		return c.Next()
+	}
+	clearTokenCookies(c)
+
+	return c.JSON(fiber.Map{"message": "Logged out"})
+}
+
+// @Summary Logout
+// @Description End the current session. Its access and refresh tokens stop working. The session is found from the refresh token (cookie or body) if one is sent, so logging out works after the access token has expired, and from the access token otherwise.
+// @Tags User
+// @Accept json
+// @Param refreshInput body RefreshInput false "Refresh token, if not sent as a cookie"
+// @Success 200 {object} map[string]interface{} "Logged out"
+// @Failure 401 {object} map[string]interface{} "Neither token is valid"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/logout [post]
+func Logout(c *fiber.Ctx) error {
+	if err := sessions.Revoke(context.Background(), sessionOf(c)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to end session"})
+	}
+	clearTokenCookies(c)
+
+	return c.JSON(fiber.Map{"message": "Logged out"})
+}
+
+// @Summary Revoke user sessions
+// @Description End every session of a user, logging them out everywhere
+// @Tags Admin
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{} "Number of revoked sessions"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 403 {object} map[string]interface{} "The user's role has a permission the caller lacks"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/revoke_sessions/{id} [post]
+func RevokeUserSessions(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+	}
+
+	if ok, resp := checkTarget(c, id); !ok {
+		return resp
+	}
+
+	n, err := sessions.RevokeUser(context.Background(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke sessions", "message": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"revoked": n})
+}
+
+// revokeUserSessions ends every session of a user after a change to their
+// account, logging instead of failing the request that made the change.
+func revokeUserSessions(id int) {
+	if _, err := sessions.RevokeUser(context.Background(), id); err != nil {
+		log.Println("Error revoking sessions:", err)
+	}
+}
@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Without a refresh token a logout is left to the access token check.
+func TestLogoutWithoutRefreshToken(t *testing.T) {
+	app := fiber.New()
+	app.Post("/logout", LogoutWithRefresh, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusTeapot)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodPost, "/logout", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusTeapot {
+		t.Errorf("status %d, want the next handler's", resp.StatusCode)
+	}
+}
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"tm/database"
+	"tm/geo"
+	"tm/models"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const eventTypeOverspeed = "overspeed"
+
+// overspeedEpisode is an overspeed event that has started but not ended yet,
+// together with the last fix seen while it was running.
+type overspeedEpisode struct {
+	event models.Event
+	last  models.DeviceLocation
+}
+
+var (
+	speedLimits   []models.SpeedLimit
+	speedLimitsMu sync.RWMutex
+
+	openEpisodes   = make(map[string]*overspeedEpisode)
+	openEpisodesMu sync.Mutex
+)
+
+// LoadSpeedLimits reads the configured speed limits into memory. It is called
+// on startup and after every change made through the admin endpoints.
+func LoadSpeedLimits() error {
+	rows, err := database.DBpool.Query(context.Background(),
+		"SELECT id, org_id, scope, device_id, vehicle_type, zone_name, latitude, longitude, radius, limit_kmh FROM speed_limits ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var limits []models.SpeedLimit
+	for rows.Next() {
+		var l models.SpeedLimit
+		if err := rows.Scan(&l.ID, &l.OrgId, &l.Scope, &l.DeviceId, &l.VehicleType, &l.ZoneName, &l.Latitude, &l.Longitude, &l.Radius, &l.LimitKmh); err != nil {
+			return err
+		}
+		limits = append(limits, l)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	speedLimitsMu.Lock()
+	speedLimits = limits
+	speedLimitsMu.Unlock()
+	return nil
+}
+
+// LoadOpenEpisodes restores overspeed episodes that were still running when
+// the service stopped, so they are closed instead of left dangling.
+func LoadOpenEpisodes() error {
+	rows, err := database.DBpool.Query(context.Background(),
+		`SELECT e.id, e.device_id, e.start_time, e.latitude, e.longitude, e.max_speed, e.speed_limit, e.distance, e.driver_id,
+		        l.timestamp, l.latitude, l.longitude
+		 FROM events e
+		 JOIN device_last_position l ON l.device_id = e.device_id
+		 WHERE e.type = $1 AND e.end_time IS NULL`, eventTypeOverspeed)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	openEpisodesMu.Lock()
+	defer openEpisodesMu.Unlock()
+	for rows.Next() {
+		ep := &overspeedEpisode{}
+		ep.event.Type = eventTypeOverspeed
+		if err := rows.Scan(&ep.event.ID, &ep.event.DeviceId, &ep.event.StartTime, &ep.event.Latitude, &ep.event.Longitude,
+			&ep.event.MaxSpeed, &ep.event.SpeedLimit, &ep.event.Distance, &ep.event.DriverId,
+			&ep.last.Timestamp, &ep.last.Latitude, &ep.last.Longitude); err != nil {
+			return err
+		}
+		openEpisodes[ep.event.DeviceId] = ep
+	}
+	return rows.Err()
+}
+
+// previousFix returns the latest stored fix of a device before a time, or
+// nil if it has none. Fixes buffered by a device while offline arrive late,
+// so this is not always the device's last position.
+func previousFix(ctx context.Context, tx pgx.Tx, deviceId string, before int64) (*models.DeviceLocation, error) {
+	var fix models.DeviceLocation
+	err := tx.QueryRow(ctx,
+		"SELECT timestamp, latitude, longitude FROM device_locations WHERE device_id=$1 AND timestamp < $2 ORDER BY timestamp DESC LIMIT 1",
+		deviceId, before).Scan(&fix.Timestamp, &fix.Latitude, &fix.Longitude)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &fix, nil
+}
+
+// deriveSpeed fills in the speed of fix from the previous fix when the device
+// did not report one.
+func deriveSpeed(prev *models.DeviceLocation, fix *models.DeviceLocation) {
+	if fix.Speed != nil || prev == nil {
+		return
+	}
+	if speed, ok := geo.SpeedKmh(prev.Latitude, prev.Longitude, prev.Timestamp, fix.Latitude, fix.Longitude, fix.Timestamp); ok {
+		fix.Speed = &speed
+	}
+}
+
+// speedLimitFor returns the limit in km/h that applies to a device of an
+// organization at the given point, or 0 if none does. A zone the point lies in takes precedence
+// over a device limit, which takes precedence over a vehicle type limit; when
+// several limits of the same kind match, the lowest one wins.
+func speedLimitFor(orgId int, deviceId, vehicleType string, lat, lon float64) float64 {
+	speedLimitsMu.RLock()
+	defer speedLimitsMu.RUnlock()
+
+	best := map[string]float64{}
+	for _, l := range speedLimits {
+		if l.OrgId != orgId {
+			continue
+		}
+		var match bool
+		switch l.Scope {
+		case "zone":
+			match = geo.Distance(l.Latitude, l.Longitude, lat, lon) <= l.Radius
+		case "device":
+			match = l.DeviceId == deviceId
+		case "vehicle_type":
+			match = vehicleType != "" && l.VehicleType == vehicleType
+		}
+		if match {
+			if cur, ok := best[l.Scope]; !ok || l.LimitKmh < cur {
+				best[l.Scope] = l.LimitKmh
+			}
+		}
+	}
+
+	for _, scope := range []string{"zone", "device", "vehicle_type"} {
+		if limit, ok := best[scope]; ok {
+			return limit
+		}
+	}
+	return 0
+}
+
+// detectOverspeed advances the overspeed state machine of a device with a new
+// fix, storing and broadcasting events as episodes start and end.
+func detectOverspeed(ctx context.Context, deviceId string, fix models.DeviceLocation) {
+	if fix.Speed == nil {
+		return
+	}
+
+	var orgId int
+	var vehicleType string
+	err := database.DBpool.QueryRow(ctx, "SELECT org_id, vehicle_type FROM devices WHERE device_id=$1", deviceId).Scan(&orgId, &vehicleType)
+	if err != nil && err != pgx.ErrNoRows {
+		log.Println("Error reading vehicle type:", err)
+	}
+	limit := speedLimitFor(orgId, deviceId, vehicleType, fix.Latitude, fix.Longitude)
+	speeding := limit > 0 && *fix.Speed > limit
+
+	openEpisodesMu.Lock()
+	defer openEpisodesMu.Unlock()
+
+	ep := openEpisodes[deviceId]
+	switch {
+	case speeding && ep == nil:
+		ep = &overspeedEpisode{
+			event: models.Event{
+				DeviceId:   deviceId,
+				Type:       eventTypeOverspeed,
+				StartTime:  fix.Timestamp,
+				Latitude:   fix.Latitude,
+				Longitude:  fix.Longitude,
+				MaxSpeed:   *fix.Speed,
+				SpeedLimit: limit,
+			},
+			last: fix,
+		}
+		err := database.DBpool.QueryRow(ctx,
+			`INSERT INTO events (device_id, type, start_time, latitude, longitude, max_speed, speed_limit, distance, driver_id)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, 0,
+			         (SELECT driver_id FROM driver_assignments WHERE device_id = $1 AND ended_at IS NULL))
+			 RETURNING id, driver_id`,
+			deviceId, ep.event.Type, ep.event.StartTime, ep.event.Latitude, ep.event.Longitude, ep.event.MaxSpeed, ep.event.SpeedLimit,
+		).Scan(&ep.event.ID, &ep.event.DriverId)
+		if err != nil {
+			log.Println("Error storing overspeed event:", err)
+			return
+		}
+		openEpisodes[deviceId] = ep
+		broadcastEvent(orgId, ep.event)
+
+	case ep != nil:
+		ep.event.Distance += geo.Distance(ep.last.Latitude, ep.last.Longitude, fix.Latitude, fix.Longitude)
+		ep.event.MaxSpeed = math.Max(ep.event.MaxSpeed, *fix.Speed)
+		ep.last = fix
+		if speeding {
+			ep.event.SpeedLimit = math.Min(ep.event.SpeedLimit, limit)
+			_, err := database.DBpool.Exec(ctx,
+				"UPDATE events SET max_speed=$1, speed_limit=$2, distance=$3 WHERE id=$4",
+				ep.event.MaxSpeed, ep.event.SpeedLimit, ep.event.Distance, ep.event.ID)
+			if err != nil {
+				log.Println("Error updating overspeed event:", err)
+			}
+			return
+		}
+
+		end := fix.Timestamp
+		ep.event.EndTime = &end
+		_, err := database.DBpool.Exec(ctx,
+			"UPDATE events SET end_time=$1, max_speed=$2, distance=$3 WHERE id=$4",
+			end, ep.event.MaxSpeed, ep.event.Distance, ep.event.ID)
+		if err != nil {
+			log.Println("Error closing overspeed event:", err)
+			return
+		}
+		delete(openEpisodes, deviceId)
+		broadcastEvent(orgId, ep.event)
+	}
+}
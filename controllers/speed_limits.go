@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"tm/database"
+	"tm/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+// @Summary Get all speed limits
+// @Description List the speed limits configured per device, vehicle type and zone
+// @Tags Admin
+// @Produce json
+// @Success 200 {array} models.SpeedLimit
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/speed_limit/all [get]
+func GetSpeedLimits(c *fiber.Ctx) error {
+	orgId := orgOf(c)
+	limits := []models.SpeedLimit{}
+
+	speedLimitsMu.RLock()
+	for _, l := range speedLimits {
+		if l.OrgId == orgId {
+			limits = append(limits, l)
+		}
+	}
+	speedLimitsMu.RUnlock()
+
+	return c.Status(fiber.StatusOK).JSON(limits)
+}
+
+// @Summary Create speed limit
+// @Description Create a speed limit in km/h for a device, a vehicle type or a circular zone
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param limit body models.SpeedLimit true "Speed limit"
+// @Success 201 {object} models.SpeedLimit
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/speed_limit/create [post]
+func CreateSpeedLimit(c *fiber.Ctx) error {
+	limit := new(models.SpeedLimit)
+	if err := c.BodyParser(limit); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON", "message": err.Error()})
+	}
+
+	if limit.LimitKmh <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit_kmh must be positive"})
+	}
+	switch limit.Scope {
+	case "device":
+		if limit.DeviceId == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "device_id is required for a device limit"})
+		}
+	case "vehicle_type":
+		if limit.VehicleType == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "vehicle_type is required for a vehicle type limit"})
+		}
+	case "zone":
+		if limit.Radius <= 0 || limit.Latitude < -90 || limit.Latitude > 90 || limit.Longitude < -180 || limit.Longitude > 180 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "a zone limit needs a valid center and a positive radius"})
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "scope must be one of device, vehicle_type, zone"})
+	}
+
+	limit.OrgId = orgOf(c)
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to insert speed limit", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO speed_limits (org_id, scope, device_id, vehicle_type, zone_name, latitude, longitude, radius, limit_kmh)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
+		limit.OrgId, limit.Scope, limit.DeviceId, limit.VehicleType, limit.ZoneName, limit.Latitude, limit.Longitude, limit.Radius, limit.LimitKmh,
+	).Scan(&limit.ID)
+	if err == nil {
+		err = recordAudit(c, tx, "speed_limit.create", "speed_limit", limit.ID, nil, limit)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to insert speed limit", "message": err.Error()})
+	}
+
+	if err := LoadSpeedLimits(); err != nil {
+		log.Println("Error reloading speed limits:", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(limit)
+}
+
+// @Summary Delete speed limit
+// @Description Delete a speed limit by ID
+// @Tags Admin
+// @Param id path int true "Speed limit ID"
+// @Success 200 {object} map[string]interface{} "Deleted successfully"
+// @Failure 404 {object} map[string]interface{} "Not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/speed_limit/delete/{id} [delete]
+func DeleteSpeedLimit(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete speed limit", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	var limit models.SpeedLimit
+	err = tx.QueryRow(ctx,
+		`DELETE FROM speed_limits WHERE id=$1 AND org_id=$2
+		 RETURNING id, org_id, scope, device_id, vehicle_type, zone_name, latitude, longitude, radius, limit_kmh`, id, orgOf(c),
+	).Scan(&limit.ID, &limit.OrgId, &limit.Scope, &limit.DeviceId, &limit.VehicleType, &limit.ZoneName,
+		&limit.Latitude, &limit.Longitude, &limit.Radius, &limit.LimitKmh)
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "speed limit not found"})
+	}
+	if err == nil {
+		err = recordAudit(c, tx, "speed_limit.delete", "speed_limit", limit.ID, limit, nil)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete speed limit", "message": err.Error()})
+	}
+
+	if err := LoadSpeedLimits(); err != nil {
+		log.Println("Error reloading speed limits:", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Deleted successfully"})
+}
+
+// @Summary Set device vehicle type
+// @Description Set the vehicle type used to pick vehicle type speed limits for a device
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Device ID"
+// @Param vehicleType body models.VehicleTypeRequest true "Vehicle type"
+// @Success 200 {object} map[string]interface{} "Updated successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/device/vehicle_type/{id} [put]
+func SetDeviceVehicleType(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var request models.VehicleTypeRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON", "message": err.Error()})
+	}
+
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update device", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	var previous string
+	err = tx.QueryRow(ctx,
+		"SELECT vehicle_type FROM devices WHERE device_id=$1 AND org_id=$2 FOR UPDATE", id, orgOf(c)).Scan(&previous)
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "device not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update device", "message": err.Error()})
+	}
+	if _, err := tx.Exec(ctx, "UPDATE devices SET vehicle_type=$1 WHERE device_id=$2", request.VehicleType, id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update device", "message": err.Error()})
+	}
+	if err := recordAudit(c, tx, "device.set_vehicle_type", "device", id, models.VehicleTypeRequest{VehicleType: previous}, request); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update device", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update device", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Updated successfully"})
+}
+
+// @Summary Get device events
+// @Description Get detected events (e.g. overspeed) of a device, optionally limited to a time range
+// @Tags Devices
+// @Produce json
+// @Param id path string true "Device ID"
+// @Param from query int false "Start of the range (unix seconds)"
+// @Param to query int false "End of the range (unix seconds)"
+// @Success 200 {array} models.Event
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Device not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/device/events/{id} [get]
+func GetDeviceEvents(c *fiber.Ctx) error {
+	deviceId := c.Params("id")
+	from, to, err := timeRange(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	events, err := deviceEvents(context.Background(), deviceId, from, to)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving events"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(events)
+}
+
+func deviceEvents(ctx context.Context, deviceId string, from, to int64) ([]models.Event, error) {
+	rows, err := database.DBpool.Query(ctx,
+		`SELECT id, device_id, type, start_time, end_time, latitude, longitude, max_speed, speed_limit, distance, driver_id
+		 FROM events WHERE device_id=$1 AND start_time BETWEEN $2 AND $3 ORDER BY start_time`,
+		deviceId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.Event{}
+	for rows.Next() {
+		var e models.Event
+		if err := rows.Scan(&e.ID, &e.DeviceId, &e.Type, &e.StartTime, &e.EndTime, &e.Latitude, &e.Longitude, &e.MaxSpeed, &e.SpeedLimit, &e.Distance, &e.DriverId); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// timeRange reads the optional from/to query parameters as unix seconds.
+// Missing bounds leave the range open on that side.
+func timeRange(c *fiber.Ctx) (from, to int64, err error) {
+	from, to = 0, 1<<62
+	if v := c.Query("from"); v != "" {
+		if from, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, 0, fiber.NewError(fiber.StatusBadRequest, "from must be a unix timestamp")
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, 0, fiber.NewError(fiber.StatusBadRequest, "to must be a unix timestamp")
+		}
+	}
+	if from > to {
+		return 0, 0, fiber.NewError(fiber.StatusBadRequest, "from must not be after to")
+	}
+	return from, to, nil
+}
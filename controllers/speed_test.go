@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"testing"
+	"tm/models"
+)
+
+func TestDeriveSpeed(t *testing.T) {
+	prev := &models.DeviceLocation{Timestamp: 1000, Latitude: 50, Longitude: 8}
+
+	// About 1.1 km in a minute
+	fix := models.DeviceLocation{Timestamp: 1060, Latitude: 50.01, Longitude: 8}
+	deriveSpeed(prev, &fix)
+	if fix.Speed == nil || *fix.Speed < 66 || *fix.Speed > 67 {
+		t.Errorf("derived speed %v, want about 66.7 km/h", fix.Speed)
+	}
+
+	reported := 12.0
+	fix = models.DeviceLocation{Timestamp: 1060, Latitude: 50.01, Longitude: 8, Speed: &reported}
+	deriveSpeed(prev, &fix)
+	if *fix.Speed != 12 {
+		t.Errorf("reported speed replaced by %v", *fix.Speed)
+	}
+
+	first := models.DeviceLocation{Timestamp: 1060, Latitude: 50.01, Longitude: 8}
+	deriveSpeed(nil, &first)
+	if first.Speed != nil {
+		t.Errorf("speed %v derived without a previous fix", *first.Speed)
+	}
+	same := models.DeviceLocation{Timestamp: 1000, Latitude: 50.01, Longitude: 8}
+	deriveSpeed(prev, &same)
+	if same.Speed != nil {
+		t.Errorf("speed %v derived from fixes with the same timestamp", *same.Speed)
+	}
+}
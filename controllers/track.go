@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"strconv"
+	"tm/geo"
+	"tm/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// trackOptions are the query parameters shared by the route history endpoints.
+type trackOptions struct {
+	From, To  int64
+	Tolerance float64 // meters, 0 disables simplification
+	Algorithm string  // "dp" or "vw"
+	Format    string  // "json" or "polyline"
+}
+
+func parseTrackOptions(c *fiber.Ctx) (trackOptions, error) {
+	opts := trackOptions{Algorithm: c.Query("algorithm", "dp"), Format: c.Query("format", "json")}
+
+	var err error
+	if opts.From, opts.To, err = timeRange(c); err != nil {
+		return opts, err
+	}
+	if v := c.Query("tolerance"); v != "" {
+		opts.Tolerance, err = strconv.ParseFloat(v, 64)
+		if err != nil || opts.Tolerance < 0 {
+			return opts, fiber.NewError(fiber.StatusBadRequest, "tolerance must be a non-negative number of meters")
+		}
+	}
+	if opts.Algorithm != "dp" && opts.Algorithm != "vw" {
+		return opts, fiber.NewError(fiber.StatusBadRequest, "algorithm must be dp or vw")
+	}
+	if opts.Format != "json" && opts.Format != "polyline" {
+		return opts, fiber.NewError(fiber.StatusBadRequest, "format must be json or polyline")
+	}
+	return opts, nil
+}
+
+func trackPoints(locations []models.DeviceLocation) []geo.Point {
+	points := make([]geo.Point, len(locations))
+	for i, l := range locations {
+		points[i] = geo.Point{Lat: l.Latitude, Lon: l.Longitude}
+	}
+	return points
+}
+
+// simplifyTrack drops the locations that do not change the shape of the track
+// by more than the requested tolerance.
+func simplifyTrack(locations []models.DeviceLocation, opts trackOptions) []models.DeviceLocation {
+	if opts.Tolerance <= 0 || len(locations) < 3 {
+		return locations
+	}
+
+	var keep []int
+	if opts.Algorithm == "vw" {
+		keep = geo.SimplifyVisvalingam(trackPoints(locations), opts.Tolerance)
+	} else {
+		keep = geo.SimplifyDouglasPeucker(trackPoints(locations), opts.Tolerance)
+	}
+
+	simplified := make([]models.DeviceLocation, len(keep))
+	for i, k := range keep {
+		simplified[i] = locations[k]
+	}
+	return simplified
+}
+
+func encodeTrack(locations []models.DeviceLocation) models.EncodedTrack {
+	track := models.EncodedTrack{Polyline: geo.EncodePolyline(trackPoints(locations)), Points: len(locations)}
+	if len(locations) > 0 {
+		track.Start = locations[0].Timestamp
+		track.End = locations[len(locations)-1].Timestamp
+	}
+	return track
+}
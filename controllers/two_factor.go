@@ -0,0 +1,614 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"tm/config"
+	"tm/database"
+	"tm/loginguard"
+	"tm/models"
+	"tm/sessions"
+	"tm/totp"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jackc/pgx/v4"
+)
+
+// Purposes of pre-auth tokens. They carry no session, so the API does not
+// accept them; they are only good for finishing a login.
+const (
+	preAuthCode  = "2fa"       // the user has to enter a code
+	preAuthSetup = "2fa_setup" // the role requires 2FA and the user has to enroll first
+)
+
+const recoveryCodeCount = 10
+
+type TwoFactorLoginInput struct {
+	PreAuthToken string `json:"pre_auth_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type TwoFactorCodeInput struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// twoFactorUser is a user together with their 2FA state.
+type twoFactorUser struct {
+	models.User
+	secret   *string
+	enabled  bool
+	lastStep int64
+	required bool
+	active   bool
+}
+
+func loadTwoFactorUser(ctx context.Context, id int) (twoFactorUser, error) {
+	var u twoFactorUser
+	err := database.DBpool.QueryRow(ctx,
+		`SELECT u.id, u.username, u.role, u.org_id, u.totp_secret, u.totp_enabled, u.totp_last_step, r.require_2fa, u.active
+		 FROM users u JOIN roles r ON r.name = u.role
+		 WHERE u.id = $1`, id,
+	).Scan(&u.Id, &u.Username, &u.Role, &u.OrgId, &u.secret, &u.enabled, &u.lastStep, &u.required, &u.active)
+	return u, err
+}
+
+// issuePreAuthToken answers a correct password of a user who still has to
+// pass the second factor.
+func issuePreAuthToken(c *fiber.Ctx, user models.User, purpose string) error {
+	response, err := preAuthResponse(user, purpose)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	}
+	return c.JSON(response)
+}
+
+// preAuthResponse does the work of issuePreAuthToken but returns the
+// response body.
+func preAuthResponse(user models.User, purpose string) (fiber.Map, error) {
+	now := time.Now()
+	ttl := config.C.Login.PreAuthTTL
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":      user.Id,
+		"purpose": purpose,
+		"iat":     now.Unix(),
+		"exp":     now.Add(ttl).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(config.C.JWT.Secret))
+	if err != nil {
+		return nil, err
+	}
+
+	return fiber.Map{
+		"two_factor":     purpose,
+		"pre_auth_token": tokenString,
+		"expires_in":     int(ttl.Seconds()),
+	}, nil
+}
+
+// parsePreAuthToken returns the user and purpose of a valid pre-auth token.
+func parsePreAuthToken(tokenStr string) (int, string, error) {
+	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(config.C.JWT.Secret), nil
+	})
+	if err != nil || !token.Valid {
+		return 0, "", errors.New("invalid pre-auth token")
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	purpose, _ := claims["purpose"].(string)
+	id, _ := claims["id"].(float64)
+	if (purpose != preAuthCode && purpose != preAuthSetup) || id == 0 {
+		return 0, "", errors.New("invalid pre-auth token")
+	}
+	return int(id), purpose, nil
+}
+
+// startSession finishes a successful login.
+func startSession(c *fiber.Ctx, user models.User, extra fiber.Map) error {
+	response, err := openSession(c, user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create session"})
+	}
+	for k, v := range extra {
+		response[k] = v
+	}
+	return c.JSON(response)
+}
+
+// openSession does the work of startSession but returns the response body.
+func openSession(c *fiber.Ctx, user models.User) (fiber.Map, error) {
+	ctx := context.Background()
+	if err := loginguard.Default.Succeeded(ctx, user.Username); err != nil {
+		log.Println("Error resetting login attempts:", err)
+	}
+
+	session, refresh, err := sessions.Create(ctx, user.Id, user.OrgId, c.Get(fiber.HeaderUserAgent), c.IP())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := database.DBpool.Exec(ctx, "UPDATE users SET last_login_at=now() WHERE id=$1", user.Id); err != nil {
+		log.Println("Error recording last login:", err)
+	}
+	return tokenResponse(c, user, session, refresh)
+}
+
+// tooManyAttempts answers a request refused by the login guard.
+func tooManyAttempts(c *fiber.Ctx, err error) error {
+	var blocked *loginguard.Blocked
+	if errors.As(err, &blocked) {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(blocked.RetryAfter.Seconds()))))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": blocked.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check login attempts"})
+}
+
+// verifySecondFactor checks a TOTP code of the user's secret, or an unused
+// recovery code if allowRecovery, counting wrong ones like wrong passwords.
+// It reports false after answering the request itself.
+func verifySecondFactor(c *fiber.Ctx, u twoFactorUser, code, recovery string, allowRecovery bool) (bool, error) {
+	ctx := context.Background()
+	guard := loginguard.Default
+	attempt, err := guard.Begin(ctx, u.Username, c.IP())
+	if err != nil {
+		return false, tooManyAttempts(c, err)
+	}
+
+	var ok bool
+	switch {
+	case code != "" && u.secret != nil:
+		ok, err = useTOTPCode(ctx, u, code)
+	case recovery != "" && allowRecovery:
+		ok, err = useRecoveryCode(ctx, u.Id, recovery)
+	case code == "" && recovery == "":
+		// Not a guess at all
+		if err := attempt.Passed(ctx); err != nil {
+			log.Println("Error releasing login attempt:", err)
+		}
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "code is required"})
+	}
+	if err != nil {
+		if err := attempt.Cancel(ctx); err != nil {
+			log.Println("Error releasing login attempt:", err)
+		}
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify code"})
+	}
+	if ok {
+		if err := attempt.Passed(ctx); err != nil {
+			log.Println("Error releasing login attempt:", err)
+		}
+		return true, nil
+	}
+
+	err = attempt.Failed(ctx, loginguard.Failure{
+		Username:  u.Username,
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		Reason:    loginguard.ReasonBadCode,
+		OrgID:     &u.OrgId,
+	})
+	if err != nil {
+		log.Println("Error recording failed login:", err)
+	}
+	return false, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid code"})
+}
+
+// useTOTPCode accepts a code at most once: the step it matched must be later
+// than the last accepted one, which is recorded atomically.
+func useTOTPCode(ctx context.Context, u twoFactorUser, code string) (bool, error) {
+	step, ok := totp.Validate(*u.secret, code, time.Now(), u.lastStep)
+	if !ok {
+		return false, nil
+	}
+	result, err := database.DBpool.Exec(ctx,
+		"UPDATE users SET totp_last_step=$1 WHERE id=$2 AND totp_last_step < $1", step, u.Id)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func useRecoveryCode(ctx context.Context, userId int, code string) (bool, error) {
+	result, err := database.DBpool.Exec(ctx,
+		"UPDATE recovery_codes SET used_at=now() WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL",
+		userId, hashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+// newRecoveryCodes replaces the recovery codes of a user and returns the new
+// ones. Only their hashes are kept, so this is the only time they are shown.
+func newRecoveryCodes(ctx context.Context, tx pgx.Tx, userId int) ([]string, error) {
+	if _, err := tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id=$1", userId); err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	_, err := tx.Exec(ctx,
+		"INSERT INTO recovery_codes (user_id, code_hash) SELECT $1, unnest($2::text[])", userId, hashes)
+	return codes, err
+}
+
+// enableTwoFactor switches 2FA on after the first code was verified and
+// returns the user's recovery codes.
+func enableTwoFactor(ctx context.Context, userId int) ([]string, error) {
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "UPDATE users SET totp_enabled=true WHERE id=$1", userId); err != nil {
+		return nil, err
+	}
+	codes, err := newRecoveryCodes(ctx, tx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit(ctx)
+}
+
+// startEnrollment gives a user a new secret to add to an authenticator app.
+// It does not count until a code of it has been verified.
+func startEnrollment(c *fiber.Ctx, u twoFactorUser) error {
+	if u.enabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "two-factor authentication is already enabled"})
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate secret"})
+	}
+	_, err = database.DBpool.Exec(context.Background(),
+		"UPDATE users SET totp_secret=$1, totp_last_step=0 WHERE id=$2", secret, u.Id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start enrollment", "message": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"secret": secret,
+		"uri":    totp.URI(config.C.Login.TOTPIssuer, u.Username, secret),
+	})
+}
+
+// @Summary Finish login with a second factor
+// @Description Exchange the pre-auth token returned by /api/login and a TOTP code (or a recovery code) for the usual tokens. For a "2fa_setup" token, call /api/login/2fa/setup first; the code then completes enrollment and the response also carries the recovery codes.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param input body TwoFactorLoginInput true "Pre-auth token and code"
+// @Success 200 {object} map[string]interface{} "token"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Invalid token or code"
+// @Failure 429 {object} map[string]interface{} "Too many failed logins"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/login/2fa [post]
+func LoginTwoFactor(c *fiber.Ctx) error {
+	input := new(TwoFactorLoginInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	id, purpose, err := parsePreAuthToken(input.PreAuthToken)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired pre-auth token"})
+	}
+
+	ctx := context.Background()
+	u, err := loadTwoFactorUser(ctx, id)
+	if err == pgx.ErrNoRows || err == nil && !u.active {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired pre-auth token"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to look up user"})
+	}
+
+	// Enrolling with a setup token: the first code turns 2FA on
+	if purpose == preAuthSetup && !u.enabled {
+		if u.secret == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "call /api/login/2fa/setup first"})
+		}
+		if ok, resp := verifySecondFactor(c, u, input.Code, "", false); !ok {
+			return resp
+		}
+		codes, err := enableTwoFactor(ctx, u.Id)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to enable two-factor authentication"})
+		}
+		return startSession(c, u.User, fiber.Map{"recovery_codes": codes})
+	}
+
+	if !u.enabled {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired pre-auth token"})
+	}
+	if ok, resp := verifySecondFactor(c, u, input.Code, input.RecoveryCode, true); !ok {
+		return resp
+	}
+	return startSession(c, u.User, nil)
+}
+
+// @Summary Enroll during login
+// @Description For a user whose role requires two-factor authentication but who has not enrolled: get a new secret and its otpauth:// URI (to show as a QR code) with the "2fa_setup" pre-auth token from /api/login
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param input body TwoFactorLoginInput true "Pre-auth token"
+// @Success 200 {object} map[string]interface{} "secret and uri"
+// @Failure 401 {object} map[string]interface{} "Invalid token"
+// @Failure 409 {object} map[string]interface{} "Already enabled"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/login/2fa/setup [post]
+func LoginTwoFactorSetup(c *fiber.Ctx) error {
+	input := new(TwoFactorLoginInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	id, purpose, err := parsePreAuthToken(input.PreAuthToken)
+	if err != nil || purpose != preAuthSetup {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired pre-auth token"})
+	}
+
+	u, err := loadTwoFactorUser(context.Background(), id)
+	if err == pgx.ErrNoRows || err == nil && !u.active {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired pre-auth token"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to look up user"})
+	}
+
+	return startEnrollment(c, u)
+}
+
+// @Summary Get two-factor status
+// @Description Whether the caller has two-factor authentication enabled, whether their role requires it, and how many recovery codes are left
+// @Tags User
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Status"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me/2fa [get]
+func GetTwoFactor(c *fiber.Ctx) error {
+	ctx := context.Background()
+	u, err := loadTwoFactorUser(ctx, userOf(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to look up user"})
+	}
+
+	var left int
+	err = database.DBpool.QueryRow(ctx, "SELECT count(*) FROM recovery_codes WHERE user_id=$1 AND used_at IS NULL", u.Id).Scan(&left)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to count recovery codes"})
+	}
+
+	return c.JSON(fiber.Map{"enabled": u.enabled, "required": u.required, "recovery_codes_left": left})
+}
+
+// @Summary Start two-factor enrollment
+// @Description Get a new secret and its otpauth:// URI (to show as a QR code). Two-factor authentication is enabled once a code of it is sent to /api/me/2fa/enable.
+// @Tags User
+// @Produce json
+// @Success 200 {object} map[string]interface{} "secret and uri"
+// @Failure 409 {object} map[string]interface{} "Already enabled"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me/2fa/setup [post]
+func SetupTwoFactor(c *fiber.Ctx) error {
+	u, err := loadTwoFactorUser(context.Background(), userOf(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to look up user"})
+	}
+	return startEnrollment(c, u)
+}
+
+// @Summary Enable two-factor authentication
+// @Description Verify a code of the secret from /api/me/2fa/setup and enable two-factor authentication. Returns the recovery codes, which are not shown again.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param input body TwoFactorCodeInput true "Code"
+// @Success 200 {object} map[string]interface{} "Recovery codes"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Invalid code"
+// @Failure 409 {object} map[string]interface{} "Already enabled"
+// @Failure 429 {object} map[string]interface{} "Too many failed attempts"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me/2fa/enable [post]
+func EnableTwoFactor(c *fiber.Ctx) error {
+	input := new(TwoFactorCodeInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx := context.Background()
+	u, err := loadTwoFactorUser(ctx, userOf(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to look up user"})
+	}
+	if u.enabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "two-factor authentication is already enabled"})
+	}
+	if u.secret == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "call /api/me/2fa/setup first"})
+	}
+	if ok, resp := verifySecondFactor(c, u, input.Code, "", false); !ok {
+		return resp
+	}
+
+	codes, err := enableTwoFactor(ctx, u.Id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to enable two-factor authentication"})
+	}
+	return c.JSON(fiber.Map{"recovery_codes": codes})
+}
+
+// @Summary Disable two-factor authentication
+// @Description Turn two-factor authentication off, confirmed with a code or recovery code. Not allowed if the caller's role requires it.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param input body TwoFactorCodeInput true "Code or recovery code"
+// @Success 200 {object} map[string]interface{} "Disabled"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Invalid code"
+// @Failure 403 {object} map[string]interface{} "Required by role"
+// @Failure 429 {object} map[string]interface{} "Too many failed attempts"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me/2fa/disable [post]
+func DisableTwoFactor(c *fiber.Ctx) error {
+	input := new(TwoFactorCodeInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx := context.Background()
+	u, err := loadTwoFactorUser(ctx, userOf(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to look up user"})
+	}
+	if !u.enabled {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "two-factor authentication is not enabled"})
+	}
+	if u.required {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "two-factor authentication is required for your role"})
+	}
+	if ok, resp := verifySecondFactor(c, u, input.Code, input.RecoveryCode, true); !ok {
+		return resp
+	}
+
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to disable two-factor authentication"})
+	}
+	defer tx.Rollback(ctx)
+	err = resetTwoFactor(ctx, tx, u.Id)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to disable two-factor authentication"})
+	}
+	return c.JSON(fiber.Map{"message": "Two-factor authentication disabled"})
+}
+
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes, confirmed with a TOTP code. Returns the new codes, which are not shown again.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param input body TwoFactorCodeInput true "Code"
+// @Success 200 {object} map[string]interface{} "Recovery codes"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Invalid code"
+// @Failure 429 {object} map[string]interface{} "Too many failed attempts"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/me/2fa/recovery_codes [post]
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	input := new(TwoFactorCodeInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx := context.Background()
+	u, err := loadTwoFactorUser(ctx, userOf(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to look up user"})
+	}
+	if !u.enabled {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "two-factor authentication is not enabled"})
+	}
+	if ok, resp := verifySecondFactor(c, u, input.Code, "", false); !ok {
+		return resp
+	}
+
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create recovery codes"})
+	}
+	defer tx.Rollback(ctx)
+	codes, err := newRecoveryCodes(ctx, tx, u.Id)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create recovery codes"})
+	}
+	return c.JSON(fiber.Map{"recovery_codes": codes})
+}
+
+// resetTwoFactor turns 2FA off and forgets the secret and recovery codes.
+func resetTwoFactor(ctx context.Context, tx pgx.Tx, userId int) error {
+	_, err := tx.Exec(ctx, "UPDATE users SET totp_secret=NULL, totp_enabled=false, totp_last_step=0 WHERE id=$1", userId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id=$1", userId)
+	return err
+}
+
+// @Summary Reset two-factor authentication
+// @Description Turn off two-factor authentication of a user who lost their authenticator and recovery codes, and end their sessions. If their role requires it, they enroll again at the next login.
+// @Tags Admin
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{} "Reset"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 403 {object} map[string]interface{} "The user's role has a permission the caller lacks"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/admin/reset_2fa/{id} [post]
+func ResetUserTwoFactor(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+	}
+
+	if ok, resp := checkTarget(c, id); !ok {
+		return resp
+	}
+
+	ctx := context.Background()
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reset two-factor authentication", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+	err = resetTwoFactor(ctx, tx, id)
+	if err == nil {
+		err = recordAudit(c, tx, "user.reset_2fa", "user", id, nil, nil)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reset two-factor authentication", "message": err.Error()})
+	}
+	// Sessions opened with the old second factor end with it
+	revokeUserSessions(id)
+
+	return c.JSON(fiber.Map{"message": "Two-factor authentication reset"})
+}
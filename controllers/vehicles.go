@@ -0,0 +1,389 @@
+package controllers
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"tm/database"
+	"tm/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+// fuelTypes are the accepted values of models.Vehicle.FuelType besides "".
+var fuelTypes = []string{"diesel", "petrol", "lpg", "cng", "lng", "electric", "hybrid", "hydrogen"}
+
+// vinPattern is a 17 character vehicle identification number, which never
+// contains I, O or Q.
+var vinPattern = regexp.MustCompile(`^[A-HJ-NPR-Z0-9]{17}$`)
+
+const (
+	maxPlate     = 20
+	maxMakeModel = 100
+)
+
+// vehicleQuery selects vehicles v with their current driver, for the
+// columns scanned by scanVehicle.
+const vehicleQuery = `
+	SELECT v.id, v.create_time, v.plate, v.vin, v.make, v.model, v.trailer, v.capacity_kg, v.tare_weight_kg,
+	       v.legacy_driver_weight, v.fuel_type, v.device_id, ` + currentDriverColumns + `
+	FROM vehicles v
+	LEFT JOIN driver_assignments cda ON cda.vehicle_id = v.id AND cda.ended_at IS NULL
+	LEFT JOIN driver cdr ON cdr.id = cda.driver_id`
+
+func scanVehicle(row pgx.Row) (models.Vehicle, error) {
+	var v models.Vehicle
+	var driver currentDriver
+	err := row.Scan(&v.ID, &v.CreateTime, &v.Plate, &v.VIN, &v.Make, &v.Model, &v.Trailer, &v.CapacityKg, &v.TareWeightKg,
+		&v.LegacyDriverWeight, &v.FuelType, &v.DeviceId, &driver.id, &driver.name, &driver.phone)
+	v.Driver = driver.model()
+	return v, err
+}
+
+// rowQuerier is the pool or a transaction.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+func getVehicle(ctx context.Context, q rowQuerier, id, orgId int) (models.Vehicle, error) {
+	return scanVehicle(q.QueryRow(ctx, vehicleQuery+" WHERE v.id = $1 AND v.org_id = $2", id, orgId))
+}
+
+// checkVehicle normalizes a vehicle from a request and answers 400, 404 or
+// 409 if it is invalid, clashes with another vehicle than the one with id,
+// or names a device the caller cannot see.
+func checkVehicle(c *fiber.Ctx, v *models.Vehicle, id int) (bool, error) {
+	v.Plate = strings.ToUpper(strings.TrimSpace(v.Plate))
+	v.VIN = strings.ToUpper(strings.TrimSpace(v.VIN))
+	v.Make = strings.TrimSpace(v.Make)
+	v.Model = strings.TrimSpace(v.Model)
+	v.Trailer = strings.ToUpper(strings.TrimSpace(v.Trailer))
+	v.FuelType = strings.ToLower(strings.TrimSpace(v.FuelType))
+	if v.DeviceId != nil && strings.TrimSpace(*v.DeviceId) == "" {
+		v.DeviceId = nil
+	}
+
+	var problem string
+	switch {
+	case v.Plate == "" || len([]rune(v.Plate)) > maxPlate:
+		problem = "plate is required and must be at most 20 characters"
+	case v.VIN != "" && !vinPattern.MatchString(v.VIN):
+		problem = "vin must be 17 letters and digits without I, O or Q"
+	case len([]rune(v.Make)) > maxMakeModel || len([]rune(v.Model)) > maxMakeModel:
+		problem = "make and model must be at most 100 characters"
+	case len([]rune(v.Trailer)) > maxPlate:
+		problem = "trailer must be at most 20 characters"
+	case v.CapacityKg < 0 || v.TareWeightKg < 0:
+		problem = "capacity_kg and tare_weight_kg must not be negative"
+	case v.FuelType != "" && !contains(fuelTypes, v.FuelType):
+		problem = "fuel_type must be one of " + strings.Join(fuelTypes, ", ")
+	}
+	if problem != "" {
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": problem})
+	}
+
+	ctx := context.Background()
+	orgId := orgOf(c)
+	if v.DeviceId != nil {
+		scope, err := scopeOf(c)
+		if err != nil {
+			return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to check vehicle", "message": err.Error()})
+		}
+		if ok, err := canSeeDevice(ctx, scope, *v.DeviceId); err != nil {
+			return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to check vehicle", "message": err.Error()})
+		} else if !ok {
+			return false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Device not found"})
+		}
+	}
+
+	var plateTaken, vinTaken, deviceTaken bool
+	err := database.DBpool.QueryRow(ctx,
+		`SELECT
+		   EXISTS (SELECT 1 FROM vehicles WHERE org_id = $1 AND plate = $2 AND id <> $5),
+		   EXISTS (SELECT 1 FROM vehicles WHERE org_id = $1 AND vin = $3 AND vin <> '' AND id <> $5),
+		   EXISTS (SELECT 1 FROM vehicles WHERE device_id = $4 AND id <> $5)`,
+		orgId, v.Plate, v.VIN, v.DeviceId, id).Scan(&plateTaken, &vinTaken, &deviceTaken)
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to check vehicle", "message": err.Error()})
+	}
+	switch {
+	case plateTaken:
+		problem = "another vehicle has this plate"
+	case vinTaken:
+		problem = "another vehicle has this vin"
+	case deviceTaken:
+		problem = "the device is installed in another vehicle"
+	}
+	if problem != "" {
+		return false, c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": problem})
+	}
+	return true, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// @Summary Get all vehicles
+// @Description Get all vehicles of the organization with the device installed in each and its current driver
+// @Tags Vehicles
+// @Produce json
+// @Success 200 {array} models.Vehicle
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/vehicle/all_vehicle [get]
+func GetAllVehicles(c *fiber.Ctx) error {
+	rows, err := database.DBpool.Query(context.Background(), vehicleQuery+" WHERE v.org_id = $1 ORDER BY v.plate", orgOf(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving vehicles"})
+	}
+	defer rows.Close()
+
+	vehicles := []models.Vehicle{}
+	for rows.Next() {
+		v, err := scanVehicle(rows)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error scanning vehicle"})
+		}
+		vehicles = append(vehicles, v)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error processing vehicles"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(vehicles)
+}
+
+// @Summary Get vehicle by ID
+// @Description Retrieve a vehicle by ID
+// @Tags Vehicles
+// @Produce json
+// @Param id path int true "Vehicle ID"
+// @Success 200 {object} models.Vehicle
+// @Failure 404 {object} map[string]interface{} "Vehicle not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/vehicle/get_vehicle/{id} [get]
+func GetVehicleById(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid vehicle id"})
+	}
+	v, err := getVehicle(context.Background(), database.DBpool, id, orgOf(c))
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "vehicle not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error retrieving vehicle"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(v)
+}
+
+// @Summary Create vehicle
+// @Description Create a vehicle. The plate, VIN and trailer are stored in upper case; fuel_type is one of diesel, petrol, lpg, cng, lng, electric, hybrid, hydrogen or empty.
+// @Tags Vehicles
+// @Accept json
+// @Produce json
+// @Param vehicle body models.Vehicle true "Vehicle"
+// @Success 201 {object} models.Vehicle
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Device not found"
+// @Failure 409 {object} map[string]interface{} "Plate, VIN or device already used"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/vehicle/create_vehicle [post]
+func CreateVehicle(c *fiber.Ctx) error {
+	input := new(models.Vehicle)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON", "message": err.Error()})
+	}
+	if ok, resp := checkVehicle(c, input, 0); !ok {
+		return resp
+	}
+
+	ctx := context.Background()
+	orgId := orgOf(c)
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create vehicle", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	err = tx.QueryRow(ctx,
+		`INSERT INTO vehicles (org_id, plate, vin, make, model, trailer, capacity_kg, tare_weight_kg, fuel_type, device_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		 ON CONFLICT DO NOTHING RETURNING id`,
+		orgId, input.Plate, input.VIN, input.Make, input.Model, input.Trailer, input.CapacityKg, input.TareWeightKg,
+		input.FuelType, input.DeviceId).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "another vehicle has this plate, vin or device"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create vehicle", "message": err.Error()})
+	}
+
+	created, err := getVehicle(ctx, tx, id, orgId)
+	if err == nil {
+		err = recordAudit(c, tx, "vehicle.create", "vehicle", created.ID, nil, created)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create vehicle", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// @Summary Update vehicle
+// @Description Update a vehicle by ID. If its device changes, its current driver is reassigned to the vehicle with the new device. legacy_driver_weight is replaced like the other fields, so send null once it has been moved into tare_weight_kg or capacity_kg.
+// @Tags Vehicles
+// @Accept json
+// @Produce json
+// @Param id path int true "Vehicle ID"
+// @Param vehicle body models.Vehicle true "Vehicle"
+// @Success 200 {object} models.Vehicle
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Vehicle or device not found"
+// @Failure 409 {object} map[string]interface{} "Plate, VIN or device already used, or its driver assigned to a device out of scope"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/vehicle/update_vehicle/{id} [put]
+func UpdateVehicle(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid vehicle id"})
+	}
+	input := new(models.Vehicle)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON", "message": err.Error()})
+	}
+
+	if ok, resp := checkVehicle(c, input, id); !ok {
+		return resp
+	}
+
+	ctx := context.Background()
+	orgId := orgOf(c)
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update vehicle", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT 1 FROM vehicles WHERE id = $1 FOR UPDATE", id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update vehicle", "message": err.Error()})
+	}
+	before, err := getVehicle(ctx, tx, id, orgId)
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "vehicle not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update vehicle", "message": err.Error()})
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE vehicles SET plate = $3, vin = $4, make = $5, model = $6, trailer = $7, capacity_kg = $8,
+		        tare_weight_kg = $9, fuel_type = $10, device_id = $11, legacy_driver_weight = $12
+		 WHERE id = $1 AND org_id = $2`,
+		id, orgId, input.Plate, input.VIN, input.Make, input.Model, input.Trailer, input.CapacityKg,
+		input.TareWeightKg, input.FuelType, input.DeviceId, input.LegacyDriverWeight)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update vehicle", "message": err.Error()})
+	}
+
+	// The driver of the vehicle now drives the new device.
+	moved := (before.DeviceId == nil) != (input.DeviceId == nil) ||
+		(before.DeviceId != nil && input.DeviceId != nil && *before.DeviceId != *input.DeviceId)
+	if moved && before.Driver != nil {
+		scope, err := scopeOf(c)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update vehicle", "message": err.Error()})
+		}
+		_, _, err = openAssignment(ctx, tx, scope, orgId, before.Driver.ID, input.DeviceId, &id, userOf(c))
+		if err == pgx.ErrNoRows {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "the vehicle or device was assigned at the same time, try again"})
+		}
+		if err == errAssignedOutOfScope {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update vehicle", "message": err.Error()})
+		}
+	}
+	updated, err := getVehicle(ctx, tx, id, orgId)
+	if err == nil {
+		err = recordAudit(c, tx, "vehicle.update", "vehicle", id, before, updated)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update vehicle", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(updated)
+}
+
+// @Summary Delete vehicle
+// @Description Delete a vehicle by ID. Assignments to its device are kept; those to the vehicle alone are deleted.
+// @Tags Vehicles
+// @Produce json
+// @Param id path int true "Vehicle ID"
+// @Success 200 {object} map[string]interface{} "Deleted successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 404 {object} map[string]interface{} "Vehicle not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/vehicle/delete_vehicle/{id} [delete]
+func DeleteVehicle(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid vehicle id"})
+	}
+
+	ctx := context.Background()
+	orgId := orgOf(c)
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete vehicle", "message": err.Error()})
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT 1 FROM vehicles WHERE id = $1 FOR UPDATE", id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete vehicle", "message": err.Error()})
+	}
+	before, err := getVehicle(ctx, tx, id, orgId)
+	if err == pgx.ErrNoRows {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "vehicle not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete vehicle", "message": err.Error()})
+	}
+
+	// Assignments need a vehicle or a device; the others only lose the
+	// vehicle.
+	if _, err := tx.Exec(ctx, "DELETE FROM driver_assignments WHERE vehicle_id = $1 AND device_id IS NULL", id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete vehicle", "message": err.Error()})
+	}
+	result, err := tx.Exec(ctx, "DELETE FROM vehicles WHERE id = $1 AND org_id = $2", id, orgId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete vehicle", "message": err.Error()})
+	}
+	if result.RowsAffected() == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "vehicle not found"})
+	}
+	if err := recordAudit(c, tx, "vehicle.delete", "vehicle", id, before, nil); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete vehicle", "message": err.Error()})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete vehicle", "message": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Deleted successfully"})
+}
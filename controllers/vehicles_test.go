@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"tm/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// checkVehicleStatus runs checkVehicle on v and returns the status it
+// answered with, or 0 if it let the vehicle through.
+func checkVehicleStatus(t *testing.T, v *models.Vehicle) int {
+	t.Helper()
+	app := fiber.New()
+	app.Post("/", func(c *fiber.Ctx) error {
+		if ok, err := checkVehicle(c, v, 0); !ok {
+			return err
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodPost, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode == fiber.StatusNoContent {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+func TestCheckVehicleRejectsInvalidFields(t *testing.T) {
+	long := "ABCDEFGHIJKLMNOPQRSTU"
+	for name, v := range map[string]models.Vehicle{
+		"no plate":      {Plate: "  "},
+		"long plate":    {Plate: long},
+		"vin with I":    {Plate: "34 ABC 12", VIN: "1HGCM82633A00435I"},
+		"short vin":     {Plate: "34 ABC 12", VIN: "1HGCM826"},
+		"long trailer":  {Plate: "34 ABC 12", Trailer: long},
+		"negative tare": {Plate: "34 ABC 12", TareWeightKg: -1},
+		"negative load": {Plate: "34 ABC 12", CapacityKg: -1},
+		"unknown fuel":  {Plate: "34 ABC 12", FuelType: "coal"},
+	} {
+		v := v
+		if status := checkVehicleStatus(t, &v); status != fiber.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", name, status)
+		}
+	}
+}
+
+func TestCheckVehicleNormalizes(t *testing.T) {
+	device := " "
+	// The unknown fuel type stops the check before the database is asked.
+	v := models.Vehicle{Plate: " 34 abc 12 ", VIN: " 1hgcm82633a004352", Trailer: "34 xyz 9", FuelType: " COAL", DeviceId: &device}
+	checkVehicleStatus(t, &v)
+	if v.Plate != "34 ABC 12" || v.VIN != "1HGCM82633A004352" || v.Trailer != "34 XYZ 9" || v.FuelType != "coal" {
+		t.Errorf("normalized to %q %q %q %q", v.Plate, v.VIN, v.Trailer, v.FuelType)
+	}
+	if v.DeviceId != nil {
+		t.Errorf("blank device id kept as %q", *v.DeviceId)
+	}
+}
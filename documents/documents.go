@@ -0,0 +1,382 @@
+// Package documents keeps the scans of driver documents on disk and warns
+// about documents that are about to expire.
+package documents
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"tm/config"
+	"tm/database"
+	"tm/notify"
+	"tm/rbac"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Types of documents a driver can have.
+const (
+	Licence        = "licence"
+	Passport       = "passport"
+	Visa           = "visa"
+	ADR            = "adr"
+	Medical        = "medical"
+	CPC            = "cpc"
+	TachographCard = "tachograph_card"
+)
+
+// Types lists every document type.
+var Types = []string{Licence, Passport, Visa, ADR, Medical, CPC, TachographCard}
+
+// fileTypes maps the content types accepted for scans to their extension.
+var fileTypes = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+}
+
+// ErrFileType is returned for uploads that are not a PDF, JPEG or PNG file.
+var ErrFileType = errors.New("scans must be PDF, JPEG or PNG files")
+
+var (
+	dir       = "driver_documents"
+	maxBytes  int64
+	alertDays []int
+	// Required are the types of which a driver needs a valid document to
+	// be allowed to drive.
+	Required []string
+	// CheckInterval is how often expiring documents are looked for. Each
+	// alert is only sent once, so checking more than daily only makes them
+	// go out sooner after midnight.
+	CheckInterval = time.Hour
+)
+
+// ValidType reports whether a document type is known.
+func ValidType(t string) bool {
+	for _, known := range Types {
+		if known == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Init sets up the documents directory and the alert days from the
+// configuration.
+func Init() {
+	cfg := config.C.Documents
+	for _, t := range cfg.Required {
+		if !ValidType(t) {
+			log.Fatalf("Unknown required document type %q, expected one of %s\n", t, strings.Join(Types, ", "))
+		}
+	}
+	dir = cfg.Dir
+	maxBytes = int64(cfg.MaxFileMB) << 20
+	Required = cfg.Required
+	alertDays = append([]int{}, cfg.AlertDays...)
+	sort.Ints(alertDays)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		log.Fatalf("Unable to create documents directory: %v\n", err)
+	}
+}
+
+// MaxBytes is the size limit of a scan.
+func MaxBytes() int64 {
+	return maxBytes
+}
+
+func path(key string) string {
+	return filepath.Join(dir, filepath.FromSlash(key))
+}
+
+// Save stores a scan for a driver and returns its key and content type,
+// which is detected from the file rather than trusted from the upload.
+func Save(orgId, driverId int, r io.Reader) (key, contentType string, err error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", "", err
+	}
+	head = head[:n]
+	contentType, _, _ = strings.Cut(http.DetectContentType(head), ";")
+	ext, ok := fileTypes[contentType]
+	if !ok {
+		return "", "", ErrFileType
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	key = fmt.Sprintf("%d/%d/%s%s", orgId, driverId, hex.EncodeToString(id), ext)
+	p := path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return "", "", err
+	}
+
+	// Write to a temporary file first so a failed upload never leaves a
+	// truncated file under the final name.
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(head)
+	if err == nil {
+		_, err = io.Copy(tmp, r)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return "", "", err
+	}
+	return key, contentType, nil
+}
+
+// Open opens a stored scan.
+func Open(key string) (*os.File, error) {
+	return os.Open(path(key))
+}
+
+// Remove deletes a stored scan. A scan that is already gone is no error.
+func Remove(key string) error {
+	err := os.Remove(path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// RemoveDriver deletes every scan of a driver.
+func RemoveDriver(orgId, driverId int) error {
+	return os.RemoveAll(path(fmt.Sprintf("%d/%d", orgId, driverId)))
+}
+
+// Run sends expiry alerts now and then every CheckInterval. It never
+// returns and does nothing when no alert days are configured.
+func Run() {
+	if len(alertDays) == 0 {
+		return
+	}
+	ticker := time.NewTicker(CheckInterval)
+	defer ticker.Stop()
+	for {
+		if err := alertExpiring(context.Background()); err != nil {
+			log.Println("Error sending document expiry alerts:", err)
+		}
+		<-ticker.C
+	}
+}
+
+// expiring is a document that is due an alert.
+type expiring struct {
+	id, orgId       int
+	days, left      int
+	driver, phone   string
+	docType, number string
+	expiresOn       time.Time
+}
+
+// dueAlert returns the alert day a document expiring in left days is due,
+// the smallest one not below left, so a document found late gets a single
+// alert rather than one for every day it passed.
+func dueAlert(left int) (int, bool) {
+	for _, days := range alertDays {
+		if left <= days {
+			return days, true
+		}
+	}
+	return 0, false
+}
+
+// deliveryAttempts is how often sending an alert is tried before it is left
+// to the in-app list alone.
+const deliveryAttempts = 5
+
+// alertExpiring records the alerts of documents that expire within the
+// largest alert day and were not alerted about at that stage yet, which puts
+// them on the in-app list, then sends the recorded alerts that have not gone
+// out yet.
+func alertExpiring(ctx context.Context) error {
+	var start time.Time
+	if err := database.DBpool.QueryRow(ctx, "SELECT now()").Scan(&start); err != nil {
+		return err
+	}
+	rows, err := database.DBpool.Query(ctx,
+		`SELECT d.id, d.expires_on - current_date, d.expires_on
+		 FROM driver_documents d
+		 WHERE d.expires_on >= current_date AND d.expires_on - current_date <= $1`, alertDays[len(alertDays)-1])
+	if err != nil {
+		return err
+	}
+	var due []expiring
+	for rows.Next() {
+		var e expiring
+		if err := rows.Scan(&e.id, &e.left, &e.expiresOn); err != nil {
+			rows.Close()
+			return err
+		}
+		if days, ok := dueAlert(e.left); ok {
+			e.days = days
+			due = append(due, e)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range due {
+		_, err := database.DBpool.Exec(ctx,
+			`INSERT INTO driver_document_alerts (document_id, days, expires_on) VALUES ($1, $2, $3)
+			 ON CONFLICT DO NOTHING`, e.id, e.days, e.expiresOn)
+		if err != nil {
+			return err
+		}
+	}
+	for {
+		done, err := deliverNext(ctx, start)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// deliverNext sends one recorded alert that has not gone out and was not
+// tried since start. Its row stays locked while it is sent, so concurrent
+// instances skip it rather than send it too, and it is only marked delivered
+// once a channel took it. It reports true when no alert is left to send.
+func deliverNext(ctx context.Context, start time.Time) (bool, error) {
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var e expiring
+	err = tx.QueryRow(ctx,
+		`SELECT d.id, d.org_id, a.days, a.expires_on - current_date, dr.name, dr.phone, d.type, d.number, a.expires_on
+		 FROM driver_document_alerts a
+		 JOIN driver_documents d ON d.id = a.document_id
+		 JOIN driver dr ON dr.id = d.driver_id
+		 WHERE a.delivered_at IS NULL AND a.attempts < $1 AND a.expires_on >= current_date
+		   AND (a.last_attempt_at IS NULL OR a.last_attempt_at < $2)
+		 ORDER BY a.created_at
+		 LIMIT 1
+		 FOR UPDATE OF a SKIP LOCKED`, deliveryAttempts, start,
+	).Scan(&e.id, &e.orgId, &e.days, &e.left, &e.driver, &e.phone, &e.docType, &e.number, &e.expiresOn)
+	if err == pgx.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	channels, sendErr := sendAlert(ctx, e)
+	if sendErr != nil {
+		log.Printf("Error sending expiry alert of document %d: %v\n", e.id, sendErr)
+	}
+	// Without anyone to send it to, the in-app list is all there is
+	delivered := len(channels) > 0 || sendErr == nil
+	_, err = tx.Exec(ctx,
+		`UPDATE driver_document_alerts
+		 SET attempts = attempts + 1, last_attempt_at = $4, channels = $5,
+		     delivered_at = CASE WHEN $6 THEN now() END
+		 WHERE document_id = $1 AND days = $2 AND expires_on = $3`,
+		e.id, e.days, e.expiresOn, start, channels, delivered)
+	if err != nil {
+		return false, err
+	}
+	return false, tx.Commit(ctx)
+}
+
+// sendAlert tells the driver by SMS and the organization's users who manage
+// drivers by email that a document is about to expire. It returns the
+// channels that took the alert for at least one recipient.
+func sendAlert(ctx context.Context, e expiring) ([]string, error) {
+	what := strings.ReplaceAll(e.docType, "_", " ")
+	if e.number != "" {
+		what += " " + e.number
+	}
+	date := e.expiresOn.Format("2006-01-02")
+	subject := fmt.Sprintf("Driver document expires on %s", date)
+
+	channels := []string{}
+	var errs []error
+	if e.phone != "" {
+		err := notify.Default.Send(ctx, notify.Message{
+			Channel: notify.SMS,
+			To:      e.phone,
+			Body:    fmt.Sprintf("Your %s expires %s, on %s. Please renew it.", what, daysText(e.left), date),
+		})
+		if err == nil {
+			channels = append(channels, notify.SMS)
+		}
+		errs = append(errs, err)
+	}
+
+	rows, err := database.DBpool.Query(ctx,
+		`SELECT u.email FROM users u
+		 JOIN role_permissions p ON p.role = u.role AND p.permission = $2
+		 WHERE u.org_id = $1 AND u.active AND COALESCE(u.email, '') <> ''`, e.orgId, rbac.DriverWrite)
+	if err != nil {
+		return channels, errors.Join(append(errs, err)...)
+	}
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			rows.Close()
+			return channels, errors.Join(append(errs, err)...)
+		}
+		emails = append(emails, email)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return channels, errors.Join(append(errs, err)...)
+	}
+	if len(emails) == 0 && e.phone == "" {
+		log.Printf("The %s of driver %s expires on %s, but nobody can be told outside the app\n", what, e.driver, date)
+	}
+	emailed := false
+	for _, email := range emails {
+		err := notify.Default.Send(ctx, notify.Message{
+			Channel: notify.Email,
+			To:      email,
+			Subject: subject,
+			Body: fmt.Sprintf("The %s of driver %s expires %s, on %s.\n"+
+				"Once it has expired the driver is not allowed to drive until a valid one is added.", what, e.driver, daysText(e.left), date),
+		})
+		emailed = emailed || err == nil
+		errs = append(errs, err)
+	}
+	if emailed {
+		channels = append(channels, notify.Email)
+	}
+	return channels, errors.Join(errs...)
+}
+
+func daysText(days int) string {
+	switch days {
+	case 0:
+		return "today"
+	case 1:
+		return "tomorrow"
+	}
+	return "in " + strconv.Itoa(days) + " days"
+}
@@ -0,0 +1,104 @@
+package documents
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDueAlert(t *testing.T) {
+	alertDays = []int{3, 14, 30}
+	defer func() { alertDays = nil }()
+
+	tests := []struct {
+		left int
+		days int
+		ok   bool
+	}{
+		{45, 0, false},
+		{31, 0, false},
+		{30, 30, true},
+		{20, 30, true},
+		{14, 14, true},
+		// Found late: one alert at the stage it is in, not one per stage
+		{5, 14, true},
+		{3, 3, true},
+		{0, 3, true},
+	}
+	for _, tt := range tests {
+		days, ok := dueAlert(tt.left)
+		if days != tt.days || ok != tt.ok {
+			t.Errorf("dueAlert(%d) = %d, %v; want %d, %v", tt.left, days, ok, tt.days, tt.ok)
+		}
+	}
+}
+
+func TestDaysText(t *testing.T) {
+	for days, want := range map[int]string{0: "today", 1: "tomorrow", 14: "in 14 days"} {
+		if got := daysText(days); got != want {
+			t.Errorf("daysText(%d) = %q, want %q", days, got, want)
+		}
+	}
+}
+
+func TestValidType(t *testing.T) {
+	if !ValidType(Licence) || !ValidType(TachographCard) || ValidType("Licence") || ValidType("") {
+		t.Error("ValidType does not match Types")
+	}
+}
+
+// failingReader returns some data and then an error, like an upload cut off.
+type failingReader struct{ data io.Reader }
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.data.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestSave(t *testing.T) {
+	dir = t.TempDir()
+	pdf := append([]byte("%PDF-1.7\n"), bytes.Repeat([]byte("x"), 2000)...)
+
+	key, contentType, err := Save(1, 2, bytes.NewReader(pdf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/pdf" || filepath.Ext(key) != ".pdf" {
+		t.Errorf("Save = %q, %q; want a PDF", key, contentType)
+	}
+	f, err := Open(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := io.ReadAll(f)
+	f.Close()
+	if !bytes.Equal(stored, pdf) {
+		t.Errorf("stored %d bytes, want the %d uploaded", len(stored), len(pdf))
+	}
+
+	if _, _, err := Save(1, 2, bytes.NewReader([]byte("<html><script>"))); err != ErrFileType {
+		t.Errorf("HTML upload: got %v, want ErrFileType", err)
+	}
+
+	// A cut off upload leaves no file behind
+	if _, _, err := Save(1, 2, &failingReader{bytes.NewReader(pdf)}); err == nil {
+		t.Error("cut off upload saved")
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "1", "2"))
+	if len(entries) != 1 {
+		t.Errorf("%d files after a cut off upload, want only the first scan", len(entries))
+	}
+
+	if err := Remove(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := Remove(key); err != nil {
+		t.Errorf("removing a removed scan: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+// Package export writes device tracks as GPX 1.1, KML and GeoJSON documents.
+// Writers stream their output so a track never has to be held in memory.
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+	"tm/models"
+)
+
+// Writer emits one track document. Begin is called once with the document
+// name and the events of the track, then Point once per location in
+// chronological order, then End.
+type Writer interface {
+	Begin(name string, events []models.Event) error
+	Point(location models.DeviceLocation) error
+	End() error
+}
+
+// Format describes an export format.
+type Format struct {
+	ContentType string
+	Extension   string
+	New         func(w *bufio.Writer) Writer
+}
+
+// Formats are the supported export formats by name.
+var Formats = map[string]Format{
+	"gpx":     {ContentType: "application/gpx+xml", Extension: "gpx", New: func(w *bufio.Writer) Writer { return &gpxWriter{w: w} }},
+	"kml":     {ContentType: "application/vnd.google-earth.kml+xml", Extension: "kml", New: func(w *bufio.Writer) Writer { return &kmlWriter{w: w} }},
+	"geojson": {ContentType: "application/geo+json", Extension: "geojson", New: func(w *bufio.Writer) Writer { return &geojsonWriter{w: w} }},
+}
+
+func escape(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+func isoTime(ts int64) string {
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
+
+func eventName(e models.Event) string {
+	if e.Type == "overspeed" {
+		return fmt.Sprintf("Overspeed %.0f km/h (limit %.0f km/h)", e.MaxSpeed, e.SpeedLimit)
+	}
+	return e.Type
+}
+
+type gpxWriter struct {
+	w *bufio.Writer
+}
+
+func (g *gpxWriter) Begin(name string, events []models.Event) error {
+	fmt.Fprintf(g.w, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(g.w, `<gpx version="1.1" creator="tm" xmlns="http://www.topografix.com/GPX/1/1">`+"\n")
+	fmt.Fprintf(g.w, "<metadata><name>%s</name></metadata>\n", escape(name))
+	for _, e := range events {
+		fmt.Fprintf(g.w, `<wpt lat="%f" lon="%f"><time>%s</time><name>%s</name><type>%s</type></wpt>`+"\n",
+			e.Latitude, e.Longitude, isoTime(e.StartTime), escape(eventName(e)), escape(e.Type))
+	}
+	_, err := fmt.Fprintf(g.w, "<trk><name>%s</name><trkseg>\n", escape(name))
+	return err
+}
+
+func (g *gpxWriter) Point(l models.DeviceLocation) error {
+	_, err := fmt.Fprintf(g.w, `<trkpt lat="%f" lon="%f"><time>%s</time></trkpt>`+"\n", l.Latitude, l.Longitude, isoTime(l.Timestamp))
+	return err
+}
+
+func (g *gpxWriter) End() error {
+	_, err := g.w.WriteString("</trkseg></trk>\n</gpx>\n")
+	return err
+}
+
+// kmlWriter holds back the first point of the track, since a LineString
+// needs two. A track of a single point is written as a Point, and an empty
+// one as no placemark at all.
+type kmlWriter struct {
+	w      *bufio.Writer
+	name   string
+	first  models.DeviceLocation
+	points int
+}
+
+func (k *kmlWriter) Begin(name string, events []models.Event) error {
+	k.name = name
+	fmt.Fprintf(k.w, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(k.w, `<kml xmlns="http://www.opengis.net/kml/2.2"><Document><name>%s</name>`+"\n", escape(name))
+	for _, e := range events {
+		fmt.Fprintf(k.w, "<Placemark><name>%s</name><TimeStamp><when>%s</when></TimeStamp><Point><coordinates>%f,%f</coordinates></Point></Placemark>\n",
+			escape(eventName(e)), isoTime(e.StartTime), e.Longitude, e.Latitude)
+	}
+	return nil
+}
+
+func (k *kmlWriter) Point(l models.DeviceLocation) error {
+	k.points++
+	switch k.points {
+	case 1:
+		k.first = l
+		return nil
+	case 2:
+		fmt.Fprintf(k.w, "<Placemark><name>%s</name><LineString><tessellate>1</tessellate><coordinates>\n", escape(k.name))
+		fmt.Fprintf(k.w, "%f,%f\n", k.first.Longitude, k.first.Latitude)
+	}
+	_, err := fmt.Fprintf(k.w, "%f,%f\n", l.Longitude, l.Latitude)
+	return err
+}
+
+func (k *kmlWriter) End() error {
+	switch {
+	case k.points == 1:
+		fmt.Fprintf(k.w, "<Placemark><name>%s</name><TimeStamp><when>%s</when></TimeStamp><Point><coordinates>%f,%f</coordinates></Point></Placemark>\n",
+			escape(k.name), isoTime(k.first.Timestamp), k.first.Longitude, k.first.Latitude)
+	case k.points > 1:
+		k.w.WriteString("</coordinates></LineString></Placemark>\n")
+	}
+	_, err := k.w.WriteString("</Document></kml>\n")
+	return err
+}
+
+// geojsonWriter writes a FeatureCollection whose first feature is the track,
+// followed by one Point feature per event. Like KML, GeoJSON needs two
+// positions for a LineString, so the track of a single point is a Point and
+// an empty track has no geometry.
+type geojsonWriter struct {
+	w      *bufio.Writer
+	name   string
+	events []models.Event
+	first  models.DeviceLocation
+	points int
+	start  int64
+	end    int64
+}
+
+func (g *geojsonWriter) Begin(name string, events []models.Event) error {
+	g.name, g.events = name, events
+	_, err := g.w.WriteString(`{"type":"FeatureCollection","features":[{"type":"Feature","geometry":`)
+	return err
+}
+
+func (g *geojsonWriter) Point(l models.DeviceLocation) error {
+	g.points++
+	g.end = l.Timestamp
+	switch g.points {
+	case 1:
+		g.first, g.start = l, l.Timestamp
+		return nil
+	case 2:
+		fmt.Fprintf(g.w, `{"type":"LineString","coordinates":[[%f,%f]`, g.first.Longitude, g.first.Latitude)
+	}
+	_, err := fmt.Fprintf(g.w, ",[%f,%f]", l.Longitude, l.Latitude)
+	return err
+}
+
+func (g *geojsonWriter) End() error {
+	switch {
+	case g.points == 0:
+		g.w.WriteString("null")
+	case g.points == 1:
+		fmt.Fprintf(g.w, `{"type":"Point","coordinates":[%f,%f]}`, g.first.Longitude, g.first.Latitude)
+	default:
+		g.w.WriteString("]}")
+	}
+	props, err := json.Marshal(map[string]interface{}{"name": g.name, "points": g.points, "start": g.start, "end": g.end})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(g.w, `,"properties":%s}`, props)
+
+	for _, e := range g.events {
+		props, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(g.w, `,{"type":"Feature","geometry":{"type":"Point","coordinates":[%f,%f]},"properties":%s}`, e.Longitude, e.Latitude, props)
+	}
+	_, err = g.w.WriteString("]}\n")
+	return err
+}
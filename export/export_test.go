@@ -0,0 +1,136 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"tm/models"
+)
+
+func write(t *testing.T, format string, points int, events []models.Event) string {
+	t.Helper()
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	w := Formats[format].New(bw)
+	if err := w.Begin("Device <1>", events); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < points; i++ {
+		if err := w.Point(models.DeviceLocation{Timestamp: int64(1000 + i), Latitude: 50 + float64(i)/100, Longitude: 8}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.End(); err != nil {
+		t.Fatal(err)
+	}
+	bw.Flush()
+	return buf.String()
+}
+
+var overspeed = []models.Event{{Type: "overspeed", StartTime: 1001, Latitude: 50.01, Longitude: 8, MaxSpeed: 104, SpeedLimit: 90}}
+
+func TestGeoJSONGeometry(t *testing.T) {
+	for points, want := range map[int]string{0: "", 1: "Point", 2: "LineString", 5: "LineString"} {
+		out := write(t, "geojson", points, overspeed)
+		var doc struct {
+			Features []struct {
+				Geometry *struct {
+					Type        string          `json:"type"`
+					Coordinates json.RawMessage `json:"coordinates"`
+				} `json:"geometry"`
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"features"`
+		}
+		if err := json.Unmarshal([]byte(out), &doc); err != nil {
+			t.Fatalf("%d points: invalid JSON %v: %s", points, err, out)
+		}
+		if len(doc.Features) != 2 {
+			t.Fatalf("%d points: %d features, want the track and the event", points, len(doc.Features))
+		}
+		track := doc.Features[0]
+		got := ""
+		if track.Geometry != nil {
+			got = track.Geometry.Type
+		}
+		if got != want {
+			t.Errorf("%d points: track geometry %q, want %q", points, got, want)
+		}
+		if want == "LineString" {
+			var coords [][2]float64
+			json.Unmarshal(track.Geometry.Coordinates, &coords)
+			if len(coords) != points {
+				t.Errorf("%d points: LineString of %d positions", points, len(coords))
+			}
+		}
+		if track.Properties["points"] != float64(points) {
+			t.Errorf("%d points: properties %v", points, track.Properties)
+		}
+	}
+}
+
+func TestKMLGeometry(t *testing.T) {
+	type placemark struct {
+		Name       string `xml:"name"`
+		LineString *struct {
+			Coordinates string `xml:"coordinates"`
+		} `xml:"LineString"`
+		Point *struct{} `xml:"Point"`
+	}
+	for _, points := range []int{0, 1, 2, 5} {
+		out := write(t, "kml", points, overspeed)
+		var doc struct {
+			Placemarks []placemark `xml:"Document>Placemark"`
+		}
+		if err := xml.Unmarshal([]byte(out), &doc); err != nil {
+			t.Fatalf("%d points: invalid XML %v: %s", points, err, out)
+		}
+		var track *placemark
+		for i, p := range doc.Placemarks {
+			if p.Name == "Device <1>" {
+				track = &doc.Placemarks[i]
+			}
+		}
+		switch {
+		case points == 0:
+			if track != nil {
+				t.Errorf("empty track written as a placemark")
+			}
+		case points == 1:
+			if track == nil || track.Point == nil || track.LineString != nil {
+				t.Errorf("single point track = %+v, want a Point", track)
+			}
+		default:
+			if track == nil || track.LineString == nil {
+				t.Fatalf("%d points: no LineString in %s", points, out)
+			}
+			if n := len(strings.Fields(track.LineString.Coordinates)); n != points {
+				t.Errorf("%d points: LineString of %d coordinates", points, n)
+			}
+		}
+	}
+}
+
+func TestGPX(t *testing.T) {
+	out := write(t, "gpx", 3, overspeed)
+	var doc struct {
+		Waypoints []struct {
+			Name string `xml:"name"`
+		} `xml:"wpt"`
+		Points []struct {
+			Lat  float64 `xml:"lat,attr"`
+			Time string  `xml:"time"`
+		} `xml:"trk>trkseg>trkpt"`
+	}
+	if err := xml.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("invalid XML %v: %s", err, out)
+	}
+	if len(doc.Points) != 3 || doc.Points[0].Time != "1970-01-01T00:16:40Z" || doc.Points[2].Lat != 50.02 {
+		t.Errorf("track points = %+v", doc.Points)
+	}
+	if len(doc.Waypoints) != 1 || doc.Waypoints[0].Name != "Overspeed 104 km/h (limit 90 km/h)" {
+		t.Errorf("waypoints = %+v", doc.Waypoints)
+	}
+}
@@ -0,0 +1,52 @@
+// Package geo holds the small amount of spherical geometry the tracking
+// endpoints need: distances, bearings and speeds between GPS fixes.
+package geo
+
+import "math"
+
+// EarthRadius is the mean Earth radius in meters.
+const EarthRadius = 6371008.8
+
+func toRad(deg float64) float64 { return deg * math.Pi / 180 }
+func toDeg(rad float64) float64 { return rad * 180 / math.Pi }
+
+// Distance returns the great-circle distance in meters between two points.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := toRad(lat1), toRad(lat2)
+	dPhi := toRad(lat2 - lat1)
+	dLambda := toRad(lon2 - lon1)
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Bearing returns the initial bearing in degrees (0-360, clockwise from north)
+// from the first point to the second.
+func Bearing(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := toRad(lat1), toRad(lat2)
+	dLambda := toRad(lon2 - lon1)
+
+	y := math.Sin(dLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+	return math.Mod(toDeg(math.Atan2(y, x))+360, 360)
+}
+
+// SpeedKmh returns the average speed in km/h needed to cover the distance
+// between two fixes taken at the given unix timestamps. ok is false when the
+// fixes are not strictly ordered in time and no speed can be derived.
+func SpeedKmh(lat1, lon1 float64, ts1 int64, lat2, lon2 float64, ts2 int64) (speed float64, ok bool) {
+	dt := ts2 - ts1
+	if dt <= 0 {
+		return 0, false
+	}
+	return Distance(lat1, lon1, lat2, lon2) / float64(dt) * 3.6, true
+}
+
+// DistanceToSegment returns the distance in meters from a point to the
+// segment between two other points. It uses a local flat projection, so the
+// segment should be short compared to the size of the Earth.
+func DistanceToSegment(lat, lon, lat1, lon1, lat2, lon2 float64) float64 {
+	xy := planar([]Point{{lat, lon}, {lat1, lon1}, {lat2, lon2}})
+	return segmentDistance(xy[0], xy[1], xy[2])
+}
@@ -0,0 +1,220 @@
+package geo
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func near(a, b, tolerance float64) bool { return math.Abs(a-b) <= tolerance }
+
+func TestDistance(t *testing.T) {
+	// A degree of a great circle
+	if d := Distance(0, 0, 0, 1); !near(d, 2*math.Pi*EarthRadius/360, 0.01) {
+		t.Errorf("one degree along the equator = %f m", d)
+	}
+	if d := Distance(10, 20, 11, 20); !near(d, 2*math.Pi*EarthRadius/360, 0.01) {
+		t.Errorf("one degree along a meridian = %f m", d)
+	}
+	// Paris to London, about 344 km
+	if d := Distance(48.8566, 2.3522, 51.5074, -0.1278); !near(d, 343.5e3, 1e3) {
+		t.Errorf("Paris to London = %f m", d)
+	}
+	if d := Distance(0, 0, 0, 180); !near(d, math.Pi*EarthRadius, 0.01) {
+		t.Errorf("antipodes = %f m", d)
+	}
+}
+
+func TestBearing(t *testing.T) {
+	tests := []struct {
+		lat2, lon2, want float64
+	}{
+		{1, 0, 0},
+		{0, 1, 90},
+		{-1, 0, 180},
+		{0, -1, 270},
+	}
+	for _, tt := range tests {
+		if got := Bearing(0, 0, tt.lat2, tt.lon2); !near(got, tt.want, 1e-9) {
+			t.Errorf("Bearing to (%v, %v) = %f, want %f", tt.lat2, tt.lon2, got, tt.want)
+		}
+	}
+}
+
+func TestSpeedKmh(t *testing.T) {
+	// One degree along the equator in an hour
+	speed, ok := SpeedKmh(0, 0, 0, 0, 1, 3600)
+	if !ok || !near(speed, 2*math.Pi*EarthRadius/360/1000, 1e-6) {
+		t.Errorf("SpeedKmh = %f, %v", speed, ok)
+	}
+	for _, ts2 := range []int64{0, -10} {
+		if _, ok := SpeedKmh(0, 0, 0, 0, 1, ts2); ok {
+			t.Errorf("speed derived for fixes %d s apart", ts2)
+		}
+	}
+}
+
+func TestDistanceToSegment(t *testing.T) {
+	// 0.001° of latitude off the middle of an east-west segment
+	d := DistanceToSegment(0.001, 0.0005, 0, 0, 0, 0.001)
+	if !near(d, Distance(0, 0, 0.001, 0), 0.01) {
+		t.Errorf("distance to the middle = %f m", d)
+	}
+	// Beyond the end it is the distance to the end point
+	d = DistanceToSegment(0, 0.002, 0, 0, 0, 0.001)
+	if !near(d, Distance(0, 0.001, 0, 0.002), 0.01) {
+		t.Errorf("distance past the end = %f m", d)
+	}
+}
+
+func TestEncodePolyline(t *testing.T) {
+	// The example of the algorithm's documentation
+	points := []Point{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}
+	if got, want := EncodePolyline(points), "_p~iF~ps|U_ulLnnqC_mqNvxq`@"; got != want {
+		t.Errorf("EncodePolyline = %q, want %q", got, want)
+	}
+	if got := EncodePolyline(nil); got != "" {
+		t.Errorf("EncodePolyline(nil) = %q", got)
+	}
+}
+
+// track is a straight east-west line with a little noise and one detour.
+func track() []Point {
+	var points []Point
+	for i := 0; i <= 20; i++ {
+		lat := 0.0
+		if i%2 == 1 {
+			lat = 0.000005 // about half a meter
+		}
+		if i == 10 {
+			lat = 0.001 // about 111 m
+		}
+		points = append(points, Point{lat, float64(i) * 0.001})
+	}
+	return points
+}
+
+func TestSimplify(t *testing.T) {
+	points := track()
+	// Visvalingam compares areas, which grow with the length of the
+	// neighbouring segments, so noise on a long line needs a larger
+	// tolerance to go.
+	tests := []struct {
+		name      string
+		simplify  func([]Point, float64) []int
+		tolerance float64
+	}{
+		{"DouglasPeucker", SimplifyDouglasPeucker, 10},
+		{"Visvalingam", SimplifyVisvalingam, 30},
+	}
+	for _, tt := range tests {
+		name, simplify := tt.name, tt.simplify
+		kept := simplify(points, tt.tolerance)
+		if kept[0] != 0 || kept[len(kept)-1] != len(points)-1 {
+			t.Errorf("%s dropped an end point: %v", name, kept)
+		}
+		detour := false
+		for _, i := range kept {
+			detour = detour || i == 10
+		}
+		if !detour {
+			t.Errorf("%s dropped the detour: %v", name, kept)
+		}
+		if len(kept) > 5 {
+			t.Errorf("%s kept the noise: %v", name, kept)
+		}
+
+		if got := simplify(points, 0); len(got) != len(points) {
+			t.Errorf("%s with no tolerance kept %d of %d points", name, len(got), len(points))
+		}
+		short := points[:2]
+		if got := simplify(short, tt.tolerance); !reflect.DeepEqual(got, []int{0, 1}) {
+			t.Errorf("%s of two points = %v", name, got)
+		}
+	}
+}
+
+// No point dropped by Douglas-Peucker is further than the tolerance from
+// the simplified line.
+func TestDouglasPeuckerTolerance(t *testing.T) {
+	points := track()
+	kept := SimplifyDouglasPeucker(points, 0.1)
+	for k := 0; k+1 < len(kept); k++ {
+		a, b := points[kept[k]], points[kept[k+1]]
+		for i := kept[k] + 1; i < kept[k+1]; i++ {
+			if d := DistanceToSegment(points[i].Lat, points[i].Lon, a.Lat, a.Lon, b.Lat, b.Lon); d > 0.1 {
+				t.Errorf("point %d is %f m off the simplified line", i, d)
+			}
+		}
+	}
+}
+
+func TestGrid(t *testing.T) {
+	g := NewGrid[string](0.1)
+	g.Add("here", 50.01, 8.01)
+	g.Add("next", 50.11, 8.01)
+	g.Add("far", 50.51, 8.01)
+
+	found := func(r int) map[string]bool {
+		keys := map[string]bool{}
+		g.Ring(50.01, 8.01, r, func(k string) { keys[k] = true })
+		return keys
+	}
+	if got := found(0); !reflect.DeepEqual(got, map[string]bool{"here": true}) {
+		t.Errorf("ring 0 = %v", got)
+	}
+	if got := found(1); !reflect.DeepEqual(got, map[string]bool{"next": true}) {
+		t.Errorf("ring 1 = %v", got)
+	}
+	if got := found(5); !got["far"] {
+		t.Errorf("ring 5 = %v", got)
+	}
+
+	g.Remove("here", 50.01, 8.01)
+	if got := found(0); len(got) != 0 {
+		t.Errorf("ring 0 after remove = %v", got)
+	}
+
+	// The lower bound must not exceed the real distance to ring r
+	if d := g.RingDistance(50.01, 5); d > Distance(50.01, 8.01, 50.51, 8.01) {
+		t.Errorf("RingDistance(5) = %f m is more than the distance to a key in it", d)
+	}
+}
+
+func TestGridAntimeridian(t *testing.T) {
+	g := NewGrid[string](0.1)
+	g.Add("east", 10, 179.95)
+	g.Add("west", 10, -179.95)
+
+	for _, tt := range []struct {
+		lon  float64
+		want string
+	}{
+		{179.95, "west"},
+		{-179.95, "east"},
+	} {
+		keys := map[string]bool{}
+		g.Ring(10, tt.lon, 1, func(k string) { keys[k] = true })
+		if !reflect.DeepEqual(keys, map[string]bool{tt.want: true}) {
+			t.Errorf("ring 1 around %v = %v, want %s across the antimeridian", tt.lon, keys, tt.want)
+		}
+	}
+
+	// 179.9 and -179.9 are about 22 km apart, two columns across
+	g.Add("across", 10, -179.9)
+	keys := map[string]bool{}
+	g.Ring(10, 179.9, 2, func(k string) { keys[k] = true })
+	if !keys["across"] {
+		t.Errorf("ring 2 around 179.9 = %v, want across", keys)
+	}
+	if d := g.RingDistance(10, 2); d > Distance(10, 179.9, 10, -179.9) {
+		t.Errorf("RingDistance(2) = %f m is more than the distance across the antimeridian", d)
+	}
+
+	g.Remove("west", 10, -179.95)
+	keys = map[string]bool{}
+	g.Ring(10, 179.95, 1, func(k string) { keys[k] = true })
+	if keys["west"] {
+		t.Errorf("west still found after remove: %v", keys)
+	}
+}
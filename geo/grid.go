@@ -0,0 +1,101 @@
+package geo
+
+import "math"
+
+type cell struct{ lat, lon int }
+
+// Grid is a spatial index that buckets keys into square cells of a fixed
+// size in degrees. It answers "what is near this point" by walking rings of
+// cells outwards from the cell containing the point. Columns wrap around at
+// the antimeridian, so cells on both sides of it are neighbours; cellSize
+// should divide 360.
+type Grid[K comparable] struct {
+	cellSize float64
+	cells    map[cell]map[K]struct{}
+}
+
+// NewGrid returns an empty grid with cells of cellSize degrees.
+func NewGrid[K comparable](cellSize float64) *Grid[K] {
+	return &Grid[K]{cellSize: cellSize, cells: make(map[cell]map[K]struct{})}
+}
+
+func (g *Grid[K]) cellOf(lat, lon float64) cell {
+	return g.at(int(math.Floor(lat/g.cellSize)), int(math.Floor(lon/g.cellSize)))
+}
+
+// at returns the cell in row lat and column lon, taking the column modulo
+// the number of columns around the globe.
+func (g *Grid[K]) at(lat, lon int) cell {
+	columns := int(math.Round(360 / g.cellSize))
+	return cell{lat, ((lon % columns) + columns) % columns}
+}
+
+// Add indexes key at a point.
+func (g *Grid[K]) Add(key K, lat, lon float64) {
+	g.add(key, g.cellOf(lat, lon))
+}
+
+// AddBox indexes key in every cell overlapping the bounding box, which is how
+// line segments and other extended shapes are stored.
+func (g *Grid[K]) AddBox(key K, minLat, minLon, maxLat, maxLon float64) {
+	// Columns before wrapping, so the loop does not run the long way round
+	loLat, hiLat := int(math.Floor(minLat/g.cellSize)), int(math.Floor(maxLat/g.cellSize))
+	loLon, hiLon := int(math.Floor(minLon/g.cellSize)), int(math.Floor(maxLon/g.cellSize))
+	for la := loLat; la <= hiLat; la++ {
+		for lo := loLon; lo <= hiLon; lo++ {
+			g.add(key, g.at(la, lo))
+		}
+	}
+}
+
+func (g *Grid[K]) add(key K, c cell) {
+	bucket, ok := g.cells[c]
+	if !ok {
+		bucket = make(map[K]struct{})
+		g.cells[c] = bucket
+	}
+	bucket[key] = struct{}{}
+}
+
+// Remove drops key from the cell of a point it was added at.
+func (g *Grid[K]) Remove(key K, lat, lon float64) {
+	c := g.cellOf(lat, lon)
+	if bucket, ok := g.cells[c]; ok {
+		delete(bucket, key)
+		if len(bucket) == 0 {
+			delete(g.cells, c)
+		}
+	}
+}
+
+// Ring calls fn for every key in the cells exactly r cells away (in the
+// Chebyshev sense) from the cell containing the point, counting columns
+// across the antimeridian. A key stored in several cells, or in a cell that
+// a wide ring reaches both ways round, may be reported more than once.
+func (g *Grid[K]) Ring(lat, lon float64, r int, fn func(K)) {
+	center := cell{int(math.Floor(lat / g.cellSize)), int(math.Floor(lon / g.cellSize))}
+	for la := center.lat - r; la <= center.lat+r; la++ {
+		for lo := center.lon - r; lo <= center.lon+r; lo++ {
+			if r > 0 && la != center.lat-r && la != center.lat+r && lo != center.lon-r && lo != center.lon+r {
+				continue
+			}
+			for key := range g.cells[g.at(la, lo)] {
+				fn(key)
+			}
+		}
+	}
+}
+
+// RingDistance returns a lower bound, in meters, on the distance from a point
+// at latitude lat to anything in ring r or further out. The point may sit on
+// the edge of its own cell, so ring r is only guaranteed to be r-1 cells away.
+func (g *Grid[K]) RingDistance(lat float64, r int) float64 {
+	if r <= 1 {
+		return 0
+	}
+	// A cell is narrowest in longitude at the pole-ward edge of the rings.
+	edge := math.Min(90, math.Abs(lat)+float64(r)*g.cellSize)
+	width := toRad(g.cellSize) * EarthRadius * math.Cos(toRad(edge))
+	height := toRad(g.cellSize) * EarthRadius
+	return float64(r-1) * math.Min(width, height)
+}
@@ -0,0 +1,175 @@
+package geo
+
+import (
+	"container/heap"
+	"math"
+)
+
+// Point is a position in degrees.
+type Point struct {
+	Lat, Lon float64
+}
+
+// planar projects points onto a local equirectangular plane in meters, which
+// is accurate enough for tolerances of a few meters up to a few kilometers.
+func planar(points []Point) [][2]float64 {
+	if len(points) == 0 {
+		return nil
+	}
+	var sumLat float64
+	for _, p := range points {
+		sumLat += p.Lat
+	}
+	k := math.Cos(toRad(sumLat / float64(len(points))))
+
+	xy := make([][2]float64, len(points))
+	for i, p := range points {
+		xy[i] = [2]float64{toRad(p.Lon) * k * EarthRadius, toRad(p.Lat) * EarthRadius}
+	}
+	return xy
+}
+
+// segmentDistance returns the distance from p to the segment a-b.
+func segmentDistance(p, a, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p[0]-a[0], p[1]-a[1])
+	}
+	t := ((p[0]-a[0])*dx + (p[1]-a[1])*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p[0]-(a[0]+t*dx), p[1]-(a[1]+t*dy))
+}
+
+// SimplifyDouglasPeucker returns the indexes of the points kept by the
+// Ramer-Douglas-Peucker algorithm. No dropped point lies further than
+// tolerance meters from the simplified line. The first and last points are
+// always kept.
+func SimplifyDouglasPeucker(points []Point, tolerance float64) []int {
+	if len(points) < 3 || tolerance <= 0 {
+		return allIndexes(len(points))
+	}
+	xy := planar(points)
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+
+	// An explicit stack avoids deep recursion on tracks with many points.
+	stack := [][2]int{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		first, last := stack[len(stack)-1][0], stack[len(stack)-1][1]
+		stack = stack[:len(stack)-1]
+
+		maxDist, index := 0.0, -1
+		for i := first + 1; i < last; i++ {
+			if d := segmentDistance(xy[i], xy[first], xy[last]); d > maxDist {
+				maxDist, index = d, i
+			}
+		}
+		if index != -1 && maxDist > tolerance {
+			keep[index] = true
+			stack = append(stack, [2]int{first, index}, [2]int{index, last})
+		}
+	}
+	return keptIndexes(keep)
+}
+
+// SimplifyVisvalingam returns the indexes of the points kept by the
+// Visvalingam-Whyatt algorithm. Points are removed while the triangle they
+// form with their neighbours is smaller than tolerance² square meters, so the
+// tolerance is comparable to the one of SimplifyDouglasPeucker.
+func SimplifyVisvalingam(points []Point, tolerance float64) []int {
+	n := len(points)
+	if n < 3 || tolerance <= 0 {
+		return allIndexes(n)
+	}
+	xy := planar(points)
+	minArea := tolerance * tolerance
+
+	prev := make([]int, n)
+	next := make([]int, n)
+	items := make([]*vertex, n)
+	h := make(vertexHeap, 0, n)
+	for i := range points {
+		prev[i], next[i] = i-1, i+1
+		if i > 0 && i < n-1 {
+			items[i] = &vertex{index: i, area: triangleArea(xy[i-1], xy[i], xy[i+1]), heapIndex: len(h)}
+			h = append(h, items[i])
+		}
+	}
+	heap.Init(&h)
+
+	keep := make([]bool, n)
+	for i := range keep {
+		keep[i] = true
+	}
+
+	maxRemoved := 0.0
+	for h.Len() > 0 {
+		v := heap.Pop(&h).(*vertex)
+		// Neighbouring areas never drop below the last removed area, otherwise
+		// the removal order would depend on the order points were visited.
+		maxRemoved = math.Max(maxRemoved, v.area)
+		if maxRemoved >= minArea {
+			break
+		}
+		keep[v.index] = false
+
+		p, nx := prev[v.index], next[v.index]
+		next[p], prev[nx] = nx, p
+		for _, j := range []int{p, nx} {
+			if items[j] == nil || !keep[j] {
+				continue
+			}
+			items[j].area = math.Max(maxRemoved, triangleArea(xy[prev[j]], xy[j], xy[next[j]]))
+			heap.Fix(&h, items[j].heapIndex)
+		}
+	}
+	return keptIndexes(keep)
+}
+
+func triangleArea(a, b, c [2]float64) float64 {
+	return math.Abs((a[0]*(b[1]-c[1]) + b[0]*(c[1]-a[1]) + c[0]*(a[1]-b[1])) / 2)
+}
+
+type vertex struct {
+	index     int
+	area      float64
+	heapIndex int
+}
+
+type vertexHeap []*vertex
+
+func (h vertexHeap) Len() int           { return len(h) }
+func (h vertexHeap) Less(i, j int) bool { return h[i].area < h[j].area }
+func (h vertexHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex, h[j].heapIndex = i, j
+}
+func (h *vertexHeap) Push(x interface{}) {
+	v := x.(*vertex)
+	v.heapIndex = len(*h)
+	*h = append(*h, v)
+}
+func (h *vertexHeap) Pop() interface{} {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
+
+func allIndexes(n int) []int {
+	indexes := make([]int, n)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	return indexes
+}
+
+func keptIndexes(keep []bool) []int {
+	var indexes []int
+	for i, k := range keep {
+		if k {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,194 @@
+// Package geocoder turns coordinates into readable places using locally
+// loaded GeoNames and OpenStreetMap extracts, without calling any external
+// service.
+package geocoder
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"tm/config"
+	"tm/geo"
+)
+
+const (
+	placeCellSize = 0.5  // degrees
+	roadCellSize  = 0.02 // degrees
+	maxPlaceRings = 20
+	maxRoadRings  = 3
+	// Roads further away than this are not worth naming.
+	maxRoadDistance = 500.0 // meters
+	cacheSize       = 10000
+)
+
+// Address is the readable description of a point.
+type Address struct {
+	Place   string `json:"place,omitempty"`
+	Region  string `json:"region,omitempty"`
+	Country string `json:"country,omitempty"`
+	Road    string `json:"road,omitempty"`
+}
+
+// String formats the address from the most to the least specific part,
+// e.g. "Magtymguly Avenue, Ashgabat, Ashgabat City, Turkmenistan".
+func (a Address) String() string {
+	var parts []string
+	for _, p := range []string{a.Road, a.Place, a.Region, a.Country} {
+		if p != "" && (len(parts) == 0 || parts[len(parts)-1] != p) {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+type place struct {
+	name, region, country string
+	lat, lon              float64
+}
+
+type segment struct {
+	name                   string
+	lat1, lon1, lat2, lon2 float64
+}
+
+// Geocoder answers reverse geocoding lookups from an in-memory dataset.
+type Geocoder struct {
+	places    []place
+	placeGrid *geo.Grid[int]
+	roads     []segment
+	roadGrid  *geo.Grid[int]
+	cache     *lru
+}
+
+// Files lists the dataset files to load. Only Cities is required.
+type Files struct {
+	Cities    string // GeoNames cities dump, e.g. cities15000.txt
+	Regions   string // GeoNames admin1CodesASCII.txt
+	Countries string // GeoNames countryInfo.txt
+	Roads     string // GeoJSON road lines from an OSM extract
+}
+
+// New loads the dataset files and builds the spatial indexes.
+func New(files Files) (*Geocoder, error) {
+	regions, countries := map[string]string{}, map[string]string{}
+	var err error
+	if files.Regions != "" {
+		if regions, err = loadRegions(files.Regions); err != nil {
+			return nil, err
+		}
+	}
+	if files.Countries != "" {
+		if countries, err = loadCountries(files.Countries); err != nil {
+			return nil, err
+		}
+	}
+
+	g := &Geocoder{
+		placeGrid: geo.NewGrid[int](placeCellSize),
+		roadGrid:  geo.NewGrid[int](roadCellSize),
+		cache:     newLRU(cacheSize),
+	}
+	if g.places, err = loadPlaces(files.Cities, regions, countries); err != nil {
+		return nil, err
+	}
+	for i, p := range g.places {
+		g.placeGrid.Add(i, p.lat, p.lon)
+	}
+
+	if files.Roads != "" {
+		if g.roads, err = loadRoads(files.Roads); err != nil {
+			return nil, err
+		}
+		for i, s := range g.roads {
+			g.roadGrid.AddBox(i, math.Min(s.lat1, s.lat2), math.Min(s.lon1, s.lon2), math.Max(s.lat1, s.lat2), math.Max(s.lon1, s.lon2))
+		}
+	}
+	return g, nil
+}
+
+// Lookup returns the address of the nearest known place and road.
+func (g *Geocoder) Lookup(lat, lon float64) Address {
+	// Four decimals is about 11 meters, well below the place resolution.
+	key := fmt.Sprintf("%.4f,%.4f", lat, lon)
+	if a, ok := g.cache.get(key); ok {
+		return a
+	}
+
+	var a Address
+	if i := g.nearestPlace(lat, lon); i >= 0 {
+		p := g.places[i]
+		a.Place, a.Region, a.Country = p.name, p.region, p.country
+	}
+	if i := g.nearestRoad(lat, lon); i >= 0 {
+		a.Road = g.roads[i].name
+	}
+
+	g.cache.put(key, a)
+	return a
+}
+
+func (g *Geocoder) nearestPlace(lat, lon float64) int {
+	best, bestDist := -1, math.Inf(1)
+	for r := 0; r <= maxPlaceRings; r++ {
+		if best >= 0 && g.placeGrid.RingDistance(lat, r) > bestDist {
+			break
+		}
+		g.placeGrid.Ring(lat, lon, r, func(i int) {
+			if d := geo.Distance(lat, lon, g.places[i].lat, g.places[i].lon); d < bestDist {
+				best, bestDist = i, d
+			}
+		})
+	}
+	return best
+}
+
+func (g *Geocoder) nearestRoad(lat, lon float64) int {
+	best, bestDist := -1, maxRoadDistance
+	for r := 0; r <= maxRoadRings; r++ {
+		if g.roadGrid.RingDistance(lat, r) > bestDist {
+			break
+		}
+		g.roadGrid.Ring(lat, lon, r, func(i int) {
+			s := g.roads[i]
+			if d := geo.DistanceToSegment(lat, lon, s.lat1, s.lon1, s.lat2, s.lon2); d < bestDist {
+				best, bestDist = i, d
+			}
+		})
+	}
+	return best
+}
+
+// Default is the geocoder used by the API, or nil when no dataset is configured.
+var Default *Geocoder
+
+// Init loads the configured dataset into Default. Reverse geocoding stays
+// disabled when no cities file is configured.
+func Init() {
+	files := Files{
+		Cities:    config.C.Geocoder.Cities,
+		Regions:   config.C.Geocoder.Regions,
+		Countries: config.C.Geocoder.Countries,
+		Roads:     config.C.Geocoder.Roads,
+	}
+	if files.Cities == "" {
+		log.Println("Reverse geocoding disabled: no cities file configured")
+		return
+	}
+
+	g, err := New(files)
+	if err != nil {
+		log.Fatalf("Unable to load geocoder dataset: %v\n", err)
+	}
+	Default = g
+	log.Printf("Reverse geocoder loaded %d places and %d road segments", len(g.places), len(g.roads))
+}
+
+// Describe returns the readable address of a point using Default, or an empty
+// string when reverse geocoding is disabled.
+func Describe(lat, lon float64) string {
+	if Default == nil {
+		return ""
+	}
+	return Default.Lookup(lat, lon).String()
+}
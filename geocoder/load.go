@@ -0,0 +1,160 @@
+package geocoder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readTSV calls fn with the fields of every non-comment line of a
+// tab-separated GeoNames file.
+func readTSV(path string, fn func(fields []string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if err := fn(strings.Split(text, "\t")); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// loadCountries reads countryInfo.txt into a map of ISO code to country name.
+func loadCountries(path string) (map[string]string, error) {
+	countries := make(map[string]string)
+	err := readTSV(path, func(fields []string) error {
+		if len(fields) < 5 {
+			return fmt.Errorf("expected at least 5 columns, got %d", len(fields))
+		}
+		countries[fields[0]] = fields[4]
+		return nil
+	})
+	return countries, err
+}
+
+// loadRegions reads admin1CodesASCII.txt into a map of "CC.code" to region name.
+func loadRegions(path string) (map[string]string, error) {
+	regions := make(map[string]string)
+	err := readTSV(path, func(fields []string) error {
+		if len(fields) < 2 {
+			return fmt.Errorf("expected at least 2 columns, got %d", len(fields))
+		}
+		regions[fields[0]] = fields[1]
+		return nil
+	})
+	return regions, err
+}
+
+// loadPlaces reads a GeoNames cities dump (e.g. cities15000.txt).
+func loadPlaces(path string, regions, countries map[string]string) ([]place, error) {
+	var places []place
+	err := readTSV(path, func(fields []string) error {
+		if len(fields) < 11 {
+			return fmt.Errorf("expected at least 11 columns, got %d", len(fields))
+		}
+		lat, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return err
+		}
+		lon, err := strconv.ParseFloat(fields[5], 64)
+		if err != nil {
+			return err
+		}
+		country := fields[8]
+		if name, ok := countries[country]; ok {
+			country = name
+		}
+		places = append(places, place{
+			name:    fields[1],
+			region:  regions[fields[8]+"."+fields[10]],
+			country: country,
+			lat:     lat,
+			lon:     lon,
+		})
+		return nil
+	})
+	return places, err
+}
+
+type geojsonRoads struct {
+	Features []struct {
+		Geometry struct {
+			Type        string          `json:"type"`
+			Coordinates json.RawMessage `json:"coordinates"`
+		} `json:"geometry"`
+		Properties struct {
+			Name string `json:"name"`
+			Ref  string `json:"ref"`
+		} `json:"properties"`
+	} `json:"features"`
+}
+
+// loadRoads reads a GeoJSON FeatureCollection of LineString and
+// MultiLineString road features, such as one exported from an OSM extract
+// with osmium or ogr2ogr, and splits it into named segments.
+func loadRoads(path string) ([]segment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fc geojsonRoads
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var segments []segment
+	for _, f := range fc.Features {
+		name := f.Properties.Name
+		if name == "" {
+			name = f.Properties.Ref
+		}
+		if name == "" {
+			continue
+		}
+
+		var lines [][][]float64
+		switch f.Geometry.Type {
+		case "LineString":
+			var line [][]float64
+			if err := json.Unmarshal(f.Geometry.Coordinates, &line); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			lines = append(lines, line)
+		case "MultiLineString":
+			if err := json.Unmarshal(f.Geometry.Coordinates, &lines); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		default:
+			continue
+		}
+
+		for _, line := range lines {
+			for i := 1; i < len(line); i++ {
+				if len(line[i-1]) < 2 || len(line[i]) < 2 {
+					continue
+				}
+				segments = append(segments, segment{
+					name: name,
+					lat1: line[i-1][1], lon1: line[i-1][0],
+					lat2: line[i][1], lon2: line[i][0],
+				})
+			}
+		}
+	}
+	return segments, nil
+}
@@ -0,0 +1,292 @@
+// Package loginguard slows down and locks out password guessing. Login
+// attempts are counted per username and per client IP in a Store before the
+// password is checked, and taken back if it was right; after a few free
+// attempts each further one has to wait longer, and too many lock the
+// username or IP for a while.
+package loginguard
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"tm/config"
+)
+
+// Reasons recorded for failed logins.
+const (
+	ReasonUnknownUser = "unknown_user"
+	ReasonBadPassword = "bad_password"
+	ReasonBadCode     = "bad_2fa_code"
+)
+
+// State is what a Store knows about the recent failures of one key.
+type State struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Failure is a failed login kept for review.
+type Failure struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	Reason    string    `json:"reason"`
+	OrgID     *int      `json:"orgId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// FailureQuery selects failed logins. Zero fields do not filter. Failures of
+// unknown usernames have no organization and are only included with
+// IncludeUnknown.
+type FailureQuery struct {
+	OrgID          int
+	IncludeUnknown bool
+	Username       string
+	IP             string
+	From, To       time.Time
+	Limit          int
+}
+
+// Store keeps failure counters and failed login records.
+type Store interface {
+	// Attempt counts an attempt of a key at now as a failure, starting over
+	// if the previous one is older than window, and returns the state from
+	// before it. It is atomic: of concurrent attempts each sees the others
+	// that came before it.
+	Attempt(ctx context.Context, key string, now time.Time, window time.Duration) (State, error)
+	// Release takes back the count of one attempt that turned out fine.
+	Release(ctx context.Context, key string) error
+	// Lock refuses a key until the given time.
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset forgets the failures and lock of a key.
+	Reset(ctx context.Context, key string) error
+	// Record keeps a failed login for review.
+	Record(ctx context.Context, f Failure) error
+	// Failures returns recorded failed logins, newest first.
+	Failures(ctx context.Context, q FailureQuery) ([]Failure, error)
+	// Prune forgets keys whose failures are older than window and whose
+	// lock is over, and failed logins recorded before keepSince.
+	Prune(ctx context.Context, now time.Time, window time.Duration, keepSince time.Time) error
+}
+
+// Policy sets how hard guessing is made. See config.Login.
+type Policy struct {
+	FreeAttempts    int
+	MaxUserFailures int
+	MaxIPFailures   int
+	Window          time.Duration
+	Lockout         time.Duration
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	// Retention is how long failed logins are kept for review.
+	Retention time.Duration
+}
+
+// Blocked is returned for login attempts that must not be checked.
+type Blocked struct {
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func (b *Blocked) Error() string {
+	if b.Locked {
+		return fmt.Sprintf("locked out, retry in %s", b.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed logins, retry in %s", b.RetryAfter.Round(time.Second))
+}
+
+// Guard applies a Policy using a Store.
+type Guard struct {
+	Store  Store
+	Policy Policy
+	now    func() time.Time
+}
+
+// New returns a Guard.
+func New(store Store, policy Policy) *Guard {
+	return &Guard{Store: store, Policy: policy, now: time.Now}
+}
+
+// Default is the Guard used by the login endpoint, set by Init.
+var Default *Guard
+
+// Init sets up Default from the configuration.
+func Init() {
+	cfg := config.C.Login
+	var store Store
+	switch cfg.Store {
+	case "memory":
+		store = NewMemoryStore()
+		log.Println("Login attempts are tracked in memory; use the postgres store when running several instances")
+	default:
+		store = PostgresStore{}
+	}
+	Default = New(store, Policy{
+		FreeAttempts:    cfg.FreeAttempts,
+		MaxUserFailures: cfg.MaxUserFailures,
+		MaxIPFailures:   cfg.MaxIPFailures,
+		Window:          cfg.Window,
+		Lockout:         cfg.Lockout,
+		BaseDelay:       cfg.BaseDelay,
+		MaxDelay:        cfg.MaxDelay,
+		Retention:       cfg.FailureRetention,
+	})
+}
+
+// PruneInterval is how often Run removes old attempts and failed logins.
+var PruneInterval = time.Hour
+
+// Run prunes the Store of Default now and then every PruneInterval. It never
+// returns.
+func Run() {
+	ticker := time.NewTicker(PruneInterval)
+	defer ticker.Stop()
+	for {
+		g := Default
+		now := g.now()
+		if err := g.Store.Prune(context.Background(), now, g.Policy.Window, now.Add(-g.Policy.Retention)); err != nil {
+			log.Println("Error pruning login attempts:", err)
+		}
+		<-ticker.C
+	}
+}
+
+func userKey(username string) string { return "user:" + strings.ToLower(username) }
+func ipKey(ip string) string         { return "ip:" + ip }
+
+// delay returns how long to wait after the last of n failures.
+func (g *Guard) delay(n int) time.Duration {
+	if n <= g.Policy.FreeAttempts {
+		return 0
+	}
+	d := g.Policy.BaseDelay
+	for i := g.Policy.FreeAttempts + 1; i < n && d < g.Policy.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > g.Policy.MaxDelay {
+		d = g.Policy.MaxDelay
+	}
+	return d
+}
+
+// blocked returns a *Blocked if a key may not try now.
+func (g *Guard) blocked(s State, now time.Time) *Blocked {
+	if now.Before(s.LockedUntil) {
+		return &Blocked{Locked: true, RetryAfter: s.LockedUntil.Sub(now)}
+	}
+	if s.Failures == 0 || now.Sub(s.LastFailure) > g.Policy.Window {
+		return nil
+	}
+	if wait := s.LastFailure.Add(g.delay(s.Failures)).Sub(now); wait > 0 {
+		return &Blocked{RetryAfter: wait}
+	}
+	return nil
+}
+
+// limit is a key counted for every attempt and its maximum failures.
+type limit struct {
+	key string
+	max int
+}
+
+func (g *Guard) limits(username, ip string) [2]limit {
+	return [2]limit{
+		{userKey(username), g.Policy.MaxUserFailures},
+		{ipKey(ip), g.Policy.MaxIPFailures},
+	}
+}
+
+// Attempt is a login attempt counted by Begin. It counts as failed unless
+// Passed or Cancel is called.
+type Attempt struct {
+	g        *Guard
+	limits   [2]limit
+	failures [2]int // of each key, this attempt included
+	now      time.Time
+}
+
+// Begin counts a login attempt for username from ip before the password is
+// checked, so parallel guesses cannot all get through before any of them has
+// failed. It returns a *Blocked error if the attempt must be refused without
+// looking at the password; refused attempts count too.
+func (g *Guard) Begin(ctx context.Context, username, ip string) (*Attempt, error) {
+	a := &Attempt{g: g, limits: g.limits(username, ip), now: g.now()}
+	var worst *Blocked
+	for i, l := range a.limits {
+		before, err := g.Store.Attempt(ctx, l.key, a.now, g.Policy.Window)
+		if err != nil {
+			return nil, err
+		}
+		a.failures[i] = before.Failures + 1
+		if b := g.blocked(before, a.now); b != nil && (worst == nil || b.RetryAfter > worst.RetryAfter) {
+			worst = b
+		}
+	}
+	if worst != nil {
+		if err := a.lock(ctx); err != nil {
+			return nil, err
+		}
+		return nil, worst
+	}
+	return a, nil
+}
+
+// lock locks the keys that have failed too often.
+func (a *Attempt) lock(ctx context.Context) error {
+	for i, l := range a.limits {
+		if a.failures[i] >= l.max {
+			if err := a.g.Store.Lock(ctx, l.key, a.now.Add(a.g.Policy.Lockout)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Failed locks the username or IP of a failed attempt when either has failed
+// too often, and records the failure.
+func (a *Attempt) Failed(ctx context.Context, f Failure) error {
+	if err := a.lock(ctx); err != nil {
+		return err
+	}
+	f.CreatedAt = a.now
+	return a.g.Store.Record(ctx, f)
+}
+
+// Passed takes back the count of an attempt whose password or code was
+// right. Earlier failures of the username stay until Succeeded.
+func (a *Attempt) Passed(ctx context.Context) error {
+	return a.release(ctx)
+}
+
+// Cancel takes back the count of an attempt that ended before its password or
+// code could be checked, such as on a database error, so an outage does not
+// lock out real users.
+func (a *Attempt) Cancel(ctx context.Context) error {
+	return a.release(ctx)
+}
+
+func (a *Attempt) release(ctx context.Context) error {
+	for _, l := range a.limits {
+		if err := a.g.Store.Release(ctx, l.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Succeeded forgets the failures of a username after a successful login. The
+// IP keeps its count, so one valid account cannot be used to keep guessing
+// at others.
+func (g *Guard) Succeeded(ctx context.Context, username string) error {
+	return g.Store.Reset(ctx, userKey(username))
+}
+
+// Unlock lifts the lockout of a username.
+func (g *Guard) Unlock(ctx context.Context, username string) error {
+	return g.Store.Reset(ctx, userKey(username))
+}
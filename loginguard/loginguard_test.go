@@ -0,0 +1,205 @@
+package loginguard
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestGuard(now *time.Time) *Guard {
+	g := New(NewMemoryStore(), Policy{
+		FreeAttempts:    2,
+		MaxUserFailures: 5,
+		MaxIPFailures:   50,
+		Window:          15 * time.Minute,
+		Lockout:         15 * time.Minute,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		Retention:       24 * time.Hour,
+	})
+	g.now = func() time.Time { return *now }
+	return g
+}
+
+func fail(t *testing.T, g *Guard, username, ip string) error {
+	t.Helper()
+	a, err := g.Begin(context.Background(), username, ip)
+	if err != nil {
+		return err
+	}
+	if err := a.Failed(context.Background(), Failure{Username: username, IP: ip, Reason: ReasonBadPassword}); err != nil {
+		t.Fatal(err)
+	}
+	return nil
+}
+
+func TestDelay(t *testing.T) {
+	g := newTestGuard(new(time.Time))
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{7, 16 * time.Second},
+		{8, 30 * time.Second},
+		{100, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := g.delay(tt.n); got != tt.want {
+			t.Errorf("delay(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestFreeAttemptsThenDelay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+
+	for i := 0; i < 3; i++ {
+		if err := fail(t, g, "alice", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+	}
+	// The third failure is past the free ones
+	err := fail(t, g, "alice", "10.0.0.1")
+	var blocked *Blocked
+	if !errors.As(err, &blocked) || blocked.Locked || blocked.RetryAfter != time.Second {
+		t.Fatalf("fourth attempt right away: got %v, want a 1s delay", err)
+	}
+
+	// The refused attempt counted too, so this one is the fifth failure and
+	// locks the username.
+	now = now.Add(time.Minute)
+	if err := fail(t, g, "alice", "10.0.0.1"); err != nil {
+		t.Fatalf("fifth attempt after the delay: %v", err)
+	}
+	now = now.Add(time.Minute)
+	if err := fail(t, g, "alice", "10.0.0.2"); !errors.As(err, &blocked) || !blocked.Locked {
+		t.Fatalf("after too many failures: got %v, want a lockout from any IP", err)
+	}
+	if err := fail(t, g, "bob", "10.0.0.1"); err != nil {
+		t.Fatalf("other user from the same IP: %v", err)
+	}
+
+	if err := g.Unlock(context.Background(), "ALICE"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fail(t, g, "alice", "10.0.0.2"); err != nil {
+		t.Fatalf("after unlock: %v", err)
+	}
+}
+
+func TestPassedReleasesAttempt(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		a, err := g.Begin(ctx, "alice", "10.0.0.1")
+		if err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+		if err := a.Passed(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fail(t, g, "alice", "10.0.0.1"); err != nil {
+		t.Fatalf("right passwords must not count as failures: %v", err)
+	}
+}
+
+func TestCancelReleasesAttempt(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		a, err := g.Begin(ctx, "alice", "10.0.0.1")
+		if err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+		if err := a.Cancel(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fail(t, g, "alice", "10.0.0.1"); err != nil {
+		t.Fatalf("unchecked attempts must not count as failures: %v", err)
+	}
+}
+
+func TestWindowForgetsFailures(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+
+	for i := 0; i < 4; i++ {
+		fail(t, g, "alice", "10.0.0.1")
+		now = now.Add(time.Minute)
+	}
+	now = now.Add(g.Policy.Window + time.Second)
+	for i := 0; i < 3; i++ {
+		if err := fail(t, g, "alice", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d after the window: %v", i+1, err)
+		}
+	}
+}
+
+// Parallel guesses must not all be checked before any of them has failed.
+func TestConcurrentBegin(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	checked := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := g.Begin(ctx, "alice", "10.0.0.1"); err == nil {
+				mu.Lock()
+				checked++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// Only attempts with at most FreeAttempts failures before them go
+	// without a delay.
+	if max := g.Policy.FreeAttempts + 1; checked > max {
+		t.Errorf("%d parallel attempts checked, want at most %d", checked, max)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+	ctx := context.Background()
+
+	fail(t, g, "alice", "10.0.0.1")
+	now = now.Add(48 * time.Hour)
+	fail(t, g, "bob", "10.0.0.2")
+
+	if err := g.Store.Prune(ctx, now, g.Policy.Window, now.Add(-g.Policy.Retention)); err != nil {
+		t.Fatal(err)
+	}
+	failures, err := g.Store.Failures(ctx, FailureQuery{IncludeUnknown: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || failures[0].Username != "bob" {
+		t.Errorf("after prune got %+v, want only bob's failure", failures)
+	}
+	m := g.Store.(*MemoryStore)
+	if _, ok := m.states[userKey("alice")]; ok {
+		t.Error("stale attempts of alice were kept")
+	}
+	if _, ok := m.states[userKey("bob")]; !ok {
+		t.Error("recent attempts of bob were pruned")
+	}
+}
@@ -0,0 +1,124 @@
+package loginguard
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxMemoryFailures bounds the failed logins kept by a MemoryStore.
+const maxMemoryFailures = 10000
+
+// MemoryStore keeps everything in process memory. It suits a single
+// instance; state is lost on restart.
+type MemoryStore struct {
+	mu       sync.Mutex
+	states   map[string]State
+	failures []Failure
+	nextID   int64
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: make(map[string]State)}
+}
+
+func (m *MemoryStore) Attempt(ctx context.Context, key string, now time.Time, window time.Duration) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.states) >= maxMemoryFailures {
+		m.prune(now, window)
+	}
+	before := m.states[key]
+	s := before
+	if now.Sub(s.LastFailure) > window {
+		s.Failures = 0
+		before.Failures = 0
+	}
+	s.Failures++
+	s.LastFailure = now
+	m.states[key] = s
+	return before, nil
+}
+
+func (m *MemoryStore) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.states[key]; ok && s.Failures > 0 {
+		s.Failures--
+		m.states[key] = s
+	}
+	return nil
+}
+
+func (m *MemoryStore) Prune(ctx context.Context, now time.Time, window time.Duration, keepSince time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune(now, window)
+	i := 0
+	for i < len(m.failures) && m.failures[i].CreatedAt.Before(keepSince) {
+		i++
+	}
+	m.failures = append(m.failures[:0], m.failures[i:]...)
+	return nil
+}
+
+// prune drops keys whose failures are forgotten and whose lock is over, so
+// the map does not grow with every address that ever failed once.
+func (m *MemoryStore) prune(now time.Time, window time.Duration) {
+	for key, s := range m.states {
+		if now.Sub(s.LastFailure) > window && now.After(s.LockedUntil) {
+			delete(m.states, key)
+		}
+	}
+}
+
+func (m *MemoryStore) Lock(ctx context.Context, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.states[key]
+	s.LockedUntil = until
+	m.states[key] = s
+	return nil
+}
+
+func (m *MemoryStore) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.states, key)
+	return nil
+}
+
+func (m *MemoryStore) Record(ctx context.Context, f Failure) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	f.ID = m.nextID
+	if len(m.failures) >= maxMemoryFailures {
+		m.failures = append(m.failures[:0], m.failures[1:]...)
+	}
+	m.failures = append(m.failures, f)
+	return nil
+}
+
+func (m *MemoryStore) Failures(ctx context.Context, q FailureQuery) ([]Failure, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := []Failure{}
+	for i := len(m.failures) - 1; i >= 0 && (q.Limit <= 0 || len(found) < q.Limit); i-- {
+		f := m.failures[i]
+		switch {
+		case f.OrgID == nil && !q.IncludeUnknown,
+			f.OrgID != nil && q.OrgID != 0 && *f.OrgID != q.OrgID,
+			q.Username != "" && f.Username != q.Username,
+			q.IP != "" && f.IP != q.IP,
+			!q.From.IsZero() && f.CreatedAt.Before(q.From),
+			!q.To.IsZero() && f.CreatedAt.After(q.To):
+			continue
+		}
+		found = append(found, f)
+	}
+	return found, nil
+}
@@ -0,0 +1,111 @@
+package loginguard
+
+import (
+	"context"
+	"time"
+	"tm/database"
+)
+
+// PostgresStore keeps everything in the login_attempts and login_failures
+// tables, so all instances share the counters.
+type PostgresStore struct{}
+
+func (PostgresStore) Attempt(ctx context.Context, key string, now time.Time, window time.Duration) (State, error) {
+	// prev_failure keeps the last failure from before this attempt, which
+	// RETURNING could not show otherwise.
+	var s State
+	var prev, locked *time.Time
+	err := database.DBpool.QueryRow(ctx,
+		`INSERT INTO login_attempts AS a (key, failures, last_failure) VALUES ($1, 1, $2)
+		 ON CONFLICT (key) DO UPDATE SET
+		     failures = CASE WHEN a.last_failure < $2 - make_interval(secs => $3)
+		                     THEN 1 ELSE a.failures + 1 END,
+		     prev_failure = CASE WHEN a.last_failure < $2 - make_interval(secs => $3)
+		                         THEN NULL ELSE a.last_failure END,
+		     last_failure = $2
+		 RETURNING a.failures - 1, a.prev_failure, a.locked_until`,
+		key, now, window.Seconds(),
+	).Scan(&s.Failures, &prev, &locked)
+	if prev != nil {
+		s.LastFailure = *prev
+	}
+	if locked != nil {
+		s.LockedUntil = *locked
+	}
+	return s, err
+}
+
+func (PostgresStore) Release(ctx context.Context, key string) error {
+	_, err := database.DBpool.Exec(ctx,
+		"UPDATE login_attempts SET failures = GREATEST(failures - 1, 0) WHERE key = $1", key)
+	return err
+}
+
+func (PostgresStore) Prune(ctx context.Context, now time.Time, window time.Duration, keepSince time.Time) error {
+	_, err := database.DBpool.Exec(ctx,
+		`DELETE FROM login_attempts
+		 WHERE last_failure < $1 - make_interval(secs => $2) AND (locked_until IS NULL OR locked_until < $1)`,
+		now, window.Seconds())
+	if err != nil {
+		return err
+	}
+	_, err = database.DBpool.Exec(ctx, "DELETE FROM login_failures WHERE created_at < $1", keepSince)
+	return err
+}
+
+func (PostgresStore) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := database.DBpool.Exec(ctx, "UPDATE login_attempts SET locked_until = $1 WHERE key = $2", until, key)
+	return err
+}
+
+func (PostgresStore) Reset(ctx context.Context, key string) error {
+	_, err := database.DBpool.Exec(ctx, "DELETE FROM login_attempts WHERE key = $1", key)
+	return err
+}
+
+func (PostgresStore) Record(ctx context.Context, f Failure) error {
+	_, err := database.DBpool.Exec(ctx,
+		`INSERT INTO login_failures (username, ip, user_agent, reason, org_id, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		f.Username, f.IP, f.UserAgent, f.Reason, f.OrgID, f.CreatedAt)
+	return err
+}
+
+func (PostgresStore) Failures(ctx context.Context, q FailureQuery) ([]Failure, error) {
+	var from, to *time.Time
+	if !q.From.IsZero() {
+		from = &q.From
+	}
+	if !q.To.IsZero() {
+		to = &q.To
+	}
+	var limit *int
+	if q.Limit > 0 {
+		limit = &q.Limit
+	}
+
+	rows, err := database.DBpool.Query(ctx,
+		`SELECT id, username, ip, user_agent, reason, org_id, created_at FROM login_failures
+		 WHERE (org_id = $1 OR $1 = 0 AND org_id IS NOT NULL OR org_id IS NULL AND $2)
+		   AND ($3 = '' OR username = $3)
+		   AND ($4 = '' OR ip = $4)
+		   AND ($5::timestamptz IS NULL OR created_at >= $5)
+		   AND ($6::timestamptz IS NULL OR created_at <= $6)
+		 ORDER BY created_at DESC, id DESC
+		 LIMIT $7`,
+		q.OrgID, q.IncludeUnknown, q.Username, q.IP, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := []Failure{}
+	for rows.Next() {
+		var f Failure
+		if err := rows.Scan(&f.ID, &f.Username, &f.IP, &f.UserAgent, &f.Reason, &f.OrgID, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
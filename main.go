@@ -1,9 +1,24 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"tm/archive"
+	"tm/config"
 	"tm/controllers"
 	"tm/database"
 	_ "tm/docs"
+	"tm/documents"
+	"tm/geocoder"
+	"tm/loginguard"
+	"tm/migrations"
+	"tm/notify"
+	"tm/oidc"
+	"tm/partitions"
+	"tm/passwords"
+	"tm/rbac"
 	routes "tm/routers"
 
 	"github.com/gofiber/fiber/v2"
@@ -11,14 +26,92 @@ import (
 )
 
 func main() {
+	migrateCommand := flag.String("migrate", "", "run database migrations and exit: up, down or status")
+	steps := flag.Int("steps", 1, "number of migrations to revert with -migrate down")
+	skipMigrations := flag.Bool("skip-migrations", false, "do not apply pending migrations on startup")
+	flag.Parse()
+
+	config.Load()
 	database.InitDB()
-	app := fiber.New()
+	if *migrateCommand != "" {
+		migrate(*migrateCommand, *steps)
+		return
+	}
+	if !*skipMigrations {
+		if err := migrations.Up(context.Background(), database.DBpool); err != nil {
+			log.Fatalf("Unable to migrate database: %v\n", err)
+		}
+	}
+	partitions.Init()
+	archive.Init()
+	geocoder.Init()
+	loginguard.Init()
+	passwords.Init()
+	notify.Init()
+	oidc.Init()
+	documents.Init()
+
+	if err := rbac.Load(); err != nil {
+		log.Fatalf("Unable to load permissions: %v\n", err)
+	}
+	if err := controllers.LoadSpeedLimits(); err != nil {
+		log.Fatalf("Unable to load speed limits: %v\n", err)
+	}
+	if err := controllers.LoadOpenEpisodes(); err != nil {
+		log.Fatalf("Unable to load open overspeed events: %v\n", err)
+	}
+	if err := controllers.LoadPositions(); err != nil {
+		log.Fatalf("Unable to load device positions: %v\n", err)
+	}
+
+	server := config.C.Server
+	app := fiber.New(fiber.Config{
+		BodyLimit: config.BodyLimitMB << 20,
+		// c.IP() is the peer address unless the peer is a trusted proxy
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          server.TrustedProxies,
+		ProxyHeader:             server.ProxyHeader,
+		EnableIPValidation:      true,
+	})
 	app.Use(logger.New())
 
 	routes.SetupRoutes(app)
 
 	go controllers.ListenForUpdates()
+	go partitions.Run()
+	go archive.Run()
+	go documents.Run()
+	go loginguard.Run()
 
-	app.Listen("0.0.0.0:8000")
+	log.Fatal(app.Listen(config.C.Server.ListenAddr))
+
+}
 
+// migrate runs a migration command given with -migrate.
+func migrate(command string, steps int) {
+	ctx := context.Background()
+	switch command {
+	case "up":
+		if err := migrations.Up(ctx, database.DBpool); err != nil {
+			log.Fatalf("Unable to migrate database: %v\n", err)
+		}
+	case "down":
+		if err := migrations.Down(ctx, database.DBpool, steps); err != nil {
+			log.Fatalf("Unable to revert migrations: %v\n", err)
+		}
+	case "status":
+		statuses, err := migrations.List(ctx, database.DBpool)
+		if err != nil {
+			log.Fatalf("Unable to read migration status: %v\n", err)
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		log.Fatalf("Unknown migration command %q, expected up, down or status\n", command)
+	}
 }
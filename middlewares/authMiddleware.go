@@ -1,70 +1,146 @@
 package middlewares
 
 import (
+	"context"
+	"strings"
+	"tm/apikeys"
+	"tm/config"
+	"tm/rbac"
+	"tm/sessions"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/golang-jwt/jwt/v4"
 )
 
-var JwtSecret = []byte("your_secret_key")
-
 func CORSMiddleware() fiber.Handler {
 	return cors.New(cors.Config{
-		AllowOrigins: "*",
+		AllowOrigins: strings.Join(config.C.Server.CORSOrigins, ","),
 		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
 	})
 }
 
+func keyFunc(t *jwt.Token) (interface{}, error) {
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "unexpected signing method")
+	}
+	return []byte(config.C.JWT.Secret), nil
+}
+
 func parseToken(c *fiber.Ctx) (*jwt.Token, error) {
-	// Check for token in cookies
-	cookie := c.Cookies("jwt")
-	if cookie != "" {
-		return jwt.Parse(cookie, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fiber.NewError(fiber.StatusUnauthorized, "unexpected signing method")
-			}
-			return JwtSecret, nil
-		})
+	// Check for token in cookies, then in the Authorization header
+	tokenStr := c.Cookies("jwt")
+	if tokenStr == "" {
+		authHeader := c.Get("Authorization")
+		if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
+			tokenStr = authHeader[7:]
+		}
+	}
+	if tokenStr == "" {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "unauthenticated")
+	}
+	if apikeys.IsKey(tokenStr) {
+		return parseAPIKey(c, tokenStr)
 	}
 
-	// Check for token in Authorization header
-	authHeader := c.Get("Authorization")
-	if authHeader != "" && len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-		tokenStr := authHeader[7:]
-		return jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fiber.NewError(fiber.StatusUnauthorized, "unexpected signing method")
-			}
-			return JwtSecret, nil
-		})
+	token, err := jwt.Parse(tokenStr, keyFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens are only good while the session they were issued for is alive
+	claims := token.Claims.(jwt.MapClaims)
+	sid, _ := claims["sid"].(string)
+	if sid == "" {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "token has no session")
+	}
+	active, err := sessions.Active(context.Background(), sid)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "session revoked")
+	}
+
+	c.Locals("claims", claims)
+	return token, nil
+}
+
+// parseAPIKey checks an API key and gives the request the claims an access
+// token of its owner would carry, without a session. The key itself is kept
+// in c.Locals("apikey") for RequireScope.
+func parseAPIKey(c *fiber.Ctx, key string) (*jwt.Token, error) {
+	id, err := apikeys.Authenticate(context.Background(), key, c.IP())
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, fiber.NewError(fiber.StatusUnauthorized, "unauthenticated")
+	userID := 0
+	if id.UserID != nil {
+		userID = *id.UserID
+	}
+	claims := jwt.MapClaims{
+		"id":       float64(userID),
+		"username": id.Username,
+		"role":     id.EffectiveRole,
+		"org":      float64(id.OrgID),
+		"key":      id.Prefix,
+	}
+	c.Locals("claims", claims)
+	c.Locals("apikey", id.Key)
+	return &jwt.Token{Claims: claims, Valid: true}, nil
 }
 
-func OnlyUser(c *fiber.Ctx) error {
+// Authenticate rejects requests without a valid access token and makes its
+// claims available to the handlers that follow as c.Locals("claims").
+func Authenticate(c *fiber.Ctx) error {
 	token, err := parseToken(c)
 	if err != nil || !token.Valid {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "You are not login"})
 	}
 
-	claims := token.Claims.(jwt.MapClaims)
-	if claims["role"] != "user" && claims["role"] != "admin" {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "You are not login"})
-	}
-
 	return c.Next()
 }
 
-func OnlyAdmin(c *fiber.Ctx) error {
-	token, err := parseToken(c)
-	if err != nil || !token.Valid {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+// RequirePermission lets a request through only if the role of the caller
+// grants every one of the given permissions. It must run after Authenticate.
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := c.Locals("claims").(jwt.MapClaims)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+		}
+
+		role, _ := claims["role"].(string)
+		for _, p := range permissions {
+			if !rbac.Can(role, p) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "missing permission " + p})
+			}
+		}
+
+		return c.Next()
 	}
+}
 
-	claims := token.Claims.(jwt.MapClaims)
-	if claims["role"] != "admin" {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "You are not admin"})
+// RequireScope lets requests made with an API key through only if the key
+// has a scope, or its read-only form for GET requests. Requests made with an
+// access token pass. It must run after Authenticate.
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key, ok := c.Locals("apikey").(apikeys.Key)
+		if ok && !key.Allows(scope, c.Method()) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "API key lacks scope " + scope})
+		}
+
+		return c.Next()
+	}
+}
+
+// SessionOnly rejects requests made with an API key, for routes that act on
+// the login session or the account behind it, including its keys.
+func SessionOnly(c *fiber.Ctx) error {
+	if _, ok := c.Locals("apikey").(apikeys.Key); ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "not allowed with an API key"})
 	}
 
 	return c.Next()
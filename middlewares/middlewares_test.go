@@ -0,0 +1,120 @@
+package middlewares
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+	"tm/apikeys"
+	"tm/config"
+	"tm/rbac"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// status runs handler after a step that sets the caller's claims and API
+// key, and returns the status of a request with method.
+func status(t *testing.T, method string, claims jwt.MapClaims, key *apikeys.Key, handler fiber.Handler) int {
+	t.Helper()
+	app := fiber.New()
+	app.Add(method, "/", func(c *fiber.Ctx) error {
+		if claims != nil {
+			c.Locals("claims", claims)
+		}
+		if key != nil {
+			c.Locals("apikey", *key)
+		}
+		return c.Next()
+	}, handler, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	resp, err := app.Test(httptest.NewRequest(method, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestRequirePermission(t *testing.T) {
+	rbac.SetGrants(map[string][]string{
+		"admin": {rbac.DeviceRead, rbac.UserManage},
+		"user":  {rbac.DeviceRead},
+	})
+	defer rbac.SetGrants(nil)
+
+	handler := RequirePermission(rbac.DeviceRead, rbac.UserManage)
+	if got := status(t, "GET", jwt.MapClaims{"role": "admin"}, nil, handler); got != fiber.StatusNoContent {
+		t.Errorf("admin: %d, want it let through", got)
+	}
+	if got := status(t, "GET", jwt.MapClaims{"role": "user"}, nil, handler); got != fiber.StatusForbidden {
+		t.Errorf("user without every permission: %d, want 403", got)
+	}
+	if got := status(t, "GET", nil, nil, handler); got != fiber.StatusUnauthorized {
+		t.Errorf("no claims: %d, want 401", got)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	key := &apikeys.Key{Scopes: []string{apikeys.ScopeDevices + ":read"}}
+	handler := RequireScope(apikeys.ScopeDevices)
+
+	if got := status(t, "GET", nil, key, handler); got != fiber.StatusNoContent {
+		t.Errorf("read-only key, GET: %d, want it let through", got)
+	}
+	if got := status(t, "POST", nil, key, handler); got != fiber.StatusForbidden {
+		t.Errorf("read-only key, POST: %d, want 403", got)
+	}
+	if got := status(t, "GET", nil, key, RequireScope(apikeys.ScopeAdmin)); got != fiber.StatusForbidden {
+		t.Errorf("key without the scope: %d, want 403", got)
+	}
+	if got := status(t, "POST", nil, nil, handler); got != fiber.StatusNoContent {
+		t.Errorf("access token: %d, want scopes not to apply", got)
+	}
+}
+
+func TestSessionOnly(t *testing.T) {
+	if got := status(t, "POST", nil, &apikeys.Key{Scopes: []string{apikeys.ScopeAdmin}}, SessionOnly); got != fiber.StatusForbidden {
+		t.Errorf("API key: %d, want 403", got)
+	}
+	if got := status(t, "POST", nil, nil, SessionOnly); got != fiber.StatusNoContent {
+		t.Errorf("access token: %d, want it let through", got)
+	}
+}
+
+// Tokens are refused before any session lookup when they are not ours.
+func TestAuthenticateRejects(t *testing.T) {
+	config.C.JWT.Secret = "a test secret that is long enough to sign"
+	sign := func(method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+		s, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	exp := time.Now().Add(time.Minute).Unix()
+	tokens := map[string]string{
+		"no token":     "",
+		"wrong secret": sign(jwt.SigningMethodHS256, []byte("another secret"), jwt.MapClaims{"sid": "s", "exp": exp}),
+		"expired":      sign(jwt.SigningMethodHS256, []byte(config.C.JWT.Secret), jwt.MapClaims{"sid": "s", "exp": time.Now().Add(-time.Minute).Unix()}),
+		"no session":   sign(jwt.SigningMethodHS256, []byte(config.C.JWT.Secret), jwt.MapClaims{"exp": exp}),
+		"unsigned":     sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, jwt.MapClaims{"sid": "s", "exp": exp}),
+		"not a bearer": "Basic dXNlcjpwYXNz",
+	}
+	for name, token := range tokens {
+		app := fiber.New()
+		app.Get("/", Authenticate, func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) })
+		req := httptest.NewRequest("GET", "/", nil)
+		if token != "" && name != "not a bearer" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusUnauthorized {
+			t.Errorf("%s: %d, want 401", name, resp.StatusCode)
+		}
+	}
+}
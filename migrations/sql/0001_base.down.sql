@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS data_update_trigger ON device_locations;
+DROP TRIGGER IF EXISTS data_update_trigger ON devices;
+DROP FUNCTION IF EXISTS notify_data_update();
+DROP TABLE IF EXISTS driver;
+DROP TABLE IF EXISTS device_locations;
+DROP TABLE IF EXISTS devices;
+DROP TABLE IF EXISTS users;
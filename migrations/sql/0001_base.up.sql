@@ -0,0 +1,52 @@
+-- Base tables. They predate the migrations, so every statement tolerates
+-- objects that already exist on older deployments.
+
+CREATE TABLE IF NOT EXISTS users (
+    id       SERIAL PRIMARY KEY,
+    username TEXT NOT NULL UNIQUE,
+    password TEXT NOT NULL,
+    role     TEXT NOT NULL DEFAULT 'user'
+);
+
+CREATE TABLE IF NOT EXISTS devices (
+    device_id     TEXT PRIMARY KEY,
+    battery_level INTEGER NOT NULL DEFAULT 0,
+    signal_status TEXT NOT NULL DEFAULT '',
+    is_locked     BOOLEAN NOT NULL DEFAULT false,
+    status        TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS device_locations (
+    device_id TEXT NOT NULL,
+    timestamp BIGINT NOT NULL,
+    latitude  DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS driver (
+    id          SERIAL PRIMARY KEY,
+    create_time TIMESTAMP NOT NULL DEFAULT now(),
+    name        TEXT NOT NULL DEFAULT '',
+    phone       TEXT NOT NULL DEFAULT '',
+    car_number  TEXT NOT NULL DEFAULT '',
+    car_model   TEXT NOT NULL DEFAULT '',
+    weight      INTEGER NOT NULL DEFAULT 0,
+    country     TEXT NOT NULL DEFAULT ''
+);
+
+-- ListenForUpdates re-broadcasts the device list whenever devices or their
+-- locations change.
+CREATE OR REPLACE FUNCTION notify_data_update() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('data_update', TG_TABLE_NAME);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS data_update_trigger ON devices;
+CREATE TRIGGER data_update_trigger AFTER INSERT OR UPDATE OR DELETE ON devices
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_data_update();
+
+DROP TRIGGER IF EXISTS data_update_trigger ON device_locations;
+CREATE TRIGGER data_update_trigger AFTER INSERT OR UPDATE OR DELETE ON device_locations
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_data_update();
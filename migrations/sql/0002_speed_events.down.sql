@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS events;
+DROP TABLE IF EXISTS speed_limits;
+ALTER TABLE devices DROP COLUMN IF EXISTS vehicle_type;
+DROP INDEX IF EXISTS device_locations_device_id_timestamp_idx;
+ALTER TABLE device_locations DROP COLUMN IF EXISTS speed;
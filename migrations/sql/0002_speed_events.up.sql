@@ -0,0 +1,31 @@
+ALTER TABLE device_locations ADD COLUMN IF NOT EXISTS speed DOUBLE PRECISION;
+CREATE INDEX IF NOT EXISTS device_locations_device_id_timestamp_idx ON device_locations (device_id, timestamp DESC);
+
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS vehicle_type TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS speed_limits (
+    id           SERIAL PRIMARY KEY,
+    scope        TEXT NOT NULL CHECK (scope IN ('device', 'vehicle_type', 'zone')),
+    device_id    TEXT NOT NULL DEFAULT '',
+    vehicle_type TEXT NOT NULL DEFAULT '',
+    zone_name    TEXT NOT NULL DEFAULT '',
+    latitude     DOUBLE PRECISION NOT NULL DEFAULT 0,
+    longitude    DOUBLE PRECISION NOT NULL DEFAULT 0,
+    radius       DOUBLE PRECISION NOT NULL DEFAULT 0,
+    limit_kmh    DOUBLE PRECISION NOT NULL,
+    create_time  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS events (
+    id          BIGSERIAL PRIMARY KEY,
+    device_id   TEXT NOT NULL,
+    type        TEXT NOT NULL,
+    start_time  BIGINT NOT NULL,
+    end_time    BIGINT,
+    latitude    DOUBLE PRECISION NOT NULL,
+    longitude   DOUBLE PRECISION NOT NULL,
+    max_speed   DOUBLE PRECISION NOT NULL DEFAULT 0,
+    speed_limit DOUBLE PRECISION NOT NULL DEFAULT 0,
+    distance    DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS events_device_id_start_time_idx ON events (device_id, start_time);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS device_last_position_trigger ON device_locations;
+DROP FUNCTION IF EXISTS update_device_last_position();
+DROP TABLE IF EXISTS device_last_position;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS device_last_position (
+    device_id TEXT PRIMARY KEY,
+    timestamp BIGINT NOT NULL,
+    latitude  DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    speed     DOUBLE PRECISION
+);
+
+CREATE OR REPLACE FUNCTION update_device_last_position() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO device_last_position (device_id, timestamp, latitude, longitude, speed)
+    VALUES (NEW.device_id, NEW.timestamp, NEW.latitude, NEW.longitude, NEW.speed)
+    ON CONFLICT (device_id) DO UPDATE
+    SET timestamp = EXCLUDED.timestamp, latitude = EXCLUDED.latitude, longitude = EXCLUDED.longitude, speed = EXCLUDED.speed
+    WHERE device_last_position.timestamp <= EXCLUDED.timestamp;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS device_last_position_trigger ON device_locations;
+CREATE TRIGGER device_last_position_trigger AFTER INSERT ON device_locations
+    FOR EACH ROW EXECUTE FUNCTION update_device_last_position();
+
+INSERT INTO device_last_position (device_id, timestamp, latitude, longitude, speed)
+SELECT DISTINCT ON (device_id) device_id, timestamp, latitude, longitude, speed
+FROM device_locations
+ORDER BY device_id, timestamp DESC
+ON CONFLICT (device_id) DO NOTHING;
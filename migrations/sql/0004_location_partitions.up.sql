@@ -0,0 +1,11 @@
+-- State of the device_locations partitions managed by the partitions package.
+-- The conversion of device_locations itself happens in code on startup.
+CREATE TABLE IF NOT EXISTS location_partitions (
+    name            TEXT PRIMARY KEY,
+    range_start     BIGINT NOT NULL,
+    range_end       BIGINT NOT NULL,
+    compacted_until BIGINT NOT NULL DEFAULT 0,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    dropped_at      TIMESTAMPTZ
+);
+ALTER TABLE location_partitions ADD COLUMN IF NOT EXISTS archive_key TEXT NOT NULL DEFAULT '';
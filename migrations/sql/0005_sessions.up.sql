@@ -0,0 +1,16 @@
+-- Login sessions. Each session holds the hash of its current refresh token;
+-- the previous hash is kept to detect replay of a rotated token.
+CREATE TABLE sessions (
+    id            TEXT PRIMARY KEY,
+    user_id       INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    refresh_hash  TEXT NOT NULL UNIQUE,
+    previous_hash TEXT,
+    user_agent    TEXT NOT NULL DEFAULT '',
+    ip            TEXT NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at    TIMESTAMPTZ NOT NULL,
+    revoked_at    TIMESTAMPTZ
+);
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+CREATE INDEX sessions_previous_hash_idx ON sessions (previous_hash);
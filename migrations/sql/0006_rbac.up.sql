@@ -0,0 +1,63 @@
+-- Roles and the permissions they grant. users.role names a row of roles.
+CREATE TABLE roles (
+    name        TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE permissions (
+    name        TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE role_permissions (
+    role       TEXT NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+    permission TEXT NOT NULL REFERENCES permissions (name) ON DELETE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('device:read',       'View devices, their tracks and events'),
+    ('device:write',      'Report device locations and edit device settings'),
+    ('device:command',    'Send commands to devices'),
+    ('driver:read',       'View drivers'),
+    ('driver:write',      'Create, edit and delete drivers'),
+    ('speed_limit:write', 'Manage speed limits'),
+    ('user:manage',       'Manage users, roles and sessions'),
+    ('system:read',       'View storage and configuration');
+
+INSERT INTO roles (name, description) VALUES
+    ('admin',         'Full access'),
+    ('fleet_manager', 'Manages devices, drivers and speed limits'),
+    ('dispatcher',    'Follows devices and sends commands'),
+    ('viewer',        'Read-only access'),
+    ('driver',        'A driver of the fleet'),
+    ('user',          'Default role of accounts created before roles existed');
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'admin', name FROM permissions;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('fleet_manager', 'device:read'),
+    ('fleet_manager', 'device:write'),
+    ('fleet_manager', 'device:command'),
+    ('fleet_manager', 'driver:read'),
+    ('fleet_manager', 'driver:write'),
+    ('fleet_manager', 'speed_limit:write'),
+    ('dispatcher',    'device:read'),
+    ('dispatcher',    'device:command'),
+    ('dispatcher',    'driver:read'),
+    ('viewer',        'device:read'),
+    ('viewer',        'driver:read'),
+    ('driver',        'device:read'),
+    ('user',          'device:read'),
+    ('user',          'device:write'),
+    ('user',          'driver:read'),
+    ('user',          'driver:write');
+
+-- Keep whatever roles existing accounts have, without permissions.
+INSERT INTO roles (name)
+SELECT DISTINCT role FROM users
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE users
+    ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles (name);
@@ -0,0 +1,11 @@
+UPDATE users SET role = 'admin' WHERE role = 'superadmin';
+DELETE FROM roles WHERE name = 'superadmin';
+DELETE FROM permissions WHERE name = 'org:manage';
+
+ALTER TABLE sessions     DROP COLUMN IF EXISTS org_id;
+ALTER TABLE speed_limits DROP COLUMN IF EXISTS org_id;
+ALTER TABLE driver       DROP COLUMN IF EXISTS org_id;
+ALTER TABLE devices      DROP COLUMN IF EXISTS org_id;
+ALTER TABLE users        DROP COLUMN IF EXISTS org_id;
+
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,35 @@
+-- Organizations own users, devices, drivers and speed limits. Locations,
+-- positions and events belong to the organization of their device.
+CREATE TABLE organizations (
+    id         SERIAL PRIMARY KEY,
+    name       TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Everything that exists already, and rows still written by services that
+-- know nothing about organizations, belong to the default organization.
+INSERT INTO organizations (id, name) VALUES (1, 'Default');
+SELECT setval('organizations_id_seq', 1);
+
+ALTER TABLE users        ADD COLUMN org_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations (id);
+ALTER TABLE devices      ADD COLUMN org_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations (id);
+ALTER TABLE driver       ADD COLUMN org_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations (id);
+ALTER TABLE speed_limits ADD COLUMN org_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations (id);
+
+CREATE INDEX users_org_id_idx        ON users (org_id);
+CREATE INDEX devices_org_id_idx      ON devices (org_id);
+CREATE INDEX driver_org_id_idx       ON driver (org_id);
+CREATE INDEX speed_limits_org_id_idx ON speed_limits (org_id);
+
+-- The organization a session is currently looking at. Super admins can
+-- switch it; for everyone else it stays the organization of the user.
+ALTER TABLE sessions ADD COLUMN org_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations (id) ON DELETE CASCADE;
+
+INSERT INTO permissions (name, description) VALUES
+    ('org:manage', 'Manage organizations, switch between them and manage roles');
+
+INSERT INTO roles (name, description) VALUES
+    ('superadmin', 'Full access to every organization');
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'superadmin', name FROM permissions;
@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE name = 'device:all';
+DROP TABLE IF EXISTS user_device_groups;
+DROP TABLE IF EXISTS user_devices;
+DROP TABLE IF EXISTS device_group_members;
+DROP TABLE IF EXISTS device_groups;
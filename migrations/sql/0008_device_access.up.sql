@@ -0,0 +1,37 @@
+-- Device groups and the devices and groups assigned to each user. Users
+-- whose role lacks device:all only see the devices assigned to them,
+-- directly or through a group.
+CREATE TABLE device_groups (
+    id     SERIAL PRIMARY KEY,
+    org_id INTEGER NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    name   TEXT NOT NULL,
+    UNIQUE (org_id, name)
+);
+
+CREATE TABLE device_group_members (
+    group_id  INTEGER NOT NULL REFERENCES device_groups (id) ON DELETE CASCADE,
+    device_id TEXT NOT NULL REFERENCES devices (device_id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, device_id)
+);
+CREATE INDEX device_group_members_device_id_idx ON device_group_members (device_id);
+
+CREATE TABLE user_devices (
+    user_id   INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    device_id TEXT NOT NULL REFERENCES devices (device_id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, device_id)
+);
+CREATE INDEX user_devices_device_id_idx ON user_devices (device_id);
+
+CREATE TABLE user_device_groups (
+    user_id  INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    group_id INTEGER NOT NULL REFERENCES device_groups (id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, group_id)
+);
+CREATE INDEX user_device_groups_group_id_idx ON user_device_groups (group_id);
+
+INSERT INTO permissions (name, description) VALUES
+    ('device:all', 'See every device of the organization, not only assigned ones');
+
+-- Every existing role keeps seeing all devices except drivers.
+INSERT INTO role_permissions (role, permission)
+SELECT name, 'device:all' FROM roles WHERE name <> 'driver';
@@ -0,0 +1,21 @@
+-- Recent failed logins per username ("user:<name>") and client IP
+-- ("ip:<address>"), used to throttle and lock out password guessing.
+CREATE TABLE login_attempts (
+    key          TEXT PRIMARY KEY,
+    failures     INTEGER NOT NULL DEFAULT 0,
+    last_failure TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ
+);
+
+-- Every failed login, kept for review.
+CREATE TABLE login_failures (
+    id         BIGSERIAL PRIMARY KEY,
+    username   TEXT NOT NULL,
+    ip         TEXT NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    reason     TEXT NOT NULL,
+    org_id     INTEGER REFERENCES organizations (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX login_failures_created_at_idx ON login_failures (created_at);
+CREATE INDEX login_failures_username_idx ON login_failures (username, created_at);
@@ -0,0 +1,19 @@
+-- TOTP two-factor authentication. totp_secret is set when enrollment starts
+-- and only counts once totp_enabled; totp_last_step is the time step of the
+-- last accepted code, so a code cannot be used twice.
+ALTER TABLE users
+    ADD COLUMN totp_secret    TEXT,
+    ADD COLUMN totp_enabled   BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+-- One-time codes for when the authenticator is lost, stored as SHA-256.
+CREATE TABLE recovery_codes (
+    id        SERIAL PRIMARY KEY,
+    user_id   INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at   TIMESTAMPTZ,
+    UNIQUE (user_id, code_hash)
+);
+
+-- Users of these roles must enroll before they can log in.
+ALTER TABLE roles ADD COLUMN require_2fa BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,6 @@
+-- Settings users manage themselves through /api/me. The language is a
+-- BCP 47 tag and the timezone an IANA name.
+ALTER TABLE users
+    ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN language     TEXT NOT NULL DEFAULT 'en',
+    ADD COLUMN timezone     TEXT NOT NULL DEFAULT 'UTC';
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS password_history;
+DROP TABLE IF EXISTS password_resets;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS phone,
+    DROP COLUMN IF EXISTS email;
@@ -0,0 +1,28 @@
+-- Where password reset links are sent: email if set, otherwise SMS.
+ALTER TABLE users
+    ADD COLUMN email TEXT,
+    ADD COLUMN phone TEXT;
+
+-- Single-use password reset tokens, stored as SHA-256.
+CREATE TABLE password_resets (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    ip         TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ
+);
+CREATE INDEX password_resets_user_id_idx ON password_resets (user_id);
+
+-- bcrypt hashes of the recent passwords of each user, current one included,
+-- so they are not reused.
+CREATE TABLE password_history (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    hash       TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX password_history_user_id_idx ON password_history (user_id, id);
+
+INSERT INTO password_history (user_id, hash) SELECT id, password FROM users;
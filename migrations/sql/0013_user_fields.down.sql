@@ -0,0 +1,5 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS last_login_at,
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS active,
+    DROP COLUMN IF EXISTS full_name;
@@ -0,0 +1,6 @@
+-- Account details kept by admins. Inactive users cannot log in.
+ALTER TABLE users
+    ADD COLUMN full_name     TEXT NOT NULL DEFAULT '',
+    ADD COLUMN active        BOOLEAN NOT NULL DEFAULT true,
+    ADD COLUMN created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN last_login_at TIMESTAMPTZ;
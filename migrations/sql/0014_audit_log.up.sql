@@ -0,0 +1,43 @@
+-- Who changed what. Every entry holds the SHA-256 of its content and of the
+-- entry before it (prev_hash), so editing or removing an entry breaks the
+-- chain from there on; /api/admin/audit/verify checks it.
+CREATE TABLE audit_log (
+    id          BIGSERIAL PRIMARY KEY,
+    org_id      INTEGER NOT NULL,
+    actor_id    INTEGER,
+    actor       TEXT NOT NULL DEFAULT '',
+    action      TEXT NOT NULL,
+    entity_type TEXT NOT NULL,
+    entity_id   TEXT NOT NULL DEFAULT '',
+    before      JSONB,
+    after       JSONB,
+    changes     JSONB,
+    ip          TEXT NOT NULL DEFAULT '',
+    user_agent  TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL,
+    prev_hash   TEXT NOT NULL,
+    hash        TEXT NOT NULL UNIQUE
+);
+CREATE INDEX audit_log_org_created_idx ON audit_log (org_id, created_at);
+CREATE INDEX audit_log_entity_idx ON audit_log (entity_type, entity_id);
+CREATE INDEX audit_log_actor_idx ON audit_log (actor_id);
+
+-- Entries are never changed or removed, not even when the organization or
+-- user they mention is deleted, hence no foreign keys.
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+INSERT INTO permissions (name, description) VALUES
+    ('audit:read', 'View the audit log');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin',      'audit:read'),
+    ('superadmin', 'audit:read');
@@ -0,0 +1,23 @@
+-- Keys for integrations, sent as "Authorization: Bearer <key>". A key belongs
+-- to a user and acts as them, or to an organization (user_id NULL) and acts
+-- with its own role. Only the hash of a key is stored; the prefix is the
+-- readable start of it that tells keys apart in listings and logs.
+CREATE TABLE api_keys (
+    id           SERIAL PRIMARY KEY,
+    org_id       INTEGER NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    user_id      INTEGER REFERENCES users (id) ON DELETE CASCADE,
+    role         TEXT REFERENCES roles (name) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    prefix       TEXT NOT NULL UNIQUE,
+    key_hash     TEXT NOT NULL UNIQUE,
+    scopes       TEXT[] NOT NULL,
+    created_by   INTEGER REFERENCES users (id) ON DELETE SET NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    last_used_ip TEXT NOT NULL DEFAULT '',
+    revoked_at   TIMESTAMPTZ,
+    CHECK ((user_id IS NULL) <> (role IS NULL))
+);
+CREATE INDEX api_keys_org_id_idx ON api_keys (org_id);
+CREATE INDEX api_keys_user_id_idx ON api_keys (user_id);
@@ -0,0 +1,26 @@
+-- Accounts of an OpenID Connect provider linked to users, by the provider's
+-- issuer and its subject ("sub") for the account. A user has at most one
+-- account per provider.
+CREATE TABLE user_identities (
+    id            SERIAL PRIMARY KEY,
+    user_id       INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    issuer        TEXT NOT NULL,
+    subject       TEXT NOT NULL,
+    email         TEXT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_login_at TIMESTAMPTZ,
+    UNIQUE (issuer, subject),
+    UNIQUE (user_id, issuer)
+);
+
+-- Logins in progress at the provider, by the state parameter sent along.
+-- link_user_id is set when a logged in user is linking an account instead.
+CREATE TABLE oidc_logins (
+    state        TEXT PRIMARY KEY,
+    verifier     TEXT NOT NULL,
+    nonce        TEXT NOT NULL,
+    link_user_id INTEGER REFERENCES users (id) ON DELETE CASCADE,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX oidc_logins_expires_at_idx ON oidc_logins (expires_at);
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS data_update_trigger ON driver;
+DROP INDEX IF EXISTS events_driver_id_start_time_idx;
+ALTER TABLE events DROP COLUMN IF EXISTS driver_id;
+DROP TABLE IF EXISTS driver_assignments;
@@ -0,0 +1,27 @@
+-- Who drives which device and when. An assignment is open until ended_at is
+-- set; a driver and a device each have at most one open assignment, and
+-- ended ones are kept as history.
+CREATE TABLE driver_assignments (
+    id          SERIAL PRIMARY KEY,
+    org_id      INTEGER NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    driver_id   INTEGER NOT NULL REFERENCES driver (id) ON DELETE CASCADE,
+    device_id   TEXT NOT NULL REFERENCES devices (device_id) ON DELETE CASCADE,
+    started_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ended_at    TIMESTAMPTZ,
+    assigned_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+    CHECK (ended_at IS NULL OR ended_at >= started_at)
+);
+CREATE UNIQUE INDEX driver_assignments_active_driver_idx ON driver_assignments (driver_id) WHERE ended_at IS NULL;
+CREATE UNIQUE INDEX driver_assignments_active_device_idx ON driver_assignments (device_id) WHERE ended_at IS NULL;
+CREATE INDEX driver_assignments_device_id_started_at_idx ON driver_assignments (device_id, started_at);
+CREATE INDEX driver_assignments_org_id_idx ON driver_assignments (org_id);
+
+-- The driver of the device when an event started.
+ALTER TABLE events ADD COLUMN driver_id INTEGER REFERENCES driver (id) ON DELETE SET NULL;
+CREATE INDEX events_driver_id_start_time_idx ON events (driver_id, start_time);
+
+-- The live device list carries the current driver.
+CREATE TRIGGER data_update_trigger AFTER INSERT OR UPDATE OR DELETE ON driver_assignments
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_data_update();
+CREATE TRIGGER data_update_trigger AFTER UPDATE ON driver
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_data_update();
@@ -0,0 +1,22 @@
+DELETE FROM permissions WHERE name IN ('vehicle:read', 'vehicle:write');
+
+ALTER TABLE driver
+    ADD COLUMN IF NOT EXISTS car_number TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS car_model  TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS weight     INTEGER NOT NULL DEFAULT 0;
+
+UPDATE driver dr SET car_number = l.car_number, car_model = l.car_model, weight = l.weight
+FROM driver_legacy_car l
+WHERE l.driver_id = dr.id;
+
+UPDATE driver dr SET car_number = v.plate, car_model = v.model, weight = COALESCE(v.legacy_driver_weight, v.tare_weight_kg)
+FROM driver_assignments a JOIN vehicles v ON v.id = a.vehicle_id
+WHERE a.driver_id = dr.id AND a.ended_at IS NULL;
+
+DELETE FROM driver_assignments WHERE device_id IS NULL;
+DROP INDEX IF EXISTS driver_assignments_active_vehicle_idx;
+ALTER TABLE driver_assignments DROP COLUMN IF EXISTS vehicle_id;
+ALTER TABLE driver_assignments ALTER COLUMN device_id SET NOT NULL;
+
+DROP TABLE IF EXISTS driver_legacy_car;
+DROP TABLE IF EXISTS vehicles;
@@ -0,0 +1,78 @@
+-- Vehicles of the fleet, apart from the drivers who drive them. device_id is
+-- the tracker installed in the vehicle, if any.
+CREATE TABLE vehicles (
+    id             SERIAL PRIMARY KEY,
+    org_id         INTEGER NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    create_time    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    plate          TEXT NOT NULL,
+    vin            TEXT NOT NULL DEFAULT '',
+    make           TEXT NOT NULL DEFAULT '',
+    model          TEXT NOT NULL DEFAULT '',
+    trailer        TEXT NOT NULL DEFAULT '',
+    capacity_kg    INTEGER NOT NULL DEFAULT 0 CHECK (capacity_kg >= 0),
+    tare_weight_kg INTEGER NOT NULL DEFAULT 0 CHECK (tare_weight_kg >= 0),
+    fuel_type      TEXT NOT NULL DEFAULT '',
+    device_id      TEXT UNIQUE REFERENCES devices (device_id) ON DELETE SET NULL,
+    -- Legacy: driver.weight as it was, see below. Not used by the API.
+    legacy_driver_weight INTEGER,
+    UNIQUE (org_id, plate)
+);
+CREATE UNIQUE INDEX vehicles_org_id_vin_idx ON vehicles (org_id, vin) WHERE vin <> '';
+
+-- Drivers are assigned to a vehicle, its device, or both. Assignments to a
+-- vehicle without a device have no track.
+ALTER TABLE driver_assignments ALTER COLUMN device_id DROP NOT NULL;
+ALTER TABLE driver_assignments ADD COLUMN vehicle_id INTEGER REFERENCES vehicles (id) ON DELETE SET NULL;
+ALTER TABLE driver_assignments ADD CHECK (device_id IS NOT NULL OR vehicle_id IS NOT NULL);
+CREATE UNIQUE INDEX driver_assignments_active_vehicle_idx ON driver_assignments (vehicle_id) WHERE ended_at IS NULL;
+
+-- The car fields of every driver as they were before they move into
+-- vehicles. Vehicles keep one model and weight per plate, and drivers
+-- without a plate get no vehicle, so this is the only full copy.
+CREATE TABLE driver_legacy_car (
+    driver_id  INTEGER PRIMARY KEY REFERENCES driver (id) ON DELETE CASCADE,
+    org_id     INTEGER NOT NULL,
+    car_number TEXT NOT NULL,
+    car_model  TEXT NOT NULL,
+    weight     INTEGER NOT NULL
+);
+INSERT INTO driver_legacy_car (driver_id, org_id, car_number, car_model, weight)
+SELECT id, org_id, car_number, car_model, weight
+FROM driver
+WHERE btrim(car_number) <> '' OR btrim(car_model) <> '' OR weight <> 0;
+
+-- Move the car fields of drivers into vehicles, one per plate, and assign
+-- each vehicle to the driver who got it last, unless that driver already
+-- drives a device. The model and weight of that driver are taken.
+--
+-- driver.weight had no documented unit or meaning: it may have been the
+-- weight of the car, its payload or the driver's own. It is therefore not
+-- taken as tare_weight_kg but kept as is in legacy_driver_weight, which the
+-- vehicle endpoints return and accept, to be moved into tare_weight_kg or
+-- capacity_kg where it applies and then cleared.
+INSERT INTO vehicles (org_id, plate, model, legacy_driver_weight)
+SELECT DISTINCT ON (org_id, upper(btrim(car_number)))
+       org_id, upper(btrim(car_number)), btrim(car_model), NULLIF(weight, 0)
+FROM driver
+WHERE btrim(car_number) <> ''
+ORDER BY org_id, upper(btrim(car_number)), create_time DESC, id DESC;
+
+INSERT INTO driver_assignments (org_id, driver_id, vehicle_id, started_at)
+SELECT DISTINCT ON (v.id) dr.org_id, dr.id, v.id, dr.create_time
+FROM driver dr
+JOIN vehicles v ON v.org_id = dr.org_id AND v.plate = upper(btrim(dr.car_number))
+WHERE NOT EXISTS (SELECT 1 FROM driver_assignments a WHERE a.driver_id = dr.id AND a.ended_at IS NULL)
+ORDER BY v.id, dr.create_time DESC, dr.id DESC;
+
+ALTER TABLE driver DROP COLUMN car_number, DROP COLUMN car_model, DROP COLUMN weight;
+
+INSERT INTO permissions (name, description) VALUES
+    ('vehicle:read',  'View vehicles'),
+    ('vehicle:write', 'Create, edit and delete vehicles');
+
+-- Whoever could see or edit drivers, and so their car fields, can do the
+-- same with vehicles.
+INSERT INTO role_permissions (role, permission)
+SELECT role, 'vehicle:read' FROM role_permissions WHERE permission = 'driver:read';
+INSERT INTO role_permissions (role, permission)
+SELECT role, 'vehicle:write' FROM role_permissions WHERE permission = 'driver:write';
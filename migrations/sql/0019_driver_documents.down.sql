@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS driver_document_alerts;
+DROP TABLE IF EXISTS driver_documents;
@@ -0,0 +1,32 @@
+-- Documents a driver carries, such as licences, passports, visas, ADR
+-- certificates and medical papers. file_key names the uploaded scan in the
+-- documents directory.
+CREATE TABLE driver_documents (
+    id              SERIAL PRIMARY KEY,
+    org_id          INTEGER NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    driver_id       INTEGER NOT NULL REFERENCES driver (id) ON DELETE CASCADE,
+    type            TEXT NOT NULL,
+    number          TEXT NOT NULL DEFAULT '',
+    issuing_country TEXT NOT NULL DEFAULT '',
+    issued_on       DATE,
+    expires_on      DATE,
+    file_key        TEXT,
+    file_name       TEXT NOT NULL DEFAULT '',
+    file_type       TEXT NOT NULL DEFAULT '',
+    file_size       BIGINT NOT NULL DEFAULT 0,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (issued_on IS NULL OR expires_on IS NULL OR expires_on >= issued_on)
+);
+CREATE INDEX driver_documents_driver_id_idx ON driver_documents (driver_id);
+CREATE INDEX driver_documents_expires_on_idx ON driver_documents (expires_on) WHERE expires_on IS NOT NULL;
+
+-- Expiry alerts already sent, so each is sent once per document, alert day
+-- and expiry date. A renewed document gets a new expiry date and new alerts.
+CREATE TABLE driver_document_alerts (
+    document_id INTEGER NOT NULL REFERENCES driver_documents (id) ON DELETE CASCADE,
+    days        INTEGER NOT NULL,
+    expires_on  DATE NOT NULL,
+    sent_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (document_id, days, expires_on)
+);
@@ -0,0 +1,6 @@
+UPDATE roles SET description = 'Full access' WHERE name = 'admin';
+
+UPDATE permissions SET description = 'View storage and configuration' WHERE name = 'system:read';
+
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'system:read')
+ON CONFLICT DO NOTHING;
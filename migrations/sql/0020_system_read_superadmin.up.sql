@@ -0,0 +1,12 @@
+-- system:read shows the configuration and location storage of the whole
+-- installation, every organization included, so it is no longer part of the
+-- full access of an organization's admin.
+DELETE FROM role_permissions WHERE permission = 'system:read' AND role <> 'superadmin';
+
+INSERT INTO role_permissions (role, permission) VALUES ('superadmin', 'system:read')
+ON CONFLICT DO NOTHING;
+
+UPDATE permissions SET description = 'View storage and configuration of every organization'
+WHERE name = 'system:read';
+
+UPDATE roles SET description = 'Full access to its organization' WHERE name = 'admin';
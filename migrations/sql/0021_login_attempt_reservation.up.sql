@@ -0,0 +1,4 @@
+-- Login attempts are counted before the password is checked, and the count
+-- returns the failure before the new one to decide on a delay.
+ALTER TABLE login_attempts ADD COLUMN prev_failure TIMESTAMPTZ;
+CREATE INDEX login_attempts_last_failure_idx ON login_attempts (last_failure);
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS driver_document_alerts_pending_idx;
+UPDATE driver_document_alerts SET delivered_at = created_at WHERE delivered_at IS NULL;
+ALTER TABLE driver_document_alerts
+    DROP COLUMN last_attempt_at,
+    DROP COLUMN attempts,
+    DROP COLUMN channels,
+    DROP COLUMN created_at;
+ALTER TABLE driver_document_alerts RENAME COLUMN delivered_at TO sent_at;
+ALTER TABLE driver_document_alerts
+    ALTER COLUMN sent_at SET DEFAULT now(),
+    ALTER COLUMN sent_at SET NOT NULL;
@@ -0,0 +1,16 @@
+-- Expiry alerts are kept as the in-app list of alerts, whether or not
+-- anyone could be told by email or SMS. delivered_at is set once a message
+-- went out on at least one of the channels or there was nobody to send one
+-- to; until then delivery is retried a few times.
+ALTER TABLE driver_document_alerts
+    ALTER COLUMN sent_at DROP NOT NULL,
+    ALTER COLUMN sent_at DROP DEFAULT;
+ALTER TABLE driver_document_alerts RENAME COLUMN sent_at TO delivered_at;
+ALTER TABLE driver_document_alerts
+    ADD COLUMN created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN channels        TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN attempts        INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN last_attempt_at TIMESTAMPTZ;
+UPDATE driver_document_alerts SET created_at = delivered_at;
+CREATE INDEX driver_document_alerts_pending_idx ON driver_document_alerts (created_at)
+    WHERE delivered_at IS NULL;
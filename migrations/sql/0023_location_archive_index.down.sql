@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS location_partitions_archive_range_idx;
+ALTER TABLE location_partitions
+    DROP COLUMN archived_at,
+    DROP COLUMN archive_sha256,
+    DROP COLUMN archive_rows;
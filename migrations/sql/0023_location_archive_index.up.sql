@@ -0,0 +1,11 @@
+-- The archive manifest moves into location_partitions, so every instance
+-- sees an archive as soon as it is recorded and history queries find the
+-- archives of a time range through an index. manifest.json stays in the
+-- store as a copy that describes the archive without the database.
+ALTER TABLE location_partitions
+    ADD COLUMN archive_rows   BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN archive_sha256 TEXT NOT NULL DEFAULT '',
+    ADD COLUMN archived_at    TIMESTAMPTZ;
+UPDATE location_partitions SET archived_at = dropped_at WHERE archive_key <> '';
+CREATE INDEX location_partitions_archive_range_idx ON location_partitions (range_start, range_end)
+    WHERE archive_key <> '';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS location_archive_stale;
+DROP SEQUENCE IF EXISTS location_archive_stale_version;
@@ -0,0 +1,11 @@
+-- Devices with fixes that reached a partition after it settled, so that the
+-- archiver writes their archive files again before the partition is dropped.
+-- version changes with every such fix, so a fix that comes in while a file
+-- is rewritten keeps the device marked.
+CREATE SEQUENCE location_archive_stale_version;
+CREATE TABLE location_archive_stale (
+    partition TEXT NOT NULL REFERENCES location_partitions (name) ON DELETE CASCADE,
+    device_id TEXT NOT NULL,
+    version   BIGINT NOT NULL DEFAULT nextval('location_archive_stale_version'),
+    PRIMARY KEY (partition, device_id)
+);
@@ -0,0 +1,30 @@
+package models
+
+// DeviceGroup is a named set of devices of an organization that can be
+// assigned to users as a whole.
+type DeviceGroup struct {
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	DeviceIds []string `json:"device_ids"`
+}
+
+// DeviceGroupChange adds devices to and removes devices from a group.
+type DeviceGroupChange struct {
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// UserAccess is the set of devices and device groups assigned to a user.
+type UserAccess struct {
+	DeviceIds []string `json:"device_ids"`
+	GroupIds  []int    `json:"group_ids"`
+}
+
+// AccessChange grants or revokes devices and device groups for many users
+// at once. Action is "add" or "remove".
+type AccessChange struct {
+	Action    string   `json:"action"`
+	UserIds   []int    `json:"user_ids"`
+	DeviceIds []string `json:"device_ids"`
+	GroupIds  []int    `json:"group_ids"`
+}
@@ -1,9 +1,10 @@
 package models
 
 type DeviceLocation struct {
-	Timestamp int64   `json:"timestamp"`
-	Latitude  float64 `json:"latitude"`
-	Longitude float64 `json:"longitude"`
+	Timestamp int64    `json:"timestamp"`
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Speed     *float64 `json:"speed,omitempty"` // km/h
 }
 
 type SingleDeviceSchema struct {
@@ -21,14 +22,23 @@ type DeviceSchema struct {
 	SignalStatus string         `json:"signalStatus"`
 	IsLocked     bool           `json:"isLocked"`
 	Status       string         `json:"status"`
+	Address      string         `json:"address"`
+	Driver       *CurrentDriver `json:"driver"`
 }
 
 // DeviceAll yapısı
 
+// DeviceLockRequest locks or unlocks a device.
+type DeviceLockRequest struct {
+	Locked *bool `json:"locked"`
+}
+
 type DeviceLocationRequest struct {
-	DeviceId  string  `json:"device_id"`
-	Latitude  float64 `json:"latitude"`
-	Longitude float64 `json:"longitude"`
+	DeviceId  string   `json:"device_id"`
+	Timestamp *int64   `json:"timestamp,omitempty"` // unix seconds of the fix on the device, the time of receipt when omitted
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Speed     *float64 `json:"speed,omitempty"` // km/h, derived from the previous fix when omitted
 }
 
 type StatusCount struct {
@@ -38,9 +48,29 @@ type StatusCount struct {
 
 type DeviceAll struct {
 	DeviceId     string          `json:"deviceId"`
+	OrgId        int             `json:"-"`
 	BatteryLevel int             `json:"batteryLevel"`
 	SignalStatus string          `json:"signalStatus"`
 	IsLocked     bool            `json:"isLocked"`
 	Status       string          `json:"status"`
 	Location     *DeviceLocation `json:"location"`
+	Address      string          `json:"address"`
+	Driver       *CurrentDriver  `json:"driver"`
+}
+
+// NearbyDevice is a device returned by the nearest-device search, with the
+// distance in meters and the bearing in degrees from the searched point.
+type NearbyDevice struct {
+	DeviceSchema
+	Distance float64 `json:"distance"`
+	Bearing  float64 `json:"bearing"`
+}
+
+// EncodedTrack is a route history encoded as a Google encoded polyline.
+// Start and End are the timestamps of the first and last encoded points.
+type EncodedTrack struct {
+	Polyline string `json:"polyline"`
+	Points   int    `json:"points"`
+	Start    int64  `json:"start"`
+	End      int64  `json:"end"`
 }
@@ -7,8 +7,109 @@ type Driver struct {
 	CreateTime time.Time `json:"create_time"`
 	Name       string    `json:"name"`
 	Phone      string    `json:"phone"`
-	CarNumber  string    `json:"car_number"`
-	CarModel   string    `json:"car_model"`
-	Weight     int       `json:"weight"`
 	Country    string    `json:"country"`
 }
+
+// CurrentDriver is the driver a device is assigned to, as shown with the
+// device.
+type CurrentDriver struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Phone string `json:"phone"`
+}
+
+// DriverAssignment is a period in which a driver drove a vehicle, a device,
+// or the vehicle the device was installed in. EndedAt is nil while it lasts.
+type DriverAssignment struct {
+	ID         int        `json:"id"`
+	DriverId   int        `json:"driver_id"`
+	DriverName string     `json:"driver_name"`
+	DeviceId   *string    `json:"device_id"`
+	VehicleId  *int       `json:"vehicle_id"`
+	Plate      *string    `json:"plate"`
+	StartedAt  time.Time  `json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at"`
+	AssignedBy *int       `json:"assigned_by"`
+}
+
+// AssignDriverRequest names a vehicle, a device, or a vehicle together with
+// the device installed in it.
+type AssignDriverRequest struct {
+	DriverId  int    `json:"driver_id"`
+	DeviceId  string `json:"device_id"`
+	VehicleId int    `json:"vehicle_id"`
+}
+
+// DriverTrip is the part of an assignment inside a report's time range.
+type DriverTrip struct {
+	AssignmentId int     `json:"assignment_id"`
+	DeviceId     string  `json:"device_id"`
+	Start        int64   `json:"start"`
+	End          int64   `json:"end"`
+	Distance     float64 `json:"distance"` // meters
+	Points       int     `json:"points"`
+	DrivingTime  int64   `json:"driving_time"` // seconds
+	MaxSpeed     float64 `json:"max_speed"`    // km/h
+	Overspeeds   int     `json:"overspeeds"`
+}
+
+// DriverReport sums up what a driver drove in a time range. AssignedTime is
+// how long the driver was assigned to a device, DrivingTime how much of it
+// the device moved.
+type DriverReport struct {
+	DriverId     int          `json:"driver_id"`
+	From         int64        `json:"from"`
+	To           int64        `json:"to"`
+	Distance     float64      `json:"distance"`      // meters
+	AssignedTime int64        `json:"assigned_time"` // seconds
+	DrivingTime  int64        `json:"driving_time"`  // seconds
+	Overspeeds   int          `json:"overspeeds"`
+	Trips        []DriverTrip `json:"trips"`
+}
+
+// DriverDocument is a licence, passport, visa or other document a driver
+// carries. Dates are "YYYY-MM-DD". The scan is uploaded separately; FileName
+// is empty until then.
+type DriverDocument struct {
+	ID             int       `json:"id"`
+	DriverId       int       `json:"driver_id"`
+	DriverName     string    `json:"driver_name"`
+	Type           string    `json:"type"`
+	Number         string    `json:"number"`
+	IssuingCountry string    `json:"issuing_country"` // ISO 3166-1 alpha-2
+	IssuedOn       *string   `json:"issued_on"`
+	ExpiresOn      *string   `json:"expires_on"`
+	FileName       string    `json:"file_name"`
+	FileType       string    `json:"file_type"`
+	FileSize       int64     `json:"file_size"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// DriverDocumentAlert is an expiry alert of a document, Days days before it
+// expires. Channels lists how it was sent; it is empty for alerts nobody
+// could be sent, which are only shown in the app. DeliveredAt is nil while
+// sending is still being retried.
+type DriverDocumentAlert struct {
+	DocumentId  int        `json:"document_id"`
+	DriverId    int        `json:"driver_id"`
+	DriverName  string     `json:"driver_name"`
+	Type        string     `json:"type"`
+	Number      string     `json:"number"`
+	Days        int        `json:"days"`
+	ExpiresOn   string     `json:"expires_on"`
+	Channels    []string   `json:"channels"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at"`
+}
+
+// DriverClearance is a driver who is not allowed to drive, with the reasons
+// and what the driver is assigned to, if anything.
+type DriverClearance struct {
+	DriverId int      `json:"driver_id"`
+	Name     string   `json:"name"`
+	Phone    string   `json:"phone"`
+	Reasons  []string `json:"reasons"`
+	DeviceId *string  `json:"device_id"`
+	Plate    *string  `json:"plate"`
+}
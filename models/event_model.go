@@ -0,0 +1,37 @@
+package models
+
+// SpeedLimit is a speed limit in km/h that applies to a single device, to all
+// devices of a vehicle type, or to every device inside a circular zone.
+type SpeedLimit struct {
+	ID          int     `json:"id"`
+	OrgId       int     `json:"-"`
+	Scope       string  `json:"scope"`
+	DeviceId    string  `json:"device_id,omitempty"`
+	VehicleType string  `json:"vehicle_type,omitempty"`
+	ZoneName    string  `json:"zone_name,omitempty"`
+	Latitude    float64 `json:"latitude,omitempty"`
+	Longitude   float64 `json:"longitude,omitempty"`
+	Radius      float64 `json:"radius,omitempty"` // meters
+	LimitKmh    float64 `json:"limit_kmh"`
+}
+
+// Event is a detected episode on a device track, e.g. an overspeed.
+// EndTime is nil while the episode is still in progress.
+type Event struct {
+	ID         int64   `json:"id"`
+	DeviceId   string  `json:"deviceId"`
+	Type       string  `json:"type"`
+	StartTime  int64   `json:"startTime"`
+	EndTime    *int64  `json:"endTime"`
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	MaxSpeed   float64 `json:"maxSpeed"`
+	SpeedLimit float64 `json:"speedLimit"`
+	Distance   float64 `json:"distance"` // meters
+	// DriverId is the driver assigned to the device when the event started.
+	DriverId *int `json:"driverId"`
+}
+
+type VehicleTypeRequest struct {
+	VehicleType string `json:"vehicle_type"`
+}
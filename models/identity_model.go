@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Identity is an account at the single sign-on provider linked to a user.
+type Identity struct {
+	Id          int        `json:"id"`
+	Issuer      string     `json:"issuer"`
+	Subject     string     `json:"subject"`
+	Email       *string    `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Organization is a customer of the platform. Users only see the devices,
+// drivers and derived data of their own organization.
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
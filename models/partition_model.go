@@ -0,0 +1,14 @@
+package models
+
+// Partition is a range partition of device_locations. RangeStart and
+// RangeEnd are unix seconds; rows before CompactedUntil have been downsampled.
+type Partition struct {
+	Name           string `json:"name"`
+	RangeStart     int64  `json:"rangeStart"`
+	RangeEnd       int64  `json:"rangeEnd"`
+	CompactedUntil int64  `json:"compactedUntil"`
+	State          string `json:"state"`
+	ArchiveKey     string `json:"archiveKey,omitempty"`
+	Rows           int64  `json:"rows"` // planner estimate
+	SizeBytes      int64  `json:"sizeBytes"`
+}
@@ -0,0 +1,21 @@
+package models
+
+// Profile is the account of the calling user as shown to themselves.
+type Profile struct {
+	Id          int      `json:"id"`
+	Username    string   `json:"username"`
+	Role        string   `json:"role"`
+	OrgId       int      `json:"org_id"`
+	DisplayName string   `json:"display_name"`
+	Language    string   `json:"language"`
+	Timezone    string   `json:"timezone"`
+	Permissions []string `json:"permissions"`
+	TwoFactor   bool     `json:"two_factor_enabled"`
+}
+
+// ProfileUpdate changes the fields that are set and leaves the others.
+type ProfileUpdate struct {
+	DisplayName *string `json:"display_name"`
+	Language    *string `json:"language"`
+	Timezone    *string `json:"timezone"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// Role is a named set of permissions. Every user has exactly one role.
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	Require2FA  bool     `json:"require_2fa"`
+}
+
+// Permission is a single action a role can be allowed to perform.
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
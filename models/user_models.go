@@ -1,8 +1,52 @@
 package models
 
+import "time"
+
+// User is an account as stored. Password is the bcrypt hash and is never
+// sent to clients; handlers answer with UserResponse.
 type User struct {
 	Id       int    `json:"id"`
 	Username string `json:"username"`
-	Password string `json:"password"`
+	Password string `json:"-"`
 	Role     string `json:"role"`
+	OrgId    int    `json:"org_id"`
+}
+
+// UserResponse is a user as shown to admins.
+type UserResponse struct {
+	Id          int        `json:"id"`
+	Username    string     `json:"username"`
+	Role        string     `json:"role"`
+	OrgId       int        `json:"org_id"`
+	FullName    string     `json:"full_name"`
+	Email       *string    `json:"email"`
+	Phone       *string    `json:"phone"`
+	Active      bool       `json:"active"`
+	TwoFactor   bool       `json:"two_factor_enabled"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+// CreateUserRequest creates a user. The role defaults to "user" and new
+// users are active unless Active is false.
+type CreateUserRequest struct {
+	Username string  `json:"username"`
+	Password string  `json:"password"`
+	Role     string  `json:"role"`
+	FullName string  `json:"full_name"`
+	Email    *string `json:"email"`
+	Phone    *string `json:"phone"`
+	Active   *bool   `json:"active"`
+}
+
+// UpdateUserRequest changes the fields that are set and leaves the others.
+// An empty email or phone clears it.
+type UpdateUserRequest struct {
+	Username *string `json:"username"`
+	Password *string `json:"password"`
+	Role     *string `json:"role"`
+	FullName *string `json:"full_name"`
+	Email    *string `json:"email"`
+	Phone    *string `json:"phone"`
+	Active   *bool   `json:"active"`
 }
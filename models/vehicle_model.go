@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Vehicle is a truck or other vehicle of the fleet. Weights are in kg.
+// DeviceId is the tracker installed in it, and Driver the driver it is
+// currently assigned to. LegacyDriverWeight is the weight drivers had
+// before vehicles existed, of unknown meaning, until it is moved into
+// TareWeightKg or CapacityKg and cleared; it is not set on create.
+type Vehicle struct {
+	ID                 int            `json:"id"`
+	CreateTime         time.Time      `json:"create_time"`
+	Plate              string         `json:"plate"`
+	VIN                string         `json:"vin"`
+	Make               string         `json:"make"`
+	Model              string         `json:"model"`
+	Trailer            string         `json:"trailer"` // plate of the trailer
+	CapacityKg         int            `json:"capacity_kg"`
+	TareWeightKg       int            `json:"tare_weight_kg"`
+	LegacyDriverWeight *int           `json:"legacy_driver_weight"`
+	FuelType           string         `json:"fuel_type"`
+	DeviceId           *string        `json:"device_id"`
+	Driver             *CurrentDriver `json:"driver"`
+}
@@ -0,0 +1,151 @@
+// Package notify delivers messages to users by email or SMS.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+	"tm/config"
+)
+
+// Channels a message can be sent on.
+const (
+	Email = "email"
+	SMS   = "sms"
+)
+
+// ErrNoChannel is returned for messages on a channel nothing delivers.
+var ErrNoChannel = errors.New("notify: unknown channel")
+
+// Message is a text message to one recipient. Subject is not used for SMS.
+type Message struct {
+	Channel string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier sends messages.
+type Notifier interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// LogNotifier writes messages to the log instead of sending them. It is the
+// stand-in until a real channel is configured.
+type LogNotifier struct{}
+
+func (LogNotifier) Send(ctx context.Context, m Message) error {
+	log.Printf("Notification (%s) to %s: %s\n%s\n", m.Channel, m.To, m.Subject, m.Body)
+	return nil
+}
+
+// SMTPNotifier sends email through an SMTP server, using STARTTLS when the
+// server offers it.
+type SMTPNotifier struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (s SMTPNotifier) Send(ctx context.Context, m Message) error {
+	if strings.ContainsAny(m.To, "\r\n") {
+		return fmt.Errorf("notify: invalid address %q", m.To)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", m.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	addr := s.Host + ":" + strconv.Itoa(s.Port)
+	return smtp.SendMail(addr, auth, s.From, []string{m.To}, msg.Bytes())
+}
+
+// WebhookNotifier posts messages as JSON {"to": ..., "text": ...} to an
+// HTTP gateway, the common denominator of SMS providers.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (w WebhookNotifier) Send(ctx context.Context, m Message) error {
+	body, err := json.Marshal(map[string]string{"to": m.To, "text": m.Body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("notify: sms gateway: %s: %s", resp.Status, text)
+	}
+	return nil
+}
+
+// Router hands each message to the Notifier of its channel.
+type Router map[string]Notifier
+
+func (r Router) Send(ctx context.Context, m Message) error {
+	n, ok := r[m.Channel]
+	if !ok {
+		return ErrNoChannel
+	}
+	return n.Send(ctx, m)
+}
+
+// Default delivers the messages of the service, set by Init.
+var Default Notifier = Router{Email: LogNotifier{}, SMS: LogNotifier{}}
+
+// Init sets up Default from the configuration.
+func Init() {
+	cfg := config.C.Notify
+	router := Router{Email: LogNotifier{}, SMS: LogNotifier{}}
+	if cfg.SMTP.Host != "" {
+		router[Email] = SMTPNotifier{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.SMTP.From,
+		}
+	} else {
+		log.Println("Email is not configured: messages are only logged")
+	}
+	if cfg.SMSWebhook != "" {
+		router[SMS] = WebhookNotifier{URL: cfg.SMSWebhook}
+	} else {
+		log.Println("SMS is not configured: messages are only logged")
+	}
+	Default = router
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" || r.URL.Query().Get("token") != "t0ken" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	w := WebhookNotifier{URL: srv.URL + "/send?token=t0ken"}
+	if err := w.Send(context.Background(), Message{Channel: SMS, To: "+15550100", Body: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if got["to"] != "+15550100" || got["text"] != "hello" {
+		t.Errorf("gateway got %v", got)
+	}
+
+	w.URL = srv.URL + "/send"
+	err := w.Send(context.Background(), Message{Channel: SMS, To: "+15550100", Body: "hello"})
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("refused message: got %v, want the gateway's status", err)
+	}
+}
+
+type recorder []Message
+
+func (r *recorder) Send(ctx context.Context, m Message) error {
+	*r = append(*r, m)
+	return nil
+}
+
+func TestRouter(t *testing.T) {
+	var email recorder
+	router := Router{Email: &email}
+	if err := router.Send(context.Background(), Message{Channel: Email, To: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(email) != 1 {
+		t.Errorf("email channel got %d messages, want 1", len(email))
+	}
+	if err := router.Send(context.Background(), Message{Channel: SMS, To: "+15550100"}); err != ErrNoChannel {
+		t.Errorf("unrouted channel: got %v, want ErrNoChannel", err)
+	}
+}
+
+func TestSMTPRefusesHeaderInjection(t *testing.T) {
+	err := SMTPNotifier{Host: "localhost", Port: 25}.Send(context.Background(),
+		Message{Channel: Email, To: "a@example.com\r\nBcc: b@example.com"})
+	if err == nil || !strings.Contains(err.Error(), "invalid address") {
+		t.Errorf("got %v, want an invalid address error", err)
+	}
+}
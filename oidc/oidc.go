@@ -0,0 +1,344 @@
+// Package oidc logs users in through an OpenID Connect provider with the
+// authorization code flow and PKCE. It finds the provider's endpoints by
+// discovery and checks ID tokens against the provider's published keys.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"tm/config"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// keyRefresh is the least time between two fetches of the provider's keys,
+// so tokens with unknown key IDs cannot make us hammer the provider.
+const keyRefresh = time.Minute
+
+// Provider is a configured OpenID Connect provider.
+type Provider struct {
+	cfg  config.OIDC
+	http *http.Client
+
+	mu        sync.Mutex
+	endpoints *discovery
+	keys      map[string]*rsa.PublicKey
+	keysAt    time.Time
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Identity is what an ID token says about the user.
+type Identity struct {
+	Issuer   string
+	Subject  string
+	Username string
+	Email    string
+	Name     string
+	// Groups are the values of the configured role claim.
+	Groups []string
+	// MFA is whether the amr or acr claim shows that the provider checked a
+	// second factor, by one of the configured values.
+	MFA bool
+}
+
+// Default is the provider of the configuration, or nil if single sign-on is
+// not set up.
+var Default *Provider
+
+// Init sets up Default from the configuration. The provider is only
+// contacted on the first login, so it being down does not stop the service.
+func Init() {
+	if config.C.OIDC.Issuer == "" {
+		return
+	}
+	Default = New(config.C.OIDC)
+}
+
+// New returns a provider for a configuration.
+func New(cfg config.OIDC) *Provider {
+	return &Provider{cfg: cfg, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Issuer returns the issuer identifier of the provider.
+func (p *Provider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, dst interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(dst)
+}
+
+// discover returns the provider's endpoints, fetching them once.
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.endpoints != nil {
+		return p.endpoints, nil
+	}
+
+	var d discovery
+	err := p.getJSON(ctx, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", &d)
+	if err != nil {
+		return nil, err
+	}
+	if d.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc: provider says its issuer is %q, not %q", d.Issuer, p.cfg.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document lacks endpoints")
+	}
+	p.endpoints = &d
+	return p.endpoints, nil
+}
+
+// RandomString returns a random URL-safe string for a state, nonce or PKCE
+// verifier.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthURL returns where to send the browser to log in at the provider.
+func (p *Provider) AuthURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange trades an authorization code for the user's identity, checking
+// the ID token the provider returns.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Identity, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return Identity{}, err
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokens); err != nil {
+		return Identity{}, fmt.Errorf("oidc: token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.Error != "" {
+		return Identity{}, fmt.Errorf("oidc: token request failed: %s %s %s", resp.Status, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return Identity{}, errors.New("oidc: token response has no id_token")
+	}
+	return p.Verify(ctx, tokens.IDToken, nonce)
+}
+
+// Verify checks the signature, issuer, audience, expiry and nonce of an ID
+// token and returns the identity in it.
+func (p *Provider) Verify(ctx context.Context, idToken, nonce string) (Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() != jwt.SigningMethodRS256.Alg() {
+			return nil, fmt.Errorf("oidc: unexpected signing method %s", t.Method.Alg())
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if !claims.VerifyIssuer(p.cfg.Issuer, true) {
+		return Identity{}, errors.New("oidc: ID token has the wrong issuer")
+	}
+	if !claims.VerifyAudience(p.cfg.ClientID, true) {
+		return Identity{}, errors.New("oidc: ID token is not for this client")
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != p.cfg.ClientID {
+		return Identity{}, errors.New("oidc: ID token was issued to another client")
+	}
+	if _, ok := claims["exp"]; !ok {
+		return Identity{}, errors.New("oidc: ID token has no expiry")
+	}
+	if n, _ := claims["nonce"].(string); n == "" || n != nonce {
+		return Identity{}, errors.New("oidc: ID token nonce does not match")
+	}
+
+	id := Identity{Issuer: p.cfg.Issuer}
+	id.Subject, _ = claims["sub"].(string)
+	if id.Subject == "" {
+		return Identity{}, errors.New("oidc: ID token has no subject")
+	}
+	id.Username, _ = claims[p.cfg.UsernameClaim].(string)
+	id.Email, _ = claims["email"].(string)
+	id.Name, _ = claims["name"].(string)
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		id.Email = ""
+	}
+	id.Groups = stringsClaim(claims[p.cfg.RoleClaim])
+	methods := append(stringsClaim(claims["amr"]), stringsClaim(claims["acr"])...)
+	for _, m := range methods {
+		for _, v := range p.cfg.MFAValues {
+			id.MFA = id.MFA || m == v
+		}
+	}
+	return id, nil
+}
+
+// stringsClaim returns the values of a claim that is a string or an array
+// of strings.
+func stringsClaim(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Role returns the role for an identity by the role map, or the default
+// role, or "" if the identity gets none.
+func (p *Provider) Role(id Identity) string {
+	for _, g := range id.Groups {
+		if role, ok := p.cfg.RoleMap[g]; ok {
+			return role
+		}
+	}
+	return p.cfg.DefaultRole
+}
+
+// key returns the provider's signing key with an ID, fetching the key set
+// again if it is not known.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k := p.lookup(kid); k != nil {
+		return k, nil
+	}
+	if time.Since(p.keysAt) < keyRefresh {
+		return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+	}
+	if p.endpoints == nil {
+		return nil, errors.New("oidc: provider not discovered")
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	p.keysAt = time.Now()
+	if err := p.getJSON(ctx, p.endpoints.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) > 4 {
+			log.Printf("Skipping malformed OIDC key %q\n", k.Kid)
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys = keys
+
+	if k := p.lookup(kid); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+}
+
+// lookup finds a known key. Tokens without a key ID match a provider that
+// has only one key.
+func (p *Provider) lookup(kid string) *rsa.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k
+		}
+	}
+	return p.keys[kid]
+}
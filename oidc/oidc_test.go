@@ -0,0 +1,155 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"tm/config"
+	"tm/oidc/oidctest"
+)
+
+// login goes through the authorization code flow at a mock provider as
+// username and returns the identity the ID token gives.
+func login(t *testing.T, p *Provider, username, groups string, mfa bool) Identity {
+	t.Helper()
+	ctx := context.Background()
+	state, _ := RandomString()
+	nonce, _ := RandomString()
+	verifier, _ := RandomString()
+	authURL, err := p.AuthURL(ctx, state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := u.Query()
+	form.Set("username", username)
+	form.Set("groups", groups)
+	if mfa {
+		form.Set("mfa", "1")
+	}
+	u.RawQuery = ""
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.PostForm(u.String(), form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("login page answered %s", resp.Status)
+	}
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Query().Get("state") != state {
+		t.Fatalf("state came back as %q", back.Query().Get("state"))
+	}
+
+	id, err := p.Exchange(ctx, back.Query().Get("code"), verifier, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Provider) {
+	mock, err := oidctest.New("", "tm", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(mock.Handler())
+	t.Cleanup(srv.Close)
+	mock.Issuer = srv.URL
+
+	p := New(config.OIDC{
+		Issuer:        srv.URL,
+		ClientID:      "tm",
+		ClientSecret:  "secret",
+		RedirectURL:   "http://tm.test/api/oidc/callback",
+		Scopes:        []string{"openid"},
+		UsernameClaim: "preferred_username",
+		RoleClaim:     "groups",
+		RoleMap:       map[string]string{"fleet-admins": "admin"},
+		DefaultRole:   "user",
+		MFAValues:     []string{"mfa"},
+	})
+	return p, mock
+}
+
+func TestExchange(t *testing.T) {
+	p, _ := newTestProvider(t)
+
+	id := login(t, p, "alice", "staff,fleet-admins", false)
+	if id.Subject != "mock-alice" || id.Username != "alice" || id.Email != "alice@example.com" {
+		t.Errorf("identity = %+v", id)
+	}
+	if got := p.Role(id); got != "admin" {
+		t.Errorf("Role = %q, want admin", got)
+	}
+	if id.MFA {
+		t.Error("MFA set for a login with a password only")
+	}
+
+	id = login(t, p, "bob", "staff", true)
+	if !id.MFA {
+		t.Error("MFA not set though amr has mfa")
+	}
+	if got := p.Role(id); got != "user" {
+		t.Errorf("Role = %q, want the default role", got)
+	}
+}
+
+func TestExchangeWrongVerifier(t *testing.T) {
+	p, _ := newTestProvider(t)
+	ctx := context.Background()
+
+	authURL, err := p.AuthURL(ctx, "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	form := u.Query()
+	form.Set("username", "mallory")
+	u.RawQuery = ""
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.PostForm(u.String(), form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	back, _ := url.Parse(resp.Header.Get("Location"))
+
+	_, err = p.Exchange(ctx, back.Query().Get("code"), "another verifier", "nonce")
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("Exchange with a wrong verifier: got %v, want invalid_grant", err)
+	}
+}
+
+func TestMFAValues(t *testing.T) {
+	p, _ := newTestProvider(t)
+	p.cfg.MFAValues = []string{"urn:example:loa:2"}
+
+	// amr mfa alone does not count when the configuration asks for an acr
+	if id := login(t, p, "carol", "", true); id.MFA {
+		t.Error("MFA set by a value not configured")
+	}
+}
+
+func TestStringsClaim(t *testing.T) {
+	if got := stringsClaim("a"); len(got) != 1 || got[0] != "a" {
+		t.Errorf("string claim = %v", got)
+	}
+	if got := stringsClaim([]interface{}{"a", 1, "b"}); len(got) != 2 || got[1] != "b" {
+		t.Errorf("array claim = %v", got)
+	}
+	if got := stringsClaim(nil); got != nil {
+		t.Errorf("missing claim = %v", got)
+	}
+}
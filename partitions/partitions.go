@@ -0,0 +1,404 @@
+// Package partitions manages the monthly range partitions of
+// device_locations: it converts the original table in place, creates future
+// partitions ahead of time, and applies the retention policy to old ones.
+// Fixes outside every monthly partition, such as those of a device with its
+// clock years ahead or late fixes for a dropped month, land in a default
+// partition instead of failing the insert.
+package partitions
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"tm/config"
+	"tm/database"
+	"tm/models"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	parentTable  = "device_locations"
+	legacyTable  = "device_locations_legacy"
+	defaultTable = "device_locations_default"
+	// convertLock is the advisory lock that keeps concurrent instances from
+	// converting the table at the same time.
+	convertLock = 7202403302
+)
+
+// Policy controls how long location history is kept and at what resolution.
+type Policy struct {
+	// FullResolution is how long every fix is kept. Older fixes are thinned
+	// to one per device and DownsampleInterval.
+	FullResolution     time.Duration
+	DownsampleInterval time.Duration
+	// Retention is how long any fix is kept; zero keeps history forever.
+	Retention time.Duration
+	// Premake is how many months of partitions exist ahead of the current one.
+	Premake int
+	// CheckInterval is how often the maintenance job runs.
+	CheckInterval time.Duration
+	// ArchiveBeforeDrop keeps expired partitions until they have been
+	// archived, and keeps partitions at full resolution until then so that
+	// archives hold every fix.
+	ArchiveBeforeDrop bool
+}
+
+// Current is the policy in effect, set by Init.
+var Current = Policy{CheckInterval: time.Hour}
+
+// Init takes the retention policy from the configuration, converts
+// device_locations to a partitioned table if it is not one yet and makes sure
+// partitions exist for the coming months.
+func Init() {
+	day := 24 * time.Hour
+	Current.FullResolution = time.Duration(config.C.Locations.FullResolutionDays) * day
+	Current.DownsampleInterval = time.Duration(config.C.Locations.DownsampleMinutes) * time.Minute
+	Current.Retention = time.Duration(config.C.Locations.RetentionDays) * day
+	Current.Premake = config.C.Locations.PremakeMonths
+
+	ctx := context.Background()
+	if err := convert(ctx, time.Now()); err != nil {
+		log.Fatalf("Unable to partition %s: %v\n", parentTable, err)
+	}
+	if _, err := database.DBpool.Exec(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s DEFAULT",
+		pgx.Identifier{defaultTable}.Sanitize(), parentTable)); err != nil {
+		log.Fatalf("Unable to create %s: %v\n", defaultTable, err)
+	}
+	if err := ensureFuture(ctx, time.Now()); err != nil {
+		log.Fatalf("Unable to create %s partitions: %v\n", parentTable, err)
+	}
+}
+
+// Run performs maintenance now and then every CheckInterval. It never returns.
+func Run() {
+	ticker := time.NewTicker(Current.CheckInterval)
+	defer ticker.Stop()
+	for {
+		if err := Maintain(context.Background(), time.Now()); err != nil {
+			log.Println("Error maintaining location partitions:", err)
+		}
+		<-ticker.C
+	}
+}
+
+// Maintain creates upcoming partitions, downsamples partitions that left the
+// full resolution window and drops partitions past the retention period,
+// together with fixes of the default partition that are past it.
+func Maintain(ctx context.Context, now time.Time) error {
+	if err := ensureFuture(ctx, now); err != nil {
+		return err
+	}
+
+	parts, err := List(ctx)
+	if err != nil {
+		return err
+	}
+
+	compactBefore := now.Add(-Current.FullResolution).Unix()
+	dropBefore := int64(0)
+	if Current.Retention > 0 {
+		dropBefore = now.Add(-Current.Retention).Unix()
+		if _, err := database.DBpool.Exec(ctx,
+			fmt.Sprintf("DELETE FROM %s WHERE timestamp < $1", pgx.Identifier{defaultTable}.Sanitize()), dropBefore); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range parts {
+		if p.State == "dropped" || p.State == "archived" {
+			continue
+		}
+		if dropBefore > 0 && p.RangeEnd <= dropBefore {
+			if Current.ArchiveBeforeDrop && p.ArchiveKey == "" {
+				continue
+			}
+			if err := drop(ctx, p); err != nil {
+				return err
+			}
+			continue
+		}
+		if dropBefore > 0 && p.RangeStart < dropBefore {
+			// Only the legacy partition spans several months and can be
+			// partly expired.
+			if _, err := database.DBpool.Exec(ctx,
+				fmt.Sprintf("DELETE FROM %s WHERE timestamp < $1", pgx.Identifier{p.Name}.Sanitize()), dropBefore); err != nil {
+				return err
+			}
+		}
+		// Archives get every fix, so downsampling waits for them
+		if Current.ArchiveBeforeDrop && p.ArchiveKey == "" {
+			continue
+		}
+		if until := min(p.RangeEnd, compactBefore); until > p.CompactedUntil {
+			if err := compact(ctx, p, until); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// List returns the partitions known to the manager with their current size.
+func List(ctx context.Context) ([]models.Partition, error) {
+	rows, err := database.DBpool.Query(ctx, `
+		SELECT p.name, p.range_start, p.range_end, p.compacted_until, p.archive_key, p.dropped_at IS NOT NULL,
+		       COALESCE(c.reltuples, 0)::bigint, COALESCE(pg_total_relation_size(c.oid), 0)
+		FROM location_partitions p
+		LEFT JOIN pg_class c ON c.relname = p.name AND c.relkind = 'r'
+		ORDER BY p.range_start`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parts := []models.Partition{}
+	for rows.Next() {
+		var p models.Partition
+		var dropped bool
+		if err := rows.Scan(&p.Name, &p.RangeStart, &p.RangeEnd, &p.CompactedUntil, &p.ArchiveKey, &dropped, &p.Rows, &p.SizeBytes); err != nil {
+			return nil, err
+		}
+		switch {
+		case dropped && p.ArchiveKey != "":
+			p.State = "archived"
+		case dropped:
+			p.State = "dropped"
+		case p.CompactedUntil >= p.RangeEnd:
+			p.State = "downsampled"
+		case p.CompactedUntil > p.RangeStart:
+			p.State = "partially downsampled"
+		default:
+			p.State = "full resolution"
+		}
+		if p.Rows < 0 {
+			p.Rows = 0
+		}
+		parts = append(parts, p)
+	}
+	return parts, rows.Err()
+}
+
+// DefaultRows returns how many fixes are in the default partition, outside
+// every monthly one.
+func DefaultRows(ctx context.Context) (int64, error) {
+	var n int64
+	err := database.DBpool.QueryRow(ctx, fmt.Sprintf("SELECT count(*) FROM %s", pgx.Identifier{defaultTable}.Sanitize())).Scan(&n)
+	return n, err
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func partitionName(month time.Time) string {
+	return fmt.Sprintf("%s_p%04d_%02d", parentTable, month.Year(), int(month.Month()))
+}
+
+// convert turns a plain device_locations table into a partitioned one. The
+// existing table becomes the legacy partition holding everything before the
+// next month, so no rows are copied; its triggers move to the parent so they
+// keep firing for every partition.
+func convert(ctx context.Context, now time.Time) error {
+	var kind string
+	err := database.DBpool.QueryRow(ctx, "SELECT relkind::text FROM pg_class WHERE oid = $1::regclass", parentTable).Scan(&kind)
+	if err != nil {
+		return err
+	}
+	if kind == "p" {
+		return nil
+	}
+
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", convertLock); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "LOCK TABLE device_locations IN ACCESS EXCLUSIVE MODE"); err != nil {
+		return err
+	}
+	// Another instance may have converted the table while this one waited.
+	if err := tx.QueryRow(ctx, "SELECT relkind::text FROM pg_class WHERE oid = $1::regclass", parentTable).Scan(&kind); err != nil {
+		return err
+	}
+	if kind == "p" {
+		return nil
+	}
+
+	rows, err := tx.Query(ctx, `SELECT tgname, pg_get_triggerdef(oid) FROM pg_trigger
+		WHERE tgrelid = 'device_locations'::regclass AND NOT tgisinternal`)
+	if err != nil {
+		return err
+	}
+	var triggerNames, triggerDefs []string
+	for rows.Next() {
+		var name, def string
+		if err := rows.Scan(&name, &def); err != nil {
+			rows.Close()
+			return err
+		}
+		triggerNames = append(triggerNames, name)
+		triggerDefs = append(triggerDefs, def)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	bound := monthStart(now).AddDate(0, 1, 0)
+	statements := []string{}
+	for _, name := range triggerNames {
+		statements = append(statements, fmt.Sprintf("DROP TRIGGER %s ON device_locations", pgx.Identifier{name}.Sanitize()))
+	}
+	statements = append(statements,
+		"ALTER TABLE device_locations RENAME TO device_locations_legacy",
+		"ALTER INDEX IF EXISTS device_locations_device_id_timestamp_idx RENAME TO device_locations_legacy_device_id_timestamp_idx",
+		"CREATE TABLE device_locations (LIKE device_locations_legacy INCLUDING DEFAULTS INCLUDING CONSTRAINTS) PARTITION BY RANGE (timestamp)",
+		"CREATE INDEX device_locations_device_id_timestamp_idx ON device_locations (device_id, timestamp DESC)",
+		fmt.Sprintf("ALTER TABLE device_locations ATTACH PARTITION device_locations_legacy FOR VALUES FROM (MINVALUE) TO (%d)", bound.Unix()),
+	)
+	// pg_get_triggerdef names the table as it was, which is now the parent.
+	statements = append(statements, triggerDefs...)
+	for _, stmt := range statements {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("%s: %w", strings.SplitN(stmt, "\n", 2)[0], err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx,
+		"INSERT INTO location_partitions (name, range_start, range_end) VALUES ($1, 0, $2)",
+		legacyTable, bound.Unix()); err != nil {
+		return err
+	}
+
+	log.Printf("Converted %s to a partitioned table, existing rows kept in %s", parentTable, legacyTable)
+	return tx.Commit(ctx)
+}
+
+// ensureFuture creates the monthly partitions from the end of the newest one
+// up to Premake months after the current month.
+func ensureFuture(ctx context.Context, now time.Time) error {
+	var last int64
+	err := database.DBpool.QueryRow(ctx, "SELECT COALESCE(MAX(range_end), 0) FROM location_partitions").Scan(&last)
+	if err != nil {
+		return err
+	}
+
+	month := monthStart(now)
+	if last > 0 {
+		month = time.Unix(last, 0).UTC()
+	}
+	target := monthStart(now).AddDate(0, Current.Premake+1, 0)
+	for ; month.Before(target); month = month.AddDate(0, 1, 0) {
+		if err := create(ctx, partitionName(month), month.Unix(), month.AddDate(0, 1, 0).Unix()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// create adds the partition for [start, end) unless it exists. Fixes of the
+// range that went to the default partition, which would keep the new one
+// from being attached, are moved into it first.
+func create(ctx context.Context, name string, start, end int64) error {
+	tx, err := database.DBpool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	if err := tx.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", name).Scan(&exists); err != nil {
+		return err
+	}
+	var moved int64
+	if !exists {
+		table := pgx.Identifier{name}.Sanitize()
+		if _, err := tx.Exec(ctx, fmt.Sprintf(
+			"CREATE TABLE %s (LIKE device_locations INCLUDING DEFAULTS INCLUDING CONSTRAINTS)", table)); err != nil {
+			return fmt.Errorf("creating %s: %w", name, err)
+		}
+		tag, err := tx.Exec(ctx, fmt.Sprintf(
+			"WITH moved AS (DELETE FROM %s WHERE timestamp >= $1 AND timestamp < $2 RETURNING *) INSERT INTO %s SELECT * FROM moved",
+			pgx.Identifier{defaultTable}.Sanitize(), table), start, end)
+		if err != nil {
+			return fmt.Errorf("filling %s: %w", name, err)
+		}
+		moved = tag.RowsAffected()
+		if _, err := tx.Exec(ctx, fmt.Sprintf(
+			"ALTER TABLE device_locations ATTACH PARTITION %s FOR VALUES FROM (%d) TO (%d)", table, start, end)); err != nil {
+			return fmt.Errorf("attaching %s: %w", name, err)
+		}
+	}
+	_, err = tx.Exec(ctx,
+		"INSERT INTO location_partitions (name, range_start, range_end, compacted_until) VALUES ($1, $2, $3, $2) ON CONFLICT (name) DO NOTHING",
+		name, start, end)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	if !exists {
+		log.Printf("Created location partition %s, moved %d rows into it from %s", name, moved, defaultTable)
+	}
+	return nil
+}
+
+// compact keeps only the first fix per device and downsample interval in
+// [p.CompactedUntil, until) of a partition.
+func compact(ctx context.Context, p models.Partition, until int64) error {
+	table := pgx.Identifier{p.Name}.Sanitize()
+	interval := int64(Current.DownsampleInterval / time.Second)
+	tag, err := database.DBpool.Exec(ctx, fmt.Sprintf(`
+		DELETE FROM %[1]s t
+		WHERE t.timestamp >= $1 AND t.timestamp < $2
+		  AND EXISTS (
+		      SELECT 1 FROM %[1]s o
+		      WHERE o.device_id = t.device_id
+		        AND o.timestamp < t.timestamp
+		        AND o.timestamp >= t.timestamp - t.timestamp %% $3
+		  )`, table), p.CompactedUntil, until, interval)
+	if err != nil {
+		return fmt.Errorf("downsampling %s: %w", p.Name, err)
+	}
+	if _, err := database.DBpool.Exec(ctx, "UPDATE location_partitions SET compacted_until=$1 WHERE name=$2", until, p.Name); err != nil {
+		return err
+	}
+	log.Printf("Downsampled location partition %s up to %d, removed %d rows", p.Name, until, tag.RowsAffected())
+	return nil
+}
+
+// Archived records that a partition has been archived under key with rows
+// fixes and the given SHA-256 sum. The partition stays in the database until
+// Drop.
+func Archived(ctx context.Context, name, key string, rows int64, sha256Hex string) error {
+	_, err := database.DBpool.Exec(ctx,
+		"UPDATE location_partitions SET archive_key=$1, archive_rows=$2, archive_sha256=$3, archived_at=now() WHERE name=$4",
+		key, rows, sha256Hex, name)
+	return err
+}
+
+// Drop removes an archived partition from the database.
+func Drop(ctx context.Context, name string) error {
+	return drop(ctx, models.Partition{Name: name})
+}
+
+// drop removes a partition that is entirely past the retention period.
+func drop(ctx context.Context, p models.Partition) error {
+	if _, err := database.DBpool.Exec(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", pgx.Identifier{p.Name}.Sanitize())); err != nil {
+		return fmt.Errorf("dropping %s: %w", p.Name, err)
+	}
+	if _, err := database.DBpool.Exec(ctx, "UPDATE location_partitions SET dropped_at=now() WHERE name=$1", p.Name); err != nil {
+		return err
+	}
+	log.Printf("Dropped location partition %s", p.Name)
+	return nil
+}
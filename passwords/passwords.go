@@ -0,0 +1,139 @@
+// Package passwords decides which passwords may be set: long enough, not on
+// a list of breached passwords and not one of the user's recent passwords.
+package passwords
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"tm/config"
+	"tm/database"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Rejected explains why a password may not be used. Its message is meant
+// for the user.
+type Rejected struct {
+	Reason string
+}
+
+func (r *Rejected) Error() string { return r.Reason }
+
+// Policy holds the rules for new passwords.
+type Policy struct {
+	MinLength int
+	History   int
+	breached  map[[sha1.Size]byte]struct{}
+}
+
+// Default is the policy of the service, set by Init.
+var Default = &Policy{MinLength: 8}
+
+// Init sets up Default from the configuration.
+func Init() {
+	cfg := config.C.Password
+	Default = &Policy{MinLength: cfg.MinLength, History: cfg.History}
+	if cfg.BreachedList == "" {
+		return
+	}
+	breached, err := LoadBreached(cfg.BreachedList)
+	if err != nil {
+		log.Fatalf("Unable to load breached password list: %v\n", err)
+	}
+	Default.breached = breached
+	log.Printf("Loaded %d breached passwords\n", len(breached))
+}
+
+// LoadBreached reads a list of passwords, one per line, given either as the
+// password itself or as its SHA-1 in hex, optionally followed by ":count".
+func LoadBreached(path string) (map[[sha1.Size]byte]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	breached := make(map[[sha1.Size]byte]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if key, ok := hexHash(line); ok {
+			breached[key] = struct{}{}
+		} else {
+			breached[sha1.Sum([]byte(line))] = struct{}{}
+		}
+	}
+	return breached, scanner.Err()
+}
+
+// hexHash parses a line of a hash list such as "5BAA61E4...:3303003".
+func hexHash(line string) ([sha1.Size]byte, bool) {
+	var key [sha1.Size]byte
+	if i := strings.IndexByte(line, ':'); i == 2*sha1.Size {
+		line = line[:i]
+	}
+	if len(line) != 2*sha1.Size {
+		return key, false
+	}
+	if _, err := hex.Decode(key[:], []byte(line)); err != nil {
+		return key, false
+	}
+	return key, true
+}
+
+// Check returns a *Rejected error if a user may not set a password. userId
+// is 0 for users that do not exist yet.
+func (p *Policy) Check(ctx context.Context, userId int, username, password string) error {
+	if len([]rune(password)) < p.MinLength {
+		return &Rejected{fmt.Sprintf("password must be at least %d characters", p.MinLength)}
+	}
+	if strings.EqualFold(password, username) {
+		return &Rejected{"password must not be the username"}
+	}
+	if _, ok := p.breached[sha1.Sum([]byte(password))]; ok {
+		return &Rejected{"password is too common or has appeared in a data breach"}
+	}
+	if userId == 0 || p.History == 0 {
+		return nil
+	}
+
+	rows, err := database.DBpool.Query(ctx,
+		"SELECT hash FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2", userId, p.History)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return err
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return &Rejected{fmt.Sprintf("password must differ from your last %d passwords", p.History)}
+		}
+	}
+	return rows.Err()
+}
+
+// Record remembers the hash of a password just set for a user and forgets
+// those older than the history needs.
+func (p *Policy) Record(ctx context.Context, userId int, hash string) error {
+	_, err := database.DBpool.Exec(ctx, "INSERT INTO password_history (user_id, hash) VALUES ($1, $2)", userId, hash)
+	if err != nil {
+		return err
+	}
+	_, err = database.DBpool.Exec(ctx,
+		`DELETE FROM password_history WHERE user_id = $1 AND id NOT IN
+		 (SELECT id FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2)`,
+		userId, p.History)
+	return err
+}
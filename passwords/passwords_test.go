@@ -0,0 +1,80 @@
+package passwords
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadBreached(t *testing.T) {
+	sum := sha1.Sum([]byte("hunter22"))
+	upper := strings.ToUpper(hex.EncodeToString(sum[:]))
+	list := "password1\r\n\n" + upper + ":3303003\n" + "qwertyuiop\n"
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	breached, err := LoadBreached(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(breached) != 3 {
+		t.Errorf("loaded %d passwords, want 3", len(breached))
+	}
+	for _, p := range []string{"password1", "hunter22", "qwertyuiop"} {
+		if _, ok := breached[sha1.Sum([]byte(p))]; !ok {
+			t.Errorf("%q missing from the list", p)
+		}
+	}
+
+	if _, err := LoadBreached(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("missing list loaded")
+	}
+}
+
+func TestHexHash(t *testing.T) {
+	tests := []struct {
+		line string
+		ok   bool
+	}{
+		{"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8", true},
+		{"5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8:42", true},
+		{"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD", false},
+		{"ZBAA61E4C9B93F3F0682250B6CF8331B7EE68FD8", false},
+		{"password", false},
+	}
+	for _, tt := range tests {
+		if _, ok := hexHash(tt.line); ok != tt.ok {
+			t.Errorf("hexHash(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p := &Policy{MinLength: 10, breached: map[[sha1.Size]byte]struct{}{sha1.Sum([]byte("correcthorse")): {}}}
+	tests := []struct {
+		username, password string
+		rejected           bool
+	}{
+		{"alice", "short", true},
+		// Length counts characters, not bytes
+		{"alice", "ääääääääää", false},
+		{"alice", "äääääääää", true},
+		{"LongUsername", "longusername", true},
+		{"alice", "correcthorse", true},
+		{"alice", "battery staple", false},
+	}
+	for _, tt := range tests {
+		err := p.Check(context.Background(), 0, tt.username, tt.password)
+		var rejected *Rejected
+		if errors.As(err, &rejected) != tt.rejected || (err != nil && !tt.rejected) {
+			t.Errorf("Check(%q, %q) = %v, want rejected %v", tt.username, tt.password, err, tt.rejected)
+		}
+	}
+}
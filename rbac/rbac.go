@@ -0,0 +1,109 @@
+// Package rbac keeps the permissions granted to each role in memory so they
+// can be checked on every request without a query.
+package rbac
+
+import (
+	"context"
+	"sync"
+	"tm/database"
+)
+
+// Permissions checked by the routes.
+const (
+	DeviceRead      = "device:read"
+	DeviceAll       = "device:all"
+	DeviceWrite     = "device:write"
+	DeviceCommand   = "device:command"
+	DriverRead      = "driver:read"
+	DriverWrite     = "driver:write"
+	VehicleRead     = "vehicle:read"
+	VehicleWrite    = "vehicle:write"
+	SpeedLimitWrite = "speed_limit:write"
+	UserManage      = "user:manage"
+	SystemRead      = "system:read"
+	OrgManage       = "org:manage"
+	AuditRead       = "audit:read"
+)
+
+var (
+	grants   map[string]map[string]bool
+	grantsMu sync.RWMutex
+)
+
+// Load reads the permissions of every role. It is called on startup and after
+// every change made through the admin endpoints.
+func Load() error {
+	rows, err := database.DBpool.Query(context.Background(), "SELECT role, permission FROM role_permissions")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	g := make(map[string]map[string]bool)
+	for rows.Next() {
+		var role, permission string
+		if err := rows.Scan(&role, &permission); err != nil {
+			return err
+		}
+		if g[role] == nil {
+			g[role] = make(map[string]bool)
+		}
+		g[role][permission] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	grantsMu.Lock()
+	grants = g
+	grantsMu.Unlock()
+	return nil
+}
+
+// SetGrants replaces the permissions of every role without the database,
+// for tests.
+func SetGrants(g map[string][]string) {
+	m := make(map[string]map[string]bool)
+	for role, perms := range g {
+		m[role] = make(map[string]bool)
+		for _, p := range perms {
+			m[role][p] = true
+		}
+	}
+	grantsMu.Lock()
+	grants = m
+	grantsMu.Unlock()
+}
+
+// Can reports whether a role grants a permission.
+func Can(role, permission string) bool {
+	grantsMu.RLock()
+	defer grantsMu.RUnlock()
+	return grants[role][permission]
+}
+
+// Covers reports whether a role grants every permission another role does.
+// Only holders of a role that covers another may grant it or act on the
+// accounts that have it, so nobody can take over an account that outranks
+// them.
+func Covers(role, other string) bool {
+	grantsMu.RLock()
+	defer grantsMu.RUnlock()
+	for p := range grants[other] {
+		if !grants[role][p] {
+			return false
+		}
+	}
+	return true
+}
+
+// Permissions returns the permissions granted to a role.
+func Permissions(role string) []string {
+	grantsMu.RLock()
+	defer grantsMu.RUnlock()
+	perms := make([]string, 0, len(grants[role]))
+	for p := range grants[role] {
+		perms = append(perms, p)
+	}
+	return perms
+}
@@ -0,0 +1,34 @@
+package rbac
+
+import "testing"
+
+func TestCovers(t *testing.T) {
+	SetGrants(map[string][]string{
+		"superadmin": {DeviceRead, UserManage, SystemRead, OrgManage},
+		"admin":      {DeviceRead, UserManage},
+		"user":       {DeviceRead},
+		"auditor":    {AuditRead},
+	})
+
+	tests := []struct {
+		role, other string
+		want        bool
+	}{
+		{"superadmin", "admin", true},
+		{"superadmin", "superadmin", true},
+		{"admin", "admin", true},
+		{"admin", "user", true},
+		// An org admin must not act on the superadmin of the same org
+		{"admin", "superadmin", false},
+		{"user", "admin", false},
+		{"admin", "auditor", false},
+		// A role without permissions is covered by any role
+		{"user", "unknown", true},
+		{"unknown", "user", false},
+	}
+	for _, tt := range tests {
+		if got := Covers(tt.role, tt.other); got != tt.want {
+			t.Errorf("Covers(%q, %q) = %v, want %v", tt.role, tt.other, got, tt.want)
+		}
+	}
+}
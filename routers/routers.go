@@ -1,8 +1,10 @@
 package routes
 
 import (
+	"tm/apikeys"
 	"tm/controllers"
 	"tm/middlewares"
+	"tm/rbac"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/swagger"
@@ -18,34 +20,147 @@ func SetupRoutes(app *fiber.App) {
 
 	// Auth
 	app.Post("/api/login", controllers.Login)
+	app.Post("/api/login/2fa", controllers.LoginTwoFactor)
+	app.Post("/api/login/2fa/setup", controllers.LoginTwoFactorSetup)
+	app.Post("/api/refresh", controllers.Refresh)
+	app.Post("/api/logout", controllers.LogoutWithRefresh, middlewares.Authenticate, middlewares.SessionOnly, controllers.Logout)
+	app.Post("/api/password/forgot", controllers.ForgotPassword)
+	app.Post("/api/password/reset", controllers.ResetPassword)
+	app.Get("/api/oidc/login", controllers.OIDCLogin)
+	app.Get("/api/oidc/callback", controllers.OIDCCallback)
 
-	// User routes
-	userGroup := app.Group("/api", middlewares.OnlyUser)
+	// Authenticated routes. Requests may also be made with an API key, which
+	// only reaches the route groups its scopes name below.
+	userGroup := app.Group("/api", middlewares.Authenticate)
+
+	// Own account
+	userGroup.Use("/me", middlewares.SessionOnly)
+	userGroup.Get("/me", controllers.GetProfile)
+	userGroup.Put("/me/update", controllers.UpdateProfile)
+	userGroup.Post("/me/password", controllers.ChangePassword)
+	userGroup.Get("/me/sessions", controllers.GetMySessions)
+	userGroup.Delete("/me/sessions", controllers.RevokeOtherSessions)
+	userGroup.Delete("/me/sessions/:id", controllers.RevokeMySession)
+	userGroup.Get("/me/2fa", controllers.GetTwoFactor)
+	userGroup.Post("/me/2fa/setup", controllers.SetupTwoFactor)
+	userGroup.Post("/me/2fa/enable", controllers.EnableTwoFactor)
+	userGroup.Post("/me/2fa/disable", controllers.DisableTwoFactor)
+	userGroup.Post("/me/2fa/recovery_codes", controllers.RegenerateRecoveryCodes)
+	userGroup.Get("/me/api_keys", controllers.GetMyAPIKeys)
+	userGroup.Post("/me/api_keys", controllers.CreateMyAPIKey)
+	userGroup.Delete("/me/api_keys/:id", controllers.RevokeMyAPIKey)
+	userGroup.Get("/me/identities", controllers.GetMyIdentities)
+	userGroup.Post("/me/identities/link", controllers.LinkIdentity)
+	userGroup.Delete("/me/identities/:id", controllers.UnlinkIdentity)
+
+	deviceRead := middlewares.RequirePermission(rbac.DeviceRead)
+	deviceWrite := middlewares.RequirePermission(rbac.DeviceWrite)
+	deviceCommand := middlewares.RequirePermission(rbac.DeviceCommand)
+	driverRead := middlewares.RequirePermission(rbac.DriverRead)
+	driverWrite := middlewares.RequirePermission(rbac.DriverWrite)
+	vehicleRead := middlewares.RequirePermission(rbac.VehicleRead)
+	vehicleWrite := middlewares.RequirePermission(rbac.VehicleWrite)
+	speedLimitWrite := middlewares.RequirePermission(rbac.SpeedLimitWrite)
+	userManage := middlewares.RequirePermission(rbac.UserManage)
+	systemRead := middlewares.RequirePermission(rbac.SystemRead)
+	orgManage := middlewares.RequirePermission(rbac.OrgManage)
+	auditRead := middlewares.RequirePermission(rbac.AuditRead)
+
+	devicesScope := middlewares.RequireScope(apikeys.ScopeDevices)
 
 	// Device routes
-	userGroup.Get("/device/all_device", controllers.GetAllDevices)
-	userGroup.Get("/device/last_locations", controllers.GetAllDevicesLastLocation)
-	userGroup.Post("/device/locations", controllers.AddDeviceLocation)
-	userGroup.Get("/device/location_list/:id", controllers.GetDeviceLocations)
+	userGroup.Use("/device", devicesScope)
+	userGroup.Get("/device/all_device", deviceRead, controllers.GetAllDevices)
+	userGroup.Get("/device/last_locations", deviceRead, controllers.GetAllDevicesLastLocation)
+	userGroup.Get("/device/nearest", deviceRead, controllers.GetNearestDevices)
+	userGroup.Post("/device/locations", deviceWrite, controllers.AddDeviceLocation)
+	userGroup.Get("/device/location_list/:id", deviceRead, controllers.RequireDevice, controllers.GetDeviceLocations)
+	userGroup.Get("/device/events/:id", deviceRead, controllers.RequireDevice, controllers.GetDeviceEvents)
+	userGroup.Get("/device/export/:id", deviceRead, controllers.RequireDevice, controllers.ExportDeviceTrack)
+	userGroup.Post("/device/lock/:id", deviceCommand, controllers.RequireDevice, controllers.SetDeviceLock)
 
 	// Driver routes
-	userGroup.Get("/driver/all_driver", controllers.GetAllDrivers)
-	userGroup.Get("/driver/get_driver/:id", controllers.GetDriverById)
-	userGroup.Post("/driver/create_driver", controllers.CreateDriver)
-	userGroup.Delete("/driver/delete_driver/:id", controllers.DeleteDriver)
-	userGroup.Put("/driver/update_driver/:id", controllers.UpdateDriver)
+	userGroup.Use("/driver", middlewares.RequireScope(apikeys.ScopeDrivers))
+	userGroup.Get("/driver/all_driver", driverRead, controllers.GetAllDrivers)
+	userGroup.Get("/driver/get_driver/:id", driverRead, controllers.GetDriverById)
+	userGroup.Post("/driver/create_driver", driverWrite, controllers.CreateDriver)
+	userGroup.Delete("/driver/delete_driver/:id", driverWrite, controllers.DeleteDriver)
+	userGroup.Put("/driver/update_driver/:id", driverWrite, controllers.UpdateDriver)
+	userGroup.Post("/driver/assign", driverWrite, controllers.AssignDriver)
+	userGroup.Post("/driver/unassign/:id", driverWrite, controllers.UnassignDriver)
+	userGroup.Get("/driver/assignments", driverRead, controllers.GetDriverAssignments)
+	userGroup.Get("/driver/report/:id", driverRead, controllers.GetDriverReport)
+	userGroup.Get("/driver/not_allowed", driverRead, controllers.GetDriversNotAllowed)
+	userGroup.Get("/driver/documents/:id", driverRead, controllers.GetDriverDocuments)
+	userGroup.Get("/driver/document/expiring", driverRead, controllers.GetExpiringDocuments)
+	userGroup.Get("/driver/document/alerts", driverRead, controllers.GetDocumentAlerts)
+	userGroup.Post("/driver/document/create", driverWrite, controllers.CreateDriverDocument)
+	userGroup.Put("/driver/document/update/:id", driverWrite, controllers.UpdateDriverDocument)
+	userGroup.Delete("/driver/document/delete/:id", driverWrite, controllers.DeleteDriverDocument)
+	userGroup.Get("/driver/document/file/:id", driverRead, controllers.GetDriverDocumentFile)
+	userGroup.Put("/driver/document/file/:id", driverWrite, controllers.UploadDriverDocumentFile)
+
+	// Vehicle routes
+	userGroup.Use("/vehicle", middlewares.RequireScope(apikeys.ScopeVehicles))
+	userGroup.Get("/vehicle/all_vehicle", vehicleRead, controllers.GetAllVehicles)
+	userGroup.Get("/vehicle/get_vehicle/:id", vehicleRead, controllers.GetVehicleById)
+	userGroup.Post("/vehicle/create_vehicle", vehicleWrite, controllers.CreateVehicle)
+	userGroup.Put("/vehicle/update_vehicle/:id", vehicleWrite, controllers.UpdateVehicle)
+	userGroup.Delete("/vehicle/delete_vehicle/:id", vehicleWrite, controllers.DeleteVehicle)
 
 	// Home page route
-	userGroup.Get("/main", controllers.Home_page)
+	userGroup.Get("/main", devicesScope, deviceRead, controllers.Home_page)
 
 	// Admin routes
-	adminGroup := app.Group("/api/admin", middlewares.OnlyAdmin)
-	adminGroup.Get("/allusers", controllers.GetAllUser)
-	adminGroup.Post("/createuser", controllers.CreateUser)
-	adminGroup.Get("/getuser/:id", controllers.GetUserById)
-	adminGroup.Put("/update/:id", controllers.UpdateUser)
-	adminGroup.Delete("/delete/:id", controllers.DeleteUser)
+	adminGroup := userGroup.Group("/admin", middlewares.RequireScope(apikeys.ScopeAdmin))
+	adminGroup.Get("/allusers", userManage, controllers.GetAllUser)
+	adminGroup.Post("/createuser", userManage, controllers.CreateUser)
+	adminGroup.Get("/getuser/:id", userManage, controllers.GetUserById)
+	adminGroup.Put("/update/:id", userManage, controllers.UpdateUser)
+	adminGroup.Delete("/delete/:id", userManage, controllers.DeleteUser)
+	adminGroup.Post("/revoke_sessions/:id", userManage, controllers.RevokeUserSessions)
+	adminGroup.Post("/unlock/:id", userManage, controllers.UnlockUser)
+	adminGroup.Post("/reset_2fa/:id", userManage, controllers.ResetUserTwoFactor)
+	adminGroup.Get("/login_failures", userManage, controllers.GetLoginFailures)
+	adminGroup.Get("/api_key/all", userManage, controllers.GetAPIKeys)
+	adminGroup.Post("/api_key/create", middlewares.SessionOnly, userManage, controllers.CreateAPIKey)
+	adminGroup.Delete("/api_key/delete/:id", userManage, controllers.RevokeAPIKey)
+	adminGroup.Get("/audit", auditRead, controllers.GetAuditLog)
+	adminGroup.Get("/audit/verify", auditRead, controllers.VerifyAuditLog)
+	adminGroup.Put("/device/vehicle_type/:id", deviceWrite, controllers.SetDeviceVehicleType)
+
+	// Device access routes
+	adminGroup.Get("/device_group/all", userManage, controllers.GetDeviceGroups)
+	adminGroup.Post("/device_group/create", userManage, controllers.CreateDeviceGroup)
+	adminGroup.Put("/device_group/devices/:id", userManage, controllers.ChangeDeviceGroupDevices)
+	adminGroup.Delete("/device_group/delete/:id", userManage, controllers.DeleteDeviceGroup)
+	adminGroup.Post("/user_access/bulk", userManage, controllers.ChangeUserAccess)
+	adminGroup.Get("/user_access/:id", userManage, controllers.GetUserAccess)
+	adminGroup.Put("/user_access/:id", userManage, controllers.SetUserAccess)
+
+	// Role routes. Roles are shared by all organizations.
+	adminGroup.Get("/role/all", userManage, controllers.GetRoles)
+	adminGroup.Post("/role/create", orgManage, controllers.CreateRole)
+	adminGroup.Put("/role/update/:name", orgManage, controllers.UpdateRole)
+	adminGroup.Delete("/role/delete/:name", orgManage, controllers.DeleteRole)
+	adminGroup.Put("/role/require_2fa/:name", orgManage, controllers.SetRoleTwoFactor)
+	adminGroup.Get("/permission/all", userManage, controllers.GetPermissions)
+
+	// Organization routes
+	adminGroup.Get("/org/all", orgManage, controllers.GetOrganizations)
+	adminGroup.Post("/org/create", orgManage, controllers.CreateOrganization)
+	adminGroup.Post("/org/switch/:id", middlewares.SessionOnly, orgManage, controllers.SwitchOrganization)
+
+	// Speed limit routes
+	adminGroup.Get("/speed_limit/all", speedLimitWrite, controllers.GetSpeedLimits)
+	adminGroup.Post("/speed_limit/create", speedLimitWrite, controllers.CreateSpeedLimit)
+	adminGroup.Delete("/speed_limit/delete/:id", speedLimitWrite, controllers.DeleteSpeedLimit)
+
+	// Location storage routes
+	adminGroup.Get("/partitions", systemRead, controllers.GetPartitions)
+
+	adminGroup.Get("/config", systemRead, controllers.GetConfig)
 
 	// WebSocket route
-	app.Get("/socket", websocket.New(controllers.HandleConnection))
+	app.Get("/socket", middlewares.Authenticate, devicesScope, deviceRead, websocket.New(controllers.HandleConnection))
 }
@@ -0,0 +1,274 @@
+// Package sessions stores login sessions and their rotating refresh tokens,
+// and answers whether the session behind an access token is still valid.
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+	"tm/config"
+	"tm/database"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrInvalid is returned for refresh tokens that are unknown, expired or
+// belong to a revoked session.
+var ErrInvalid = errors.New("invalid refresh token")
+
+// cacheTTL bounds how long a revocation made by another instance can go
+// unnoticed by this one.
+const (
+	cacheTTL        = 15 * time.Second
+	maxCacheEntries = 100000
+)
+
+// Session is a login session of a user.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int       `json:"userId"`
+	OrgID      int       `json:"orgId"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+type cacheEntry struct {
+	active    bool
+	checkedAt time.Time
+}
+
+var (
+	cache   = make(map[string]cacheEntry)
+	cacheMu sync.Mutex
+)
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create starts a session for a user in an organization and returns it with
+// its first refresh token.
+func Create(ctx context.Context, userID, orgID int, userAgent, ip string) (Session, string, error) {
+	id, err := randomToken(16)
+	if err != nil {
+		return Session{}, "", err
+	}
+	refresh, err := randomToken(32)
+	if err != nil {
+		return Session{}, "", err
+	}
+
+	s := Session{ID: id, UserID: userID, OrgID: orgID, UserAgent: userAgent, IP: ip}
+	err = database.DBpool.QueryRow(ctx,
+		`INSERT INTO sessions (id, user_id, org_id, refresh_hash, user_agent, ip, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING created_at, last_used_at, expires_at`,
+		id, userID, orgID, hash(refresh), userAgent, ip, time.Now().Add(config.C.JWT.RefreshTTL),
+	).Scan(&s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt)
+	if err != nil {
+		return Session{}, "", err
+	}
+	return s, refresh, nil
+}
+
+// Rotate exchanges a refresh token for a new one and extends the session.
+// Presenting a token that was already rotated means it has been copied, so
+// the whole session is revoked.
+func Rotate(ctx context.Context, refresh, ip string) (Session, string, error) {
+	h := hash(refresh)
+
+	var s Session
+	var expired, revoked bool
+	err := database.DBpool.QueryRow(ctx,
+		`SELECT id, user_id, org_id, user_agent, created_at, expires_at, expires_at < now(), revoked_at IS NOT NULL
+		 FROM sessions WHERE refresh_hash = $1`, h,
+	).Scan(&s.ID, &s.UserID, &s.OrgID, &s.UserAgent, &s.CreatedAt, &s.ExpiresAt, &expired, &revoked)
+	if err == pgx.ErrNoRows {
+		var reusedID string
+		err := database.DBpool.QueryRow(ctx, "SELECT id FROM sessions WHERE previous_hash = $1", h).Scan(&reusedID)
+		if err == nil {
+			Revoke(ctx, reusedID)
+		}
+		return Session{}, "", ErrInvalid
+	}
+	if err != nil {
+		return Session{}, "", err
+	}
+	if expired || revoked {
+		return Session{}, "", ErrInvalid
+	}
+
+	next, err := randomToken(32)
+	if err != nil {
+		return Session{}, "", err
+	}
+	err = database.DBpool.QueryRow(ctx,
+		`UPDATE sessions SET refresh_hash = $1, previous_hash = $2, last_used_at = now(), ip = $3, expires_at = $4
+		 WHERE id = $5 AND refresh_hash = $2 AND revoked_at IS NULL
+		 RETURNING last_used_at, expires_at`,
+		hash(next), h, ip, time.Now().Add(config.C.JWT.RefreshTTL), s.ID,
+	).Scan(&s.LastUsedAt, &s.ExpiresAt)
+	if err == pgx.ErrNoRows {
+		// Another request rotated the same token first.
+		return Session{}, "", ErrInvalid
+	}
+	if err != nil {
+		return Session{}, "", err
+	}
+	s.IP = ip
+	return s, next, nil
+}
+
+// Get returns an active session.
+func Get(ctx context.Context, id string) (Session, error) {
+	var s Session
+	err := database.DBpool.QueryRow(ctx,
+		`SELECT id, user_id, org_id, user_agent, ip, created_at, last_used_at, expires_at
+		 FROM sessions WHERE id = $1 AND revoked_at IS NULL AND expires_at > now()`, id,
+	).Scan(&s.ID, &s.UserID, &s.OrgID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt)
+	if err == pgx.ErrNoRows {
+		return Session{}, ErrInvalid
+	}
+	return s, err
+}
+
+// List returns the active sessions of a user, most recently used first.
+func List(ctx context.Context, userID int) ([]Session, error) {
+	rows, err := database.DBpool.Query(ctx,
+		`SELECT id, user_id, org_id, user_agent, ip, created_at, last_used_at, expires_at
+		 FROM sessions WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()
+		 ORDER BY last_used_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.OrgID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// SetOrg changes the organization a session is looking at. Access tokens
+// issued before keep the old one until they expire.
+func SetOrg(ctx context.Context, id string, orgID int) error {
+	_, err := database.DBpool.Exec(ctx, "UPDATE sessions SET org_id = $1 WHERE id = $2", orgID, id)
+	return err
+}
+
+// Revoke ends a session.
+func Revoke(ctx context.Context, id string) error {
+	_, err := database.DBpool.Exec(ctx, "UPDATE sessions SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL", id)
+	forget(id)
+	return err
+}
+
+// RevokeRefresh ends the session of a refresh token and reports whether it
+// was active.
+func RevokeRefresh(ctx context.Context, refresh string) (bool, error) {
+	var id string
+	err := database.DBpool.QueryRow(ctx,
+		"UPDATE sessions SET revoked_at = now() WHERE refresh_hash = $1 AND revoked_at IS NULL AND expires_at > now() RETURNING id",
+		hash(refresh)).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	forget(id)
+	return true, nil
+}
+
+// RevokeOwn ends a session if it belongs to a user, and reports whether it
+// was active.
+func RevokeOwn(ctx context.Context, id string, userID int) (bool, error) {
+	result, err := database.DBpool.Exec(ctx,
+		"UPDATE sessions SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > now()", id, userID)
+	forget(id)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+// RevokeUser ends every session of a user and returns how many were active.
+func RevokeUser(ctx context.Context, userID int) (int64, error) {
+	return RevokeUserExcept(ctx, userID, "")
+}
+
+// RevokeUserExcept ends every session of a user but one and returns how many
+// were active.
+func RevokeUserExcept(ctx context.Context, userID int, keep string) (int64, error) {
+	rows, err := database.DBpool.Query(ctx,
+		"UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL RETURNING id", userID, keep)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var n int64
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return n, err
+		}
+		forget(id)
+		n++
+	}
+	return n, rows.Err()
+}
+
+// Active reports whether a session exists, has not expired and has not been
+// revoked. Answers are cached briefly since it is checked on every request.
+func Active(ctx context.Context, id string) (bool, error) {
+	cacheMu.Lock()
+	entry, ok := cache[id]
+	cacheMu.Unlock()
+	if ok && time.Since(entry.checkedAt) < cacheTTL {
+		return entry.active, nil
+	}
+
+	var active bool
+	err := database.DBpool.QueryRow(ctx,
+		"SELECT revoked_at IS NULL AND expires_at > now() FROM sessions WHERE id = $1", id).Scan(&active)
+	if err != nil && err != pgx.ErrNoRows {
+		return false, err
+	}
+
+	cacheMu.Lock()
+	if len(cache) >= maxCacheEntries {
+		cache = make(map[string]cacheEntry)
+	}
+	cache[id] = cacheEntry{active: active, checkedAt: time.Now()}
+	cacheMu.Unlock()
+	return active, nil
+}
+
+func forget(id string) {
+	cacheMu.Lock()
+	delete(cache, id)
+	cacheMu.Unlock()
+}
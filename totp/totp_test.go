@@ -0,0 +1,105 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA-1 test vectors of RFC 6238 appendix B, cut to 6 digits. The
+// secret is the ASCII string "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCodeRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		got, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v.code {
+			t.Errorf("Code at %d = %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestCodeSecretFormats(t *testing.T) {
+	want, _ := Code(rfcSecret, 1)
+	for _, secret := range []string{strings.ToLower(rfcSecret), rfcSecret + "===="} {
+		if got, err := Code(secret, 1); err != nil || got != want {
+			t.Errorf("Code(%q) = %s, %v; want %s", secret, got, err, want)
+		}
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	code, _ := Code(rfcSecret, step)
+
+	got, ok := Validate(rfcSecret, code[:3]+" "+code[3:], now, 0)
+	if !ok || got != step {
+		t.Fatalf("Validate of the current code = %d, %v; want %d, true", got, ok, step)
+	}
+	// A code must not be accepted twice
+	if _, ok := Validate(rfcSecret, code, now, step); ok {
+		t.Error("code accepted again after its step")
+	}
+
+	prev, _ := Code(rfcSecret, step-1)
+	if got, ok := Validate(rfcSecret, prev, now, 0); !ok || got != step-1 {
+		t.Errorf("code of the previous step = %d, %v; want it within the skew", got, ok)
+	}
+	old, _ := Code(rfcSecret, step-1-Skew)
+	if _, ok := Validate(rfcSecret, old, now, 0); ok {
+		t.Error("code outside the skew accepted")
+	}
+	for _, bad := range []string{"", "12345", "1234567"} {
+		if _, ok := Validate(rfcSecret, bad, now, 0); ok {
+			t.Errorf("code %q accepted", bad)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := GenerateSecret()
+	if a == b || len(a) != 32 {
+		t.Errorf("secrets %q and %q, want two different 32 character secrets", a, b)
+	}
+	if _, err := Code(a, 1); err != nil {
+		t.Errorf("generated secret does not decode: %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("TM Fleet", "alice@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/TM Fleet:alice@example.com" {
+		t.Errorf("URI = %s", u)
+	}
+	q := u.Query()
+	if q.Get("secret") != rfcSecret || q.Get("issuer") != "TM Fleet" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("URI query = %v", q)
+	}
+}